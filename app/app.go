@@ -3,6 +3,7 @@ package app
 import (
 	"database/sql"
 	"log"
+	"net/http"
 	"os"
 	"time"
 
@@ -19,6 +20,10 @@ import (
 
 const (
 	portNumber = ":5001"
+
+	// maxBreakGlassDuration caps RBAC_BREAK_GLASS_DURATION, break-glass
+	// access is for emergencies, not for standing access.
+	maxBreakGlassDuration = 4 * time.Hour
 )
 
 var (
@@ -33,19 +38,35 @@ func Start() {
 	}
 	defer db.Close()
 
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Panic(err)
+	}
+
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
+	router.Use(handler.RequestID())
 
-	rbacRepo := postgres.NewRbac(db)
-	rolesRepo := postgres.NewRoles(db)
-	routesRepo := postgres.NewRoutes(db)
-	rbacService := service.NewRbac(rbacRepo, rolesRepo, routesRepo)
+	auditKey, err := loadAuditKey(auditSigningKey)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if breakGlassDuration <= 0 || breakGlassDuration > maxBreakGlassDuration {
+		log.Panicf("RBAC_BREAK_GLASS_DURATION must be positive and at most %s", maxBreakGlassDuration)
+	}
+	breakGlass := service.BreakGlassConfig{Role: breakGlassRole, Duration: breakGlassDuration, Eligible: breakGlassEligible}
+	decisionLog, err := newDecisionLogger(postgres.NewDecisions(db))
+	if err != nil {
+		log.Panic(err)
+	}
+	notifier := newNotifier()
+	rbacService := service.NewRbac(newRepos(db), transact(db), admins, auditKey, breakGlass, decisionLog, notifier)
 	rbacHandler := handler.NewRbac(rbacService)
 	addRbacRoutes(rbacHandler)
 
@@ -53,5 +74,20 @@ func Start() {
 
 	rbacHandler.MarkActiveRoutes(router)
 
+	if serviceTTL > 0 {
+		go watchStaleServices(rbacService)
+	}
+
+	go expireGrants(rbacService)
+
+	if tlsCert != "" {
+		server := &http.Server{
+			Addr:      portNumber,
+			Handler:   router,
+			TLSConfig: tlsConfig(),
+		}
+		log.Panic(server.ListenAndServeTLS(tlsCert, tlsKey))
+	}
+
 	router.Run(portNumber)
 }
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	client "github.com/demkowo/rbac/client"
+	postgres "github.com/demkowo/rbac/repositories/postgres"
+	service "github.com/demkowo/rbac/services"
+)
+
+// RunCommand runs the command line tool instead of the server, e.g.
+// "rbac openapi -service orders -url https://rbac:5001 openapi.yaml".
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "openapi":
+		return registerOpenAPI(args[1:])
+	case "audit-verify":
+		return verifyAudit(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// registerOpenAPI registers the operations of an OpenAPI 3 document as routes
+// of the service and prints the diff.
+func registerOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	url := fs.String("url", "http://localhost:5001", "base URL of the RBAC service")
+	svc := fs.String("service", "", "name of the service")
+	version := fs.String("version", "", "version of the service")
+	secret := fs.String("secret", os.Getenv("RBAC_SECRET"), "secret signing the registration")
+	metadata := fs.Bool("metadata", false, "store operationId, summary and tags with the routes")
+	dryRun := fs.Bool("dry-run", false, "only print the diff")
+	cert := fs.String("cert", "", "client certificate")
+	key := fs.String("key", "", "client certificate key")
+	ca := fs.String("ca", "", "CA bundle verifying the RBAC service")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *svc == "" || fs.NArg() != 1 {
+		return errors.New("usage: rbac openapi -service <name> [flags] <document>")
+	}
+
+	doc, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	httpClient, err := commandHTTPClient(*cert, *key, *ca)
+	if err != nil {
+		return err
+	}
+
+	diff, err := client.New(client.Config{
+		BaseURL:    *url,
+		Service:    *svc,
+		Version:    *version,
+		Secret:     *secret,
+		HTTPClient: httpClient,
+		DryRun:     *dryRun,
+	}).RegisterOpenAPI(context.Background(), doc, *metadata)
+	if err != nil {
+		return err
+	}
+
+	if diff == nil {
+		fmt.Println("routes unchanged")
+		return nil
+	}
+
+	out, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	return nil
+}
+
+// verifyAudit walks the audit chain straight from the database, so it does
+// not have to trust a running server, and fails on the first broken link.
+func verifyAudit(args []string) error {
+	fs := flag.NewFlagSet("audit-verify", flag.ContinueOnError)
+	dsn := fs.String("db", dbConnection, "connection string of the RBAC database")
+	publicKey := fs.String("public-key", "", "PEM ed25519 public key verifying signatures")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	public, err := loadAuditPublicKey(*publicKey)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := service.VerifyAuditChain(postgres.NewAudit(db), public)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if !res.Valid {
+		return fmt.Errorf("audit chain broken at entry %d: %s", res.BrokenID, res.Reason)
+	}
+	return nil
+}
+
+func commandHTTPClient(cert, key, ca string) (*http.Client, error) {
+	if cert == "" && ca == "" {
+		return http.DefaultClient, nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", ca)
+		}
+		cfg.RootCAs = pool
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}, nil
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	serviceSecrets = parseServiceMap(os.Getenv("RBAC_SERVICE_SECRETS"))
+	signatureSkew  = parseDuration("RBAC_SIGNATURE_SKEW", 5*time.Minute)
+
+	tlsCert           = os.Getenv("RBAC_TLS_CERT")
+	tlsKey            = os.Getenv("RBAC_TLS_KEY")
+	tlsClientCA       = os.Getenv("RBAC_TLS_CLIENT_CA")
+	tlsClientAuth     = os.Getenv("RBAC_TLS_CLIENT_AUTH")
+	serviceIdentities = parseServiceIdentities(os.Getenv("RBAC_SERVICE_IDENTITIES"))
+
+	serviceTTL  = parseDuration("RBAC_SERVICE_TTL", 0)
+	staleAction = os.Getenv("RBAC_STALE_ACTION")
+
+	admins = parseList(os.Getenv("RBAC_ADMINS"))
+
+	auditSigningKey = os.Getenv("RBAC_AUDIT_SIGNING_KEY")
+	trustedProxies  = parseList(os.Getenv("RBAC_TRUSTED_PROXIES"))
+
+	decisionSinks       = os.Getenv("RBAC_DECISION_LOG")
+	decisionFile        = os.Getenv("RBAC_DECISION_LOG_FILE")
+	decisionFileSize    = parseInt("RBAC_DECISION_LOG_MAX_SIZE", 100<<20)
+	decisionFileBackups = parseInt("RBAC_DECISION_LOG_BACKUPS", 5)
+	decisionSampleAllow = parseRate("RBAC_DECISION_SAMPLE_ALLOW", 0.01)
+	decisionSampleDeny  = parseRate("RBAC_DECISION_SAMPLE_DENY", 1)
+	decisionRedact      = parseList(os.Getenv("RBAC_DECISION_REDACT"))
+	decisionRedactPaths = parseList(os.Getenv("RBAC_DECISION_REDACT_PATHS"))
+
+	webhookURLs   = parseList(os.Getenv("RBAC_WEBHOOK_URLS"))
+	webhookSecret = os.Getenv("RBAC_WEBHOOK_SECRET")
+	notifyURLs    = parseList(os.Getenv("RBAC_NOTIFY_URLS"))
+
+	breakGlassRole     = os.Getenv("RBAC_BREAK_GLASS_ROLE")
+	breakGlassDuration = parseDuration("RBAC_BREAK_GLASS_DURATION", time.Hour)
+	breakGlassEligible = parseList(os.Getenv("RBAC_BREAK_GLASS_ELIGIBLE"))
+)
+
+// parseServiceMap parses "service=value,service=value" pairs.
+func parseServiceMap(s string) map[string]string {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		svc, value, ok := strings.Cut(pair, "=")
+		if !ok || svc == "" || value == "" {
+			log.Panicf("invalid service entry: %q", pair)
+		}
+		res[strings.TrimSpace(svc)] = strings.TrimSpace(value)
+	}
+	return res
+}
+
+// parseServiceIdentities parses "service=identity|identity,service=identity".
+func parseServiceIdentities(s string) map[string][]string {
+	res := make(map[string][]string)
+	for svc, value := range parseServiceMap(s) {
+		res[svc] = strings.Split(value, "|")
+	}
+	return res
+}
+
+// parseList parses comma separated values.
+func parseList(s string) []string {
+	var res []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			res = append(res, value)
+		}
+	}
+	return res
+}
+
+func parseInt(env string, def int) int {
+	s := os.Getenv(env)
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		log.Panicf("invalid %s: %q", env, s)
+	}
+	return n
+}
+
+// parseRate parses a rate between 0 and 1.
+func parseRate(env string, def float64) float64 {
+	s := os.Getenv(env)
+	if s == "" {
+		return def
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		log.Panicf("invalid %s: %q, expected a rate between 0 and 1", env, s)
+	}
+	return rate
+}
+
+func parseDuration(env string, def time.Duration) time.Duration {
+	s := os.Getenv(env)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Panicf("invalid %s: %v", env, err)
+	}
+	return d
+}
@@ -6,9 +6,26 @@ import (
 )
 
 const (
-	RBAC_TABLE_EXIST   = "SELECT to_regclass('public.rbac')"
-	ROLES_TABLE_EXIST  = "SELECT to_regclass('public.roles')"
-	ROUTES_TABLE_EXIST = "SELECT to_regclass('public.routes')"
+	RBAC_TABLE_EXIST      = "SELECT to_regclass('public.rbac')"
+	ROLES_TABLE_EXIST     = "SELECT to_regclass('public.roles')"
+	ROUTES_TABLE_EXIST    = "SELECT to_regclass('public.routes')"
+	SERVICES_TABLE_EXIST  = "SELECT to_regclass('public.services')"
+	RULES_TABLE_EXIST     = "SELECT to_regclass('public.binding_rules')"
+	INSTANCES_TABLE_EXIST = "SELECT to_regclass('public.service_instances')"
+	VERSIONS_TABLE_EXIST  = "SELECT to_regclass('public.service_versions')"
+	ROUTE_VERSIONS_EXIST  = "SELECT to_regclass('public.route_versions')"
+	RESOURCES_TABLE_EXIST = "SELECT to_regclass('public.resources')"
+	PERMISSIONS_EXIST     = "SELECT to_regclass('public.resource_permissions')"
+	AUDIT_TABLE_EXIST     = "SELECT to_regclass('public.audit_log')"
+	DECISIONS_TABLE_EXIST = "SELECT to_regclass('public.decision_log')"
+	REVISIONS_TABLE_EXIST = "SELECT to_regclass('public.policy_revisions')"
+	CHANGE_SETS_EXIST     = "SELECT to_regclass('public.change_sets')"
+	ASSIGNMENTS_EXIST     = "SELECT to_regclass('public.role_assignments')"
+	APPROVERS_EXIST       = "SELECT to_regclass('public.role_approvers')"
+	ACCESS_REQUESTS_EXIST = "SELECT to_regclass('public.access_requests')"
+	BREAK_GLASS_EXIST     = "SELECT to_regclass('public.break_glass')"
+	REVIEWS_EXIST         = "SELECT to_regclass('public.review_campaigns')"
+	REVIEW_ITEMS_EXIST    = "SELECT to_regclass('public.review_items')"
 
 	RBAC_CREATE_TABLE = `
         CREATE TABLE IF NOT EXISTS rbac (
@@ -29,14 +46,291 @@ const (
         CREATE TABLE IF NOT EXISTS routes (
             id UUID PRIMARY KEY,
             method VARCHAR(10) NOT NULL,
+            host TEXT NOT NULL DEFAULT '',
             path VARCHAR(255) NOT NULL,
 			service TEXT NOT NULL,
             active BOOLEAN NOT NULL DEFAULT TRUE,
-            UNIQUE (method, path, service)
+            UNIQUE (method, host, path, service)
+        );
+	`
+
+	INSTANCES_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS service_instances (
+            service TEXT NOT NULL,
+            instance TEXT NOT NULL,
+            version TEXT NOT NULL DEFAULT '',
+            last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+            PRIMARY KEY (service, instance)
+        );
+	`
+
+	VERSIONS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS service_versions (
+            service TEXT NOT NULL,
+            version TEXT NOT NULL,
+            fingerprint TEXT NOT NULL DEFAULT '',
+            registered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+            PRIMARY KEY (service, version)
+        );
+	`
+
+	ROUTE_VERSIONS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS route_versions (
+            route_id UUID NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+            version TEXT NOT NULL,
+            PRIMARY KEY (route_id, version)
+        );
+	`
+
+	RESOURCES_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS resources (
+            id UUID PRIMARY KEY,
+            type VARCHAR(64) NOT NULL,
+            name VARCHAR(255) NOT NULL,
+            service TEXT NOT NULL DEFAULT '',
+            description TEXT NOT NULL DEFAULT '',
+            actions TEXT[] NOT NULL DEFAULT '{}',
+            UNIQUE (type, name, service)
+        );
+	`
+
+	PERMISSIONS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS resource_permissions (
+            resource_id UUID NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+            role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+            action VARCHAR(64) NOT NULL,
+            PRIMARY KEY (resource_id, role_id, action)
+        );
+	`
+
+	// The trigger keeps audit_log append-only, rows can be neither updated
+	// nor deleted.
+	AUDIT_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS audit_log (
+            id BIGSERIAL PRIMARY KEY,
+            actor TEXT NOT NULL,
+            ip TEXT NOT NULL DEFAULT '',
+            request_id TEXT NOT NULL DEFAULT '',
+            action VARCHAR(32) NOT NULL,
+            entity VARCHAR(32) NOT NULL,
+            entity_id TEXT NOT NULL DEFAULT '',
+            before JSONB,
+            after JSONB,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            prev_hash TEXT NOT NULL DEFAULT '',
+            hash TEXT NOT NULL DEFAULT '',
+            signature TEXT NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, created_at);
+        CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity, entity_id, created_at);
+        CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+        BEGIN
+            RAISE EXCEPTION 'audit_log is append-only';
+        END;
+        $$ LANGUAGE plpgsql;
+        CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+            FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+        CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+            FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+	`
+
+	DECISIONS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS decision_log (
+            id UUID PRIMARY KEY,
+            time TIMESTAMPTZ NOT NULL,
+            source TEXT NOT NULL,
+            request_id TEXT NOT NULL DEFAULT '',
+            subject TEXT NOT NULL DEFAULT '',
+            roles TEXT[] NOT NULL DEFAULT '{}',
+            role_ids UUID[],
+            service TEXT NOT NULL DEFAULT '',
+            method VARCHAR(10) NOT NULL,
+            host TEXT NOT NULL DEFAULT '',
+            path TEXT NOT NULL,
+            route_id UUID,
+            route TEXT NOT NULL DEFAULT '',
+            effect VARCHAR(8) NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            latency_us BIGINT NOT NULL DEFAULT 0,
+            sample_rate REAL NOT NULL DEFAULT 1
+        );
+        CREATE INDEX IF NOT EXISTS decision_log_time_idx ON decision_log (time);
+        CREATE INDEX IF NOT EXISTS decision_log_route_idx ON decision_log (route_id, time);
+        CREATE INDEX IF NOT EXISTS decision_log_subject_idx ON decision_log (subject, time);
+	`
+
+	// Revisions are immutable like the audit log.
+	REVISIONS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS policy_revisions (
+            revision BIGSERIAL PRIMARY KEY,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            actor TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            snapshot JSONB NOT NULL,
+            hash TEXT NOT NULL
+        );
+        CREATE OR REPLACE FUNCTION policy_revisions_immutable() RETURNS trigger AS $$
+        BEGIN
+            RAISE EXCEPTION 'policy_revisions are immutable';
+        END;
+        $$ LANGUAGE plpgsql;
+        CREATE TRIGGER policy_revisions_immutable BEFORE UPDATE OR DELETE ON policy_revisions
+            FOR EACH ROW EXECUTE FUNCTION policy_revisions_immutable();
+	`
+
+	ACCESS_REQUESTS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS access_requests (
+            id UUID PRIMARY KEY,
+            requester TEXT NOT NULL,
+            role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+            route_id UUID REFERENCES routes(id) ON DELETE CASCADE,
+            reason TEXT NOT NULL,
+            duration TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            decided_by TEXT NOT NULL DEFAULT '',
+            decided_at TIMESTAMPTZ,
+            comment TEXT NOT NULL DEFAULT '',
+            expires_at TIMESTAMPTZ,
+            grant_owned BOOLEAN NOT NULL DEFAULT false
+        );
+        CREATE INDEX IF NOT EXISTS access_requests_status_idx ON access_requests (status, created_at);
+        CREATE INDEX IF NOT EXISTS access_requests_requester_idx ON access_requests (requester, created_at);
+	`
+
+	APPROVERS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS role_approvers (
+            role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+            approver TEXT NOT NULL,
+            PRIMARY KEY (role_id, approver)
+        );
+	`
+
+	ASSIGNMENTS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS role_assignments (
+            subject TEXT NOT NULL,
+            role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+            granted_by TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            expires_at TIMESTAMPTZ,
+            PRIMARY KEY (subject, role_id)
+        );
+        CREATE INDEX IF NOT EXISTS role_assignments_expires_idx ON role_assignments (expires_at);
+	`
+
+	// Break-glass access keeps the role name, so the history survives the
+	// role. At most one access per actor is active.
+	BREAK_GLASS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS break_glass (
+            id UUID PRIMARY KEY,
+            actor TEXT NOT NULL,
+            role_id UUID NOT NULL,
+            role TEXT NOT NULL,
+            justification TEXT NOT NULL,
+            started_at TIMESTAMPTZ NOT NULL,
+            expires_at TIMESTAMPTZ NOT NULL,
+            ended_at TIMESTAMPTZ,
+            ended_by TEXT NOT NULL DEFAULT ''
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS break_glass_active_idx ON break_glass (actor) WHERE ended_at IS NULL;
+        CREATE INDEX IF NOT EXISTS break_glass_started_idx ON break_glass (started_at);
+	`
+
+	REVIEWS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS review_campaigns (
+            id UUID PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            service TEXT NOT NULL DEFAULT '',
+            role_id UUID,
+            role TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL,
+            created_by TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            due_at TIMESTAMPTZ,
+            closed_by TEXT NOT NULL DEFAULT '',
+            closed_at TIMESTAMPTZ
+        );
+	`
+
+	// Review items copy the route and role of the binding, so the evidence
+	// survives them.
+	REVIEW_ITEMS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS review_items (
+            id UUID PRIMARY KEY,
+            campaign_id UUID NOT NULL REFERENCES review_campaigns(id) ON DELETE CASCADE,
+            route_id UUID NOT NULL,
+            method TEXT NOT NULL,
+            host TEXT NOT NULL DEFAULT '',
+            path TEXT NOT NULL,
+            service TEXT NOT NULL,
+            role_id UUID NOT NULL,
+            role TEXT NOT NULL,
+            reviewer TEXT NOT NULL,
+            decision TEXT NOT NULL,
+            comment TEXT NOT NULL DEFAULT '',
+            decided_by TEXT NOT NULL DEFAULT '',
+            decided_at TIMESTAMPTZ,
+            result TEXT NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS review_items_campaign_idx ON review_items (campaign_id, reviewer);
+	`
+
+	CHANGE_SETS_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS change_sets (
+            id UUID PRIMARY KEY,
+            title TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL,
+            author TEXT NOT NULL,
+            contributors TEXT[] NOT NULL DEFAULT '{}',
+            operations JSONB NOT NULL DEFAULT '[]',
+            version INT NOT NULL DEFAULT 1,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            approved_by TEXT NOT NULL DEFAULT '',
+            approved_at TIMESTAMPTZ,
+            published_by TEXT NOT NULL DEFAULT '',
+            published_at TIMESTAMPTZ,
+            revision BIGINT REFERENCES policy_revisions(revision)
+        );
+        CREATE INDEX IF NOT EXISTS change_sets_status_idx ON change_sets (status, created_at);
+	`
+
+	RULES_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS binding_rules (
+            id UUID PRIMARY KEY,
+            name VARCHAR(255) NOT NULL UNIQUE,
+            service TEXT NOT NULL DEFAULT '',
+            method VARCHAR(10) NOT NULL DEFAULT '',
+            path_pattern TEXT NOT NULL DEFAULT '',
+            role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE
+        );
+	`
+
+	SERVICES_CREATE_TABLE = `
+        CREATE TABLE IF NOT EXISTS services (
+            name TEXT PRIMARY KEY,
+            fingerprint TEXT NOT NULL DEFAULT '',
+            registered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            last_seen TIMESTAMPTZ,
+            stale BOOLEAN NOT NULL DEFAULT false
         );
 	`
 )
 
+// migrations alter tables created by earlier versions, they must be safe to
+// run on every start.
+var migrations = []string{
+	`ALTER TABLE rbac ADD COLUMN IF NOT EXISTS rule_id UUID REFERENCES binding_rules(id) ON DELETE SET NULL`,
+	`ALTER TABLE routes ADD COLUMN IF NOT EXISTS metadata JSONB`,
+	`ALTER TABLE routes ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS routes_method_host_path_service_key ON routes (method, host, path, service)`,
+	`ALTER TABLE routes DROP CONSTRAINT IF EXISTS routes_method_path_service_key`,
+}
+
 func CreateTables(db *sql.DB) {
 	if !checkRolesExists(db) {
 		createRoles(db)
@@ -50,7 +344,77 @@ func CreateTables(db *sql.DB) {
 		createRbac(db)
 	}
 
-	log.Println("tables rbac, roles and routes are ready to go")
+	if !checkServicesExists(db) {
+		createServices(db)
+	}
+
+	if !checkRulesExists(db) {
+		createRules(db)
+	}
+
+	if !checkInstancesExists(db) {
+		createInstances(db)
+	}
+
+	if !checkVersionsExists(db) {
+		createVersions(db)
+	}
+
+	if !checkRouteVersionsExists(db) {
+		createRouteVersions(db)
+	}
+
+	if !checkResourcesExists(db) {
+		createResources(db)
+	}
+
+	if !checkPermissionsExists(db) {
+		createPermissions(db)
+	}
+
+	if !checkAuditExists(db) {
+		createAudit(db)
+	}
+
+	if !checkDecisionsExists(db) {
+		createDecisions(db)
+	}
+
+	if !checkRevisionsExists(db) {
+		createRevisions(db)
+	}
+
+	if !checkChangeSetsExists(db) {
+		createChangeSets(db)
+	}
+
+	if !checkAssignmentsExists(db) {
+		createAssignments(db)
+	}
+
+	if !checkApproversExists(db) {
+		createApprovers(db)
+	}
+
+	if !checkAccessRequestsExists(db) {
+		createAccessRequests(db)
+	}
+
+	if !checkBreakGlassExists(db) {
+		createBreakGlass(db)
+	}
+
+	if !checkReviewsExists(db) {
+		createReviews(db)
+	}
+
+	if !checkReviewItemsExists(db) {
+		createReviewItems(db)
+	}
+
+	migrateTables(db)
+
+	log.Println("tables rbac, roles, routes, services, service_instances, service_versions, route_versions, binding_rules, resources, resource_permissions, audit_log, decision_log, policy_revisions, change_sets, role_assignments, role_approvers, access_requests, break_glass, review_campaigns and review_items are ready to go")
 }
 
 func checkRbacExists(db *sql.DB) bool {
@@ -83,6 +447,176 @@ func checkRoutesExists(db *sql.DB) bool {
 	return tableName.Valid
 }
 
+func checkServicesExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(SERVICES_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check services table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkRulesExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(RULES_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check binding_rules table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkInstancesExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(INSTANCES_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check service_instances table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkVersionsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(VERSIONS_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check service_versions table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkRouteVersionsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(ROUTE_VERSIONS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check route_versions table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkResourcesExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(RESOURCES_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check resources table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkPermissionsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(PERMISSIONS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check resource_permissions table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkAuditExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(AUDIT_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check audit_log table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkDecisionsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(DECISIONS_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check decision_log table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkRevisionsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(REVISIONS_TABLE_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check policy_revisions table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkChangeSetsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(CHANGE_SETS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check change_sets table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkAssignmentsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(ASSIGNMENTS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check role_assignments table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkApproversExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(APPROVERS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check role_approvers table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkAccessRequestsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(ACCESS_REQUESTS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check access_requests table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkBreakGlassExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(BREAK_GLASS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check break_glass table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkReviewsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(REVIEWS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check review_campaigns table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
+func checkReviewItemsExists(db *sql.DB) bool {
+	var tableName sql.NullString
+	err := db.QueryRow(REVIEW_ITEMS_EXIST).Scan(&tableName)
+	if err != nil {
+		log.Panicf("failed to check review_items table existence: %v", err)
+	}
+
+	return tableName.Valid
+}
+
 func createRbac(db *sql.DB) {
 	_, err := db.Exec(RBAC_CREATE_TABLE)
 	if err != nil {
@@ -103,3 +637,130 @@ func createRoutes(db *sql.DB) {
 		log.Panicf("failed to create routes table: %v", err)
 	}
 }
+
+func createServices(db *sql.DB) {
+	_, err := db.Exec(SERVICES_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create services table: %v", err)
+	}
+}
+
+func createRules(db *sql.DB) {
+	_, err := db.Exec(RULES_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create binding_rules table: %v", err)
+	}
+}
+
+func createInstances(db *sql.DB) {
+	_, err := db.Exec(INSTANCES_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create service_instances table: %v", err)
+	}
+}
+
+func createVersions(db *sql.DB) {
+	_, err := db.Exec(VERSIONS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create service_versions table: %v", err)
+	}
+}
+
+func createRouteVersions(db *sql.DB) {
+	_, err := db.Exec(ROUTE_VERSIONS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create route_versions table: %v", err)
+	}
+}
+
+func createResources(db *sql.DB) {
+	_, err := db.Exec(RESOURCES_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create resources table: %v", err)
+	}
+}
+
+func createPermissions(db *sql.DB) {
+	_, err := db.Exec(PERMISSIONS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create resource_permissions table: %v", err)
+	}
+}
+
+func createAudit(db *sql.DB) {
+	_, err := db.Exec(AUDIT_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create audit_log table: %v", err)
+	}
+}
+
+func createDecisions(db *sql.DB) {
+	_, err := db.Exec(DECISIONS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create decision_log table: %v", err)
+	}
+}
+
+func createRevisions(db *sql.DB) {
+	_, err := db.Exec(REVISIONS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create policy_revisions table: %v", err)
+	}
+}
+
+func createChangeSets(db *sql.DB) {
+	_, err := db.Exec(CHANGE_SETS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create change_sets table: %v", err)
+	}
+}
+
+func createAssignments(db *sql.DB) {
+	_, err := db.Exec(ASSIGNMENTS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create role_assignments table: %v", err)
+	}
+}
+
+func createApprovers(db *sql.DB) {
+	_, err := db.Exec(APPROVERS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create role_approvers table: %v", err)
+	}
+}
+
+func createAccessRequests(db *sql.DB) {
+	_, err := db.Exec(ACCESS_REQUESTS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create access_requests table: %v", err)
+	}
+}
+
+func createBreakGlass(db *sql.DB) {
+	_, err := db.Exec(BREAK_GLASS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create break_glass table: %v", err)
+	}
+}
+
+func createReviews(db *sql.DB) {
+	_, err := db.Exec(REVIEWS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create review_campaigns table: %v", err)
+	}
+}
+
+func createReviewItems(db *sql.DB) {
+	_, err := db.Exec(REVIEW_ITEMS_CREATE_TABLE)
+	if err != nil {
+		log.Panicf("failed to create review_items table: %v", err)
+	}
+}
+
+func migrateTables(db *sql.DB) {
+	for _, migration := range migrations {
+		if _, err := db.Exec(migration); err != nil {
+			log.Panicf("failed to migrate tables: %v", err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/demkowo/rbac/decisionlog"
+	postgres "github.com/demkowo/rbac/repositories/postgres"
+)
+
+// newDecisionLogger writes decisions to the sinks listed in
+// RBAC_DECISION_LOG, "file", "db" or both.
+func newDecisionLogger(decisions postgres.Decisions) (decisionlog.Logger, error) {
+	cfg := decisionlog.Config{
+		SampleAllow: decisionSampleAllow,
+		SampleDeny:  decisionSampleDeny,
+	}
+
+	for _, field := range decisionRedact {
+		switch field {
+		case decisionlog.FieldSubject, decisionlog.FieldRoles, decisionlog.FieldHost, decisionlog.FieldPath:
+			cfg.Redact = append(cfg.Redact, field)
+		default:
+			return nil, fmt.Errorf("invalid RBAC_DECISION_REDACT field %q", field)
+		}
+	}
+
+	for _, pattern := range decisionRedactPaths {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RBAC_DECISION_REDACT_PATHS pattern %q: %w", pattern, err)
+		}
+		cfg.RedactPaths = append(cfg.RedactPaths, re)
+	}
+
+	var sinks []decisionlog.Sink
+	for _, name := range parseList(decisionSinks) {
+		switch name {
+		case "file":
+			if decisionFile == "" {
+				return nil, fmt.Errorf("RBAC_DECISION_LOG_FILE is required to log decisions to a file")
+			}
+			file, err := decisionlog.NewFile(decisionFile, int64(decisionFileSize), decisionFileBackups)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, file)
+			cfg.Spill = file
+		case "db":
+			sinks = append(sinks, decisions)
+		default:
+			return nil, fmt.Errorf("invalid RBAC_DECISION_LOG sink %q", name)
+		}
+	}
+	return decisionlog.New(cfg, sinks...), nil
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"log"
+	"time"
+
+	service "github.com/demkowo/rbac/services"
+)
+
+// watchStaleServices periodically flags services that no instance reported
+// within serviceTTL and, unless staleAction is "flag", deactivates their routes
+// and retires versions of live services that are no longer running.
+func watchStaleServices(s service.Rbac) {
+	deactivate := staleAction != "flag"
+
+	ticker := time.NewTicker(max(serviceTTL/4, time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if deactivate {
+			expired, err := s.ExpireServiceVersions(serviceTTL)
+			if err != nil {
+				log.Println("retiring expired service versions failed", err)
+			}
+			for _, v := range expired {
+				log.Printf("version %q of service %s not seen for %s, retired", v.Version, v.Service, serviceTTL)
+			}
+		}
+
+		stale, err := s.MarkStaleServices(serviceTTL, deactivate)
+		if err != nil {
+			log.Println("marking stale services failed", err)
+			continue
+		}
+		for _, name := range stale {
+			log.Printf("service %s not seen for %s, marked stale (deactivated: %t)", name, serviceTTL, deactivate)
+		}
+	}
+}
+
+// grantExpiryInterval is how often expired role assignments, bindings
+// granted by access requests and break-glass accesses are revoked.
+const grantExpiryInterval = time.Minute
+
+// expireGrants periodically revokes expired role assignments, the bindings
+// of expired access requests and ends expired break-glass accesses.
+func expireGrants(s service.Rbac) {
+	ticker := time.NewTicker(grantExpiryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		assignments, err := s.ExpireAssignments()
+		if err != nil {
+			log.Println("expiring role assignments failed", err)
+		}
+		for _, a := range assignments {
+			log.Printf("assignment of role %s to %s expired", a.Role, a.Subject)
+		}
+
+		breakGlasses, err := s.ExpireBreakGlass()
+		if err != nil {
+			log.Println("expiring break-glass access failed", err)
+		}
+		for _, b := range breakGlasses {
+			log.Printf("break-glass access of %s to role %s expired", b.Actor, b.Role)
+		}
+
+		requests, err := s.ExpireAccessGrants()
+		if err != nil {
+			log.Println("expiring access grants failed", err)
+		}
+		for _, req := range requests {
+			log.Printf("access granted by request %s expired", req.ID)
+		}
+	}
+}
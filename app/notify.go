@@ -0,0 +1,19 @@
+package app
+
+import (
+	"github.com/demkowo/rbac/notify"
+	service "github.com/demkowo/rbac/services"
+)
+
+// newNotifier sends events to the webhooks in RBAC_WEBHOOK_URLS, signed with
+// RBAC_WEBHOOK_SECRET if set, and to the chat hooks in RBAC_NOTIFY_URLS.
+func newNotifier() service.Notifier {
+	var hooks []notify.Hook
+	for _, url := range webhookURLs {
+		hooks = append(hooks, notify.NewWebhook(url, webhookSecret))
+	}
+	for _, url := range notifyURLs {
+		hooks = append(hooks, notify.NewChat(url))
+	}
+	return notify.New(hooks...)
+}
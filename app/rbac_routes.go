@@ -9,7 +9,17 @@ import (
 )
 
 func addRbacRoutes(h handler.Rbac) {
-	router.POST("/api/v1/routes/:service", h.AddExternalRoutes)
+	router.POST("/api/v1/routes/:service", append(registrationGuards(), h.AddExternalRoutes)...)
+	router.POST("/api/v1/routes/:service/openapi", append(registrationGuards(), h.AddOpenAPIRoutes)...)
+	router.GET("/api/v1/routes/:service/fingerprint", append(registrationGuards(), h.FindServiceFingerprint)...)
+	router.POST("/api/v1/services/:service/heartbeat", append(serviceGuards(), h.Heartbeat)...)
+
+	router.POST("/api/v1/authorize", auth.AuthMiddleware(), h.Authorize)
+	router.GET("/api/v1/manifest", auth.AuthMiddleware(), h.FindManifest)
+	router.GET("/api/v1/audit", auth.AuthMiddleware(), h.FindAudit)
+	router.GET("/api/v1/audit/verify", auth.AuthMiddleware(), h.VerifyAudit)
+	router.GET("/api/v1/decisions", auth.AuthMiddleware(), h.FindDecisions)
+	router.POST("/api/v1/decisions/:service", append(serviceGuards(), h.AddDecisions)...)
 
 	// === ROUTES ===
 	routes := router.Group("/api/v1/routes", auth.AuthMiddleware())
@@ -18,13 +28,14 @@ func addRbacRoutes(h handler.Rbac) {
 		routes.GET("role/:role_id", h.FindRoutesByRole)
 		routes.POST("", h.AddRoute)
 		routes.POST("mark-active", func(c *gin.Context) {
-			res, err := h.MarkActiveRoutes(router)
+			res, err := h.MarkActiveRoutesAs(c, router)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "activation routes failed"})
 				return
 			}
 			c.JSON(http.StatusOK, gin.H{"routes": res})
 		})
+		routes.POST("rename", h.RenameRoute)
 		routes.PUT("/:route_id", h.UpdateRoute)
 		routes.DELETE(":route_id", h.DeleteRoute)
 	}
@@ -37,14 +48,141 @@ func addRbacRoutes(h handler.Rbac) {
 		roles.POST("routes", h.FindRolesByRoutes)
 		roles.POST("", h.AddRole)
 		roles.PUT("/:role_id", h.UpdateRole)
+		roles.GET("/:role_id/approvers", h.FindApprovers)
+		roles.PUT("/:role_id/approvers", h.SetApprovers)
 		roles.DELETE("/:role_id", h.DeleteRole)
 	}
 
+	// === RESOURCES ===
+	resources := router.Group("/api/v1/resources", auth.AuthMiddleware())
+	{
+		resources.GET("", h.FindResources)
+		resources.GET("role/:role_id", h.FindResourcesByRole)
+		resources.GET("/:resource_id", h.FindResource)
+		resources.GET("/:resource_id/roles", h.FindRolesByResource)
+		resources.POST("", h.AddResource)
+		resources.POST("/:resource_id/permissions", h.GrantPermission)
+		resources.PUT("/:resource_id", h.UpdateResource)
+		resources.DELETE("/:resource_id", h.DeleteResource)
+		resources.DELETE("/:resource_id/permissions", h.RevokePermission)
+	}
+
+	// === SERVICES ===
+	services := router.Group("/api/v1/services", auth.AuthMiddleware())
+	{
+		services.GET("", h.FindServices)
+		services.GET("/:service/conflicts", h.FindRouteConflicts)
+		services.GET("/:service/routes", h.FindServiceRoutes)
+		services.DELETE("/:service/versions/:version", h.RetireServiceVersion)
+	}
+
+	// === BINDING RULES ===
+	rules := router.Group("/api/v1/rules", auth.AuthMiddleware())
+	{
+		rules.GET("", h.FindRules)
+		rules.GET("/:rule_id/preview", h.PreviewRule)
+		rules.POST("", h.AddRule)
+		rules.POST("preview", h.PreviewDraftRule)
+		rules.DELETE("/:rule_id", h.DeleteRule)
+	}
+
+	// === ACCESS REQUESTS ===
+	accessRequests := router.Group("/api/v1/access-requests", auth.AuthMiddleware())
+	{
+		accessRequests.POST("", h.AddAccessRequest)
+		accessRequests.GET("", h.FindAccessRequests)
+		accessRequests.GET("/:id", h.FindAccessRequest)
+		accessRequests.POST("/:id/approve", h.ApproveAccessRequest)
+		accessRequests.POST("/:id/reject", h.RejectAccessRequest)
+	}
+
+	// === ROLE ASSIGNMENTS ===
+	assignments := router.Group("/api/v1/assignments", auth.AuthMiddleware())
+	{
+		assignments.GET("", h.FindAssignments)
+		assignments.POST("", h.AddAssignment)
+		assignments.DELETE("", h.DeleteAssignment)
+	}
+
+	// === ACCESS REVIEWS ===
+	reviews := router.Group("/api/v1/reviews", auth.AuthMiddleware())
+	{
+		reviews.POST("", h.StartReview)
+		reviews.GET("", h.FindReviews)
+		reviews.GET("/:id", h.FindReview)
+		reviews.GET("/:id/items", h.FindReviewItems)
+		reviews.GET("/:id/evidence", h.FindReviewEvidence)
+		reviews.POST("/:id/decisions", h.DecideReview)
+		reviews.POST("/:id/reassign", h.ReassignReview)
+		reviews.POST("/:id/close", h.CloseReview)
+	}
+
+	// === BREAK-GLASS ===
+	breakGlass := router.Group("/api/v1/break-glass", auth.AuthMiddleware())
+	{
+		breakGlass.POST("", h.StartBreakGlass)
+		breakGlass.GET("", h.FindBreakGlasses)
+		breakGlass.GET("/:id", h.FindBreakGlass)
+		breakGlass.GET("/:id/report", h.FindBreakGlassReport)
+		breakGlass.POST("/:id/end", h.EndBreakGlass)
+	}
+
+	// === CHANGE SETS ===
+	changeSets := router.Group("/api/v1/changesets", auth.AuthMiddleware())
+	{
+		changeSets.POST("", h.AddChangeSet)
+		changeSets.GET("", h.FindChangeSets)
+		changeSets.GET("/:id", h.FindChangeSet)
+		changeSets.GET("/:id/preview", h.PreviewChangeSet)
+		changeSets.POST("/:id/operations", h.AddChangeOperations)
+		changeSets.DELETE("/:id/operations/:index", h.DeleteChangeOperation)
+		changeSets.POST("/:id/approve", h.ApproveChangeSet)
+		changeSets.POST("/:id/discard", h.DiscardChangeSet)
+		changeSets.POST("/:id/publish", h.PublishChangeSet)
+	}
+
+	// === POLICY REVISIONS ===
+	revisions := router.Group("/api/v1/revisions", auth.AuthMiddleware())
+	{
+		revisions.GET("", h.FindRevisions)
+		revisions.GET("diff", h.DiffRevisions)
+		revisions.GET("/:revision", h.FindRevision)
+		revisions.POST("/:revision/rollback", h.RollbackRevision)
+	}
+
 	// === RBAC (role-route relation) ===
 	rbac := router.Group("/api/v1/rbac", auth.AuthMiddleware())
 	{
 		rbac.GET("", h.FindRbac)
+		rbac.GET("unused", h.FindUnusedRbac)
+		rbac.POST("unused/prune", h.PruneUnusedRbac)
 		rbac.POST("", h.AddRbac)
 		rbac.DELETE("", h.DeleteRbac)
 	}
 }
+
+// registrationGuards returns middlewares protecting endpoints called by
+// external services on their own behalf.
+func registrationGuards() []gin.HandlerFunc {
+	var guards []gin.HandlerFunc
+
+	if len(serviceSecrets) > 0 {
+		guards = append(guards, handler.VerifySignature(serviceSecrets, signatureSkew))
+	}
+
+	if len(serviceIdentities) > 0 {
+		guards = append(guards, handler.VerifyClientIdentity(serviceIdentities))
+	}
+
+	return guards
+}
+
+// serviceGuards returns the registration guards or, if none are configured,
+// the auth middleware, so endpoints that change what other callers are
+// allowed to do are never left open.
+func serviceGuards() []gin.HandlerFunc {
+	if guards := registrationGuards(); len(guards) > 0 {
+		return guards
+	}
+	return []gin.HandlerFunc{auth.AuthMiddleware()}
+}
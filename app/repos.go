@@ -0,0 +1,38 @@
+package app
+
+import (
+	"database/sql"
+
+	postgres "github.com/demkowo/rbac/repositories/postgres"
+	service "github.com/demkowo/rbac/services"
+)
+
+// newRepos creates the repositories of the service on the database or on
+// the transaction of an operation.
+func newRepos(db postgres.DB) service.Repos {
+	return service.Repos{
+		AccessRequests: postgres.NewAccessRequests(db),
+		Assignments:    postgres.NewAssignments(db),
+		Audit:          postgres.NewAudit(db),
+		BreakGlass:     postgres.NewBreakGlass(db),
+		ChangeSets:     postgres.NewChangeSets(db),
+		Decisions:      postgres.NewDecisions(db),
+		Rbac:           postgres.NewRbac(db),
+		Resources:      postgres.NewResources(db),
+		Revisions:      postgres.NewRevisions(db),
+		Reviews:        postgres.NewReviews(db),
+		Roles:          postgres.NewRoles(db),
+		Routes:         postgres.NewRoutes(db),
+		Rules:          postgres.NewRules(db),
+		Services:       postgres.NewServices(db),
+	}
+}
+
+// transact runs the changes of the service in transactions of the database.
+func transact(db *sql.DB) service.Transact {
+	return func(fn func(service.Repos) error) error {
+		return postgres.Atomic(db, func(tx postgres.DB) error {
+			return fn(newRepos(tx))
+		})
+	}
+}
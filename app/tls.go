@@ -0,0 +1,37 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+)
+
+// tlsConfig verifies client certificates against the configured CA bundle.
+// Certificates are optional unless RBAC_TLS_CLIENT_AUTH is set to "require",
+// endpoints that need them enforce it on their own.
+func tlsConfig() *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if tlsClientCA == "" {
+		return cfg
+	}
+
+	pem, err := os.ReadFile(tlsClientCA)
+	if err != nil {
+		log.Panicf("failed to read client CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		log.Panicf("no certificates found in client CA bundle %s", tlsClientCA)
+	}
+
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if tlsClientAuth == "require" {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	handler "github.com/demkowo/rbac/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a client certificate, tmpl carries the identities.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startTLSServer serves a registration endpoint guarded by the client
+// identity of the service with the configured TLS settings.
+func startTLSServer(t *testing.T, ca *testCA, clientAuth string) *httptest.Server {
+	t.Helper()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tlsClientCA, tlsClientAuth = bundle, clientAuth
+	t.Cleanup(func() { tlsClientCA, tlsClientAuth = "", "" })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	identities := map[string][]string{"orders": {"orders", "spiffe://example.org/orders"}}
+	r.POST("/:service", handler.VerifyClientIdentity(identities), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = tlsConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func post(srv *httptest.Server, service string, certs ...tls.Certificate) (int, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+
+	res, err := client.Post(srv.URL+"/"+service, "application/json", nil)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestClientIdentity(t *testing.T) {
+	ca := newTestCA(t, "rbac test CA")
+	srv := startTLSServer(t, ca, "")
+	spiffe, _ := url.Parse("spiffe://example.org/orders")
+
+	tests := []struct {
+		name    string
+		service string
+		certs   []tls.Certificate
+		want    int
+	}{
+		{"common name", "orders", []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})}, http.StatusNoContent},
+		{"URI SAN", "orders", []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders-7f9c"}, URIs: []*url.URL{spiffe}})}, http.StatusNoContent},
+		{"DNS SAN", "orders", []tls.Certificate{ca.issue(t, &x509.Certificate{DNSNames: []string{"orders"}})}, http.StatusNoContent},
+		{"other service", "orders", []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "users"}})}, http.StatusForbidden},
+		{"unmapped service", "users", []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "users"}})}, http.StatusForbidden},
+		{"no certificate", "orders", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		got, err := post(srv, tt.service, tt.certs...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientIdentityUntrustedCA(t *testing.T) {
+	srv := startTLSServer(t, newTestCA(t, "rbac test CA"), "")
+	other := newTestCA(t, "other CA")
+
+	cert := other.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})
+	// Clients may leave out certificates the server does not trust, either
+	// way the request must not pass.
+	if got, err := post(srv, "orders", cert); err == nil && got != http.StatusUnauthorized {
+		t.Errorf("certificate of an untrusted CA got status %d", got)
+	}
+}
+
+func TestClientIdentityRequired(t *testing.T) {
+	ca := newTestCA(t, "rbac test CA")
+	srv := startTLSServer(t, ca, "require")
+
+	if _, err := post(srv, "orders"); err == nil {
+		t.Errorf("handshake without a certificate succeeded")
+	}
+	cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})
+	if got, err := post(srv, "orders", cert); err != nil || got != http.StatusNoContent {
+		t.Errorf("got status %d, %v, want %d", got, err, http.StatusNoContent)
+	}
+}
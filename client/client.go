@@ -0,0 +1,279 @@
+// Package client lets services built with Gin register their routes with the
+// RBAC service.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	signature "github.com/demkowo/rbac/signatures"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultBackoff    = time.Second
+	maxBackoff        = 30 * time.Second
+)
+
+type Config struct {
+	// BaseURL of the RBAC service, e.g. "https://rbac:5001".
+	BaseURL string
+	Service string
+
+	// Instance identifies this replica in heartbeats, e.g. the pod name.
+	Instance string
+
+	// Host the routes are served on, e.g. "admin.example.com". Empty for
+	// routes served on any host.
+	Host string
+
+	// Version of the deployment, e.g. "v2" of a canary. Routes stay active
+	// while any registered version of the service exposes them.
+	Version string
+
+	// Secret signs registrations when the RBAC service verifies signatures.
+	Secret string
+
+	// HTTPClient defaults to http.DefaultClient, set it to present a client
+	// certificate.
+	HTTPClient *http.Client
+
+	// MaxRetries and Backoff control retries of failed registrations, the
+	// backoff doubles after each attempt. Signed registrations should not be
+	// retried within the same second, so Backoff is at least one second.
+	MaxRetries int
+	Backoff    time.Duration
+
+	// Heartbeat re-registers the routes periodically when set, which also
+	// reports the instance as alive.
+	Heartbeat time.Duration
+
+	// DryRun only returns the diff a registration would apply.
+	DryRun bool
+}
+
+type Client interface {
+	Register(context.Context, *gin.Engine) (*model.RouteDiff, error)
+	RegisterOpenAPI(context.Context, []byte, bool) (*model.RouteDiff, error)
+	ReportDecisions(context.Context, []model.DecisionLog) error
+	Start(context.Context, *gin.Engine) error
+}
+
+type client struct {
+	cfg Config
+}
+
+func New(cfg Config) Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.Backoff < defaultBackoff {
+		cfg.Backoff = defaultBackoff
+	}
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+
+	return &client{cfg: cfg}
+}
+
+// Routes converts the routes of the engine to routes of the service.
+func Routes(service string, engine *gin.Engine) []model.Route {
+	var routes []model.Route
+
+	for _, route := range engine.Routes() {
+		routes = append(routes, model.Route{
+			Method:  route.Method,
+			Path:    route.Path,
+			Service: service,
+			Active:  true,
+		})
+	}
+
+	return routes
+}
+
+// Register sends the routes of the engine, retrying with backoff. A nil diff
+// means the routes did not change since the last registration.
+func (cl *client) Register(ctx context.Context, engine *gin.Engine) (*model.RouteDiff, error) {
+	routes := Routes(cl.cfg.Service, engine)
+	for i := range routes {
+		routes[i].Host = cl.cfg.Host
+	}
+
+	body, err := json.Marshal(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	return cl.retry(ctx, "", "application/json", body, neturl.Values{})
+}
+
+// RegisterOpenAPI sends an OpenAPI 3 document, JSON or YAML, whose operations
+// become the routes of the service. With metadata the operationId, summary and
+// tags are stored with the routes.
+func (cl *client) RegisterOpenAPI(ctx context.Context, doc []byte, metadata bool) (*model.RouteDiff, error) {
+	query := neturl.Values{}
+	if metadata {
+		query.Set("metadata", "true")
+	}
+
+	return cl.retry(ctx, "/openapi", "application/yaml", doc, query)
+}
+
+// retry sends the registration until it succeeds, fails for good or the
+// retries are used up, doubling the backoff after each attempt.
+func (cl *client) retry(ctx context.Context, endpoint, contentType string, body []byte, query neturl.Values) (*model.RouteDiff, error) {
+	backoff := cl.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		diff, retry, err := cl.register(ctx, endpoint, contentType, body, query)
+		if err == nil {
+			return diff, nil
+		}
+		if !retry || attempt >= cl.cfg.MaxRetries {
+			return nil, err
+		}
+
+		log.Printf("registering routes of %s failed (attempt %d): %v", cl.cfg.Service, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// ReportDecisions sends decisions an enforcer embedded in the service made to
+// the decision log. Decisions the enforcer sampled carry their sample rate,
+// the others are sampled by the RBAC service.
+func (cl *client) ReportDecisions(ctx context.Context, decisions []model.DecisionLog) error {
+	body, err := json.Marshal(decisions)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/decisions/%s", cl.cfg.BaseURL, cl.cfg.Service)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	cl.sign(req, body)
+
+	res, err := cl.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("reporting decisions failed with status %d: %s", res.StatusCode, msg)
+	}
+	return nil
+}
+
+// Start registers the routes and, with Heartbeat set, keeps re-registering
+// them in the background until the context is done.
+func (cl *client) Start(ctx context.Context, engine *gin.Engine) error {
+	if _, err := cl.Register(ctx, engine); err != nil {
+		return err
+	}
+
+	if cl.cfg.Heartbeat <= 0 {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(cl.cfg.Heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := cl.Register(ctx, engine); err != nil {
+					log.Printf("re-registering routes of %s failed: %v", cl.cfg.Service, err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// register sends a single registration and reports whether a failure is worth
+// retrying.
+func (cl *client) register(ctx context.Context, endpoint, contentType string, body []byte, query neturl.Values) (*model.RouteDiff, bool, error) {
+	url := fmt.Sprintf("%s/api/v1/routes/%s%s", cl.cfg.BaseURL, cl.cfg.Service, endpoint)
+
+	if cl.cfg.DryRun {
+		query.Set("dry_run", "true")
+	}
+	if cl.cfg.Instance != "" {
+		query.Set("instance", cl.cfg.Instance)
+	}
+	if cl.cfg.Version != "" {
+		query.Set("version", cl.cfg.Version)
+	}
+	if len(query) > 0 {
+		url += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	cl.sign(req, body)
+
+	res, err := cl.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+		return nil, false, nil
+	case res.StatusCode == http.StatusOK:
+		var payload struct {
+			Diff *model.RouteDiff `json:"diff"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+			return nil, false, err
+		}
+		return payload.Diff, false, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		retry := res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("registration failed with status %d: %s", res.StatusCode, msg)
+	}
+}
+
+// sign signs the request as the service when a secret is configured.
+func (cl *client) sign(req *http.Request, body []byte) {
+	if cl.cfg.Secret == "" {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(signature.TimestampHeader, timestamp)
+	req.Header.Set(signature.SignatureHeader, signature.Sign(cl.cfg.Secret, cl.cfg.Service, timestamp, body))
+}
@@ -0,0 +1,194 @@
+// Package decisionlog writes authorization decisions to sinks, such as a
+// rotating file or a database table, keeping every deny and a sample of
+// allows and redacting what must not be stored.
+package decisionlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math/rand/v2"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	Allow = "allow"
+	Deny  = "deny"
+
+	// Redacted replaces redacted values.
+	Redacted = "[redacted]"
+
+	bufferSize = 1024
+
+	// queueWait bounds how long denies and decisions to keep wait for room
+	// in a full buffer, so a stuck sink can't block decisions.
+	queueWait = 100 * time.Millisecond
+)
+
+// Redactable fields.
+const (
+	FieldSubject = "subject"
+	FieldRoles   = "roles"
+	FieldHost    = "host"
+	FieldPath    = "path"
+)
+
+// Sink stores decisions.
+type Sink interface {
+	Add(*model.DecisionLog) error
+}
+
+// Config sets which decisions are logged and what is redacted. Sample rates
+// range from 0, nothing, to 1, every decision. Redacted subjects are replaced
+// by a hash so decisions of the same subject can still be told apart, other
+// fields by Redacted. Path patterns replace the parts of paths they match,
+// e.g. e-mail addresses or tokens. Spill, e.g. the file sink, takes the
+// denies and decisions to keep that found no room in the buffer.
+type Config struct {
+	SampleAllow float64
+	SampleDeny  float64
+	Redact      []string
+	RedactPaths []*regexp.Regexp
+	Spill       Sink
+}
+
+type Logger interface {
+	Log(*model.DecisionLog)
+	// Dropped returns the number of decisions dropped so far.
+	Dropped() uint64
+}
+
+type logger struct {
+	cfg     Config
+	sinks   []Sink
+	entries chan *model.DecisionLog
+	dropped atomic.Uint64
+}
+
+// New starts a logger writing to the sinks in the background, so logging
+// does not slow down decisions. When the sinks fall behind allows are
+// dropped, denies wait for room a short while and are then written to the
+// spill sink, or dropped without one.
+func New(cfg Config, sinks ...Sink) Logger {
+	l := &logger{
+		cfg:     cfg,
+		sinks:   sinks,
+		entries: make(chan *model.DecisionLog, bufferSize),
+	}
+	go l.write()
+	return l
+}
+
+// Log samples, redacts and queues the decision. Decisions reported with a
+// sample rate were sampled by the enforcer already. Decisions to keep are
+// logged whatever the sample rate. Denies and decisions to keep wait for room
+// in a full buffer up to queueWait.
+func (l *logger) Log(entry *model.DecisionLog) {
+	if len(l.sinks) == 0 {
+		return
+	}
+
+	if entry.Keep {
+		entry.SampleRate = 1
+	} else if entry.SampleRate <= 0 {
+		entry.SampleRate = l.cfg.SampleAllow
+		if entry.Effect != Allow {
+			entry.SampleRate = l.cfg.SampleDeny
+		}
+		if entry.SampleRate <= 0 || rand.Float64() >= entry.SampleRate {
+			return
+		}
+	}
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	l.redact(entry)
+
+	if entry.Keep || entry.Effect != Allow {
+		l.queue(entry)
+		return
+	}
+
+	select {
+	case l.entries <- entry:
+	default:
+		l.drop(entry)
+	}
+}
+
+func (l *logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// queue waits up to queueWait for room in the buffer, then writes the
+// decision to the spill sink instead.
+func (l *logger) queue(entry *model.DecisionLog) {
+	timer := time.NewTimer(queueWait)
+	defer timer.Stop()
+
+	select {
+	case l.entries <- entry:
+		return
+	case <-timer.C:
+	}
+
+	if l.cfg.Spill == nil {
+		l.drop(entry)
+		return
+	}
+	if err := l.cfg.Spill.Add(entry); err != nil {
+		log.Printf("failed to spill decision %s: %v", entry.ID, err)
+		l.drop(entry)
+	}
+}
+
+func (l *logger) drop(entry *model.DecisionLog) {
+	n := l.dropped.Add(1)
+	log.Printf("decision log buffer full, dropping decision %s, %d dropped so far", entry.ID, n)
+}
+
+func (l *logger) write() {
+	for entry := range l.entries {
+		for _, sink := range l.sinks {
+			if err := sink.Add(entry); err != nil {
+				log.Printf("failed to log decision %s: %v", entry.ID, err)
+			}
+		}
+	}
+}
+
+func (l *logger) redact(entry *model.DecisionLog) {
+	for _, field := range l.cfg.Redact {
+		switch field {
+		case FieldSubject:
+			if entry.Subject != "" {
+				sum := sha256.Sum256([]byte(entry.Subject))
+				entry.Subject = "sha256:" + hex.EncodeToString(sum[:8])
+			}
+		case FieldRoles:
+			if len(entry.Roles) > 0 {
+				entry.Roles = []string{Redacted}
+			}
+			entry.RoleIDs = nil
+		case FieldHost:
+			if entry.Host != "" {
+				entry.Host = Redacted
+			}
+		case FieldPath:
+			entry.Path = Redacted
+		}
+	}
+
+	for _, pattern := range l.cfg.RedactPaths {
+		entry.Path = pattern.ReplaceAllString(entry.Path, Redacted)
+	}
+}
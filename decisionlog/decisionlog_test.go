@@ -0,0 +1,184 @@
+package decisionlog
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+// chanSink hands the decisions written by the logger to the test.
+type chanSink chan *model.DecisionLog
+
+func (s chanSink) Add(entry *model.DecisionLog) error {
+	s <- entry
+	return nil
+}
+
+func (s chanSink) next(t *testing.T) *model.DecisionLog {
+	t.Helper()
+
+	select {
+	case entry := <-s:
+		return entry
+	case <-time.After(time.Second):
+		t.Fatal("no decision was written")
+		return nil
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	sink := make(chanSink, 10)
+	l := New(Config{SampleAllow: 0, SampleDeny: 1}, sink)
+
+	// Writes happen in order, so a decision written after a skipped one
+	// shows that the skipped one was not queued.
+	l.Log(&model.DecisionLog{Effect: Allow, Path: "/skipped"})
+	l.Log(&model.DecisionLog{Effect: Deny, Path: "/denied"})
+	l.Log(&model.DecisionLog{Effect: Allow, Path: "/sampled", SampleRate: 0.5})
+
+	deny := sink.next(t)
+	if deny.Path != "/denied" || deny.SampleRate != 1 || deny.ID == uuid.Nil || deny.Time.IsZero() {
+		t.Errorf("got %+v, want the deny with rate 1, an ID and a time", deny)
+	}
+	if sampled := sink.next(t); sampled.Path != "/sampled" || sampled.SampleRate != 0.5 {
+		t.Errorf("got %+v, want the allow sampled by the enforcer", sampled)
+	}
+}
+
+func TestLogKeep(t *testing.T) {
+	sink := make(chanSink, 10)
+	l := New(Config{SampleAllow: 0, SampleDeny: 0}, sink)
+
+	l.Log(&model.DecisionLog{Effect: Allow, Path: "/kept", SampleRate: 0.1, Keep: true})
+	if kept := sink.next(t); kept.Path != "/kept" || kept.SampleRate != 1 {
+		t.Errorf("got %+v, want the decision to keep with rate 1", kept)
+	}
+}
+
+func TestLogWithoutSinks(t *testing.T) {
+	l := New(Config{SampleAllow: 1, SampleDeny: 1})
+	entry := &model.DecisionLog{Effect: Deny, Subject: "alice"}
+	l.Log(entry)
+	if entry.SampleRate != 0 {
+		t.Errorf("decision was logged without sinks")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		entry model.DecisionLog
+		want  model.DecisionLog
+	}{
+		{
+			name:  "nothing",
+			entry: model.DecisionLog{Subject: "alice", Roles: []string{"admin"}, Host: "example.com", Path: "/users/42"},
+			want:  model.DecisionLog{Subject: "alice", Roles: []string{"admin"}, Host: "example.com", Path: "/users/42"},
+		},
+		{
+			name:  "fields",
+			cfg:   Config{Redact: []string{FieldSubject, FieldRoles, FieldHost, FieldPath}},
+			entry: model.DecisionLog{Subject: "alice", Roles: []string{"admin", "user"}, Host: "example.com", Path: "/users/42"},
+			want:  model.DecisionLog{Subject: "sha256:2bd806c97f0e00af", Roles: []string{Redacted}, Host: Redacted, Path: Redacted},
+		},
+		{
+			name:  "empty fields",
+			cfg:   Config{Redact: []string{FieldSubject, FieldRoles, FieldHost}},
+			entry: model.DecisionLog{Path: "/health"},
+			want:  model.DecisionLog{Path: "/health"},
+		},
+		{
+			name:  "path patterns",
+			cfg:   Config{RedactPaths: []*regexp.Regexp{regexp.MustCompile(`[^/@]+@[^/]+`), regexp.MustCompile(`tok_[a-z0-9]+`)}},
+			entry: model.DecisionLog{Path: "/users/alice@example.com/tokens/tok_abc123"},
+			want:  model.DecisionLog{Path: "/users/" + Redacted + "/tokens/" + Redacted},
+		},
+	}
+
+	for _, tt := range tests {
+		l := &logger{cfg: tt.cfg}
+		entry := tt.entry
+		l.redact(&entry)
+
+		if entry.Subject != tt.want.Subject || !equalRoles(entry.Roles, tt.want.Roles) || entry.Host != tt.want.Host || entry.Path != tt.want.Path {
+			t.Errorf("%s: got %q %q %q %q, want %q %q %q %q", tt.name, entry.Subject, entry.Roles, entry.Host, entry.Path, tt.want.Subject, tt.want.Roles, tt.want.Host, tt.want.Path)
+		}
+	}
+}
+
+func TestRedactSubjectsApart(t *testing.T) {
+	l := &logger{cfg: Config{Redact: []string{FieldSubject}}}
+	alice, bob, again := &model.DecisionLog{Subject: "alice"}, &model.DecisionLog{Subject: "bob"}, &model.DecisionLog{Subject: "alice"}
+	for _, entry := range []*model.DecisionLog{alice, bob, again} {
+		l.redact(entry)
+	}
+	if alice.Subject != again.Subject || alice.Subject == bob.Subject {
+		t.Errorf("redacted subjects %q, %q and %q do not tell subjects apart", alice.Subject, bob.Subject, again.Subject)
+	}
+}
+
+func equalRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stuckSink signals the first write and blocks every write until released.
+type stuckSink struct {
+	written chan struct{}
+	release chan struct{}
+}
+
+func (s stuckSink) Add(*model.DecisionLog) error {
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return nil
+}
+
+func TestLogFullBuffer(t *testing.T) {
+	stuck := stuckSink{written: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(stuck.release)
+	spill := make(chanSink, 1)
+	l := New(Config{SampleAllow: 1, SampleDeny: 1, Spill: spill}, stuck)
+
+	// The writer hangs on the first decision, the rest fills the buffer.
+	l.Log(&model.DecisionLog{Effect: Allow})
+	<-stuck.written
+	for i := 0; i < bufferSize; i++ {
+		l.Log(&model.DecisionLog{Effect: Allow})
+	}
+	l.Log(&model.DecisionLog{Effect: Allow, Path: "/dropped"})
+	if got := l.Dropped(); got != 1 {
+		t.Errorf("got %d dropped decisions, want the allow", got)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.Log(&model.DecisionLog{Effect: Deny, Path: "/spilled"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deny blocked on a full buffer")
+	}
+	if spilled := spill.next(t); spilled.Path != "/spilled" {
+		t.Errorf("got %+v, want the deny", spilled)
+	}
+	if got := l.Dropped(); got != 1 {
+		t.Errorf("got %d dropped decisions, want the spilled deny not counted", got)
+	}
+}
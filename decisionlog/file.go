@@ -0,0 +1,104 @@
+package decisionlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+type file struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+// NewFile returns a sink appending decisions as JSON lines to the file at
+// path. Once the file would grow beyond maxSize bytes it is rotated to
+// path.1, path.1 to path.2 and so on, keeping the given number of backups.
+func NewFile(path string, maxSize int64, backups int) (Sink, error) {
+	s := &file{path: path, maxSize: maxSize, backups: backups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *file) Add(entry *model.DecisionLog) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			log.Printf("failed to rotate decision log %s: %v", s.path, err)
+		}
+	}
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *file) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+// rotate moves the file aside and opens a new one. When it cannot, the
+// original file is opened again so decisions keep being appended to it.
+func (s *file) rotate() error {
+	err := s.f.Close()
+	s.f = nil
+	if err == nil {
+		err = s.shift()
+	}
+
+	if openErr := s.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+func (s *file) shift() error {
+	if s.backups <= 0 {
+		return os.Remove(s.path)
+	}
+
+	for i := s.backups - 1; i >= 1; i-- {
+		os.Rename(backupName(s.path, i), backupName(s.path, i+1))
+	}
+	return os.Rename(s.path, backupName(s.path, 1))
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
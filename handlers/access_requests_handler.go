@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	model "github.com/demkowo/rbac/models"
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *rbac) AddAccessRequest(c *gin.Context) {
+	var req struct {
+		RoleID   string `json:"role_id"`
+		RouteID  string `json:"route_id"`
+		Reason   string `json:"reason"`
+		Duration string `json:"duration"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	ar := &model.AccessRequest{Reason: req.Reason, Duration: req.Duration}
+
+	if ar.RoleID, e = parseUUID(c, "role_id", req.RoleID); e != nil {
+		return
+	}
+
+	if req.RouteID != "" {
+		routeID, err := parseUUID(c, "route_id", req.RouteID)
+		if err != nil {
+			return
+		}
+		ar.RouteID = &routeID
+	}
+
+	if err := h.as(c).AddAccessRequest(ar); err != nil {
+		accessError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"access_request": ar})
+}
+
+// ApproveAccessRequest grants the requested access. A duration in the body
+// replaces the one requested.
+func (h *rbac) ApproveAccessRequest(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Comment  string `json:"comment"`
+		Duration string `json:"duration"`
+	}
+	if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+		return
+	}
+
+	ar, err := h.as(c).ApproveAccessRequest(id, req.Comment, req.Duration)
+	if err != nil {
+		accessError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_request": ar})
+}
+
+func (h *rbac) FindAccessRequest(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	ar, err := h.service.FindAccessRequest(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_request": ar})
+}
+
+func (h *rbac) FindAccessRequests(c *gin.Context) {
+	filter := model.AccessRequestFilter{
+		Requester: c.Query("requester"),
+		Status:    c.Query("status"),
+	}
+
+	if value := c.Query("role_id"); value != "" {
+		if filter.RoleID, e = parseUUID(c, "role_id", value); e != nil {
+			return
+		}
+	}
+
+	requests, err := h.service.FindAccessRequests(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_requests": requests})
+}
+
+func (h *rbac) FindApprovers(c *gin.Context) {
+	roleID, err := parseUUID(c, "role_id", c.Param("role_id"))
+	if err != nil {
+		return
+	}
+
+	approvers, err := h.service.FindApprovers(roleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if approvers == nil {
+		approvers = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"approvers": approvers})
+}
+
+func (h *rbac) RejectAccessRequest(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+		return
+	}
+
+	ar, err := h.as(c).RejectAccessRequest(id, req.Comment)
+	if err != nil {
+		accessError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_request": ar})
+}
+
+func (h *rbac) SetApprovers(c *gin.Context) {
+	roleID, err := parseUUID(c, "role_id", c.Param("role_id"))
+	if err != nil {
+		return
+	}
+
+	var approvers []string
+	if !bindJSON(c, &approvers) {
+		return
+	}
+
+	if err := h.as(c).SetApprovers(roleID, approvers); err != nil {
+		accessError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "approvers set successfully"})
+}
+
+func accessError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidChange):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrSelfApproval), errors.Is(err, service.ErrNotApprover), errors.Is(err, service.ErrNotAdmin):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrAccessRequestStatus), errors.Is(err, service.ErrAlreadyGranted):
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
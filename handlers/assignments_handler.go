@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *rbac) AddAssignment(c *gin.Context) {
+	var req struct {
+		Subject   string     `json:"subject"`
+		RoleID    string     `json:"role_id"`
+		Reason    string     `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	a := &model.RoleAssignment{Subject: req.Subject, Reason: req.Reason, ExpiresAt: req.ExpiresAt}
+
+	if a.RoleID, e = parseUUID(c, "role_id", req.RoleID); e != nil {
+		return
+	}
+
+	if err := h.as(c).AddAssignment(a); err != nil {
+		accessError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"assignment": a})
+}
+
+func (h *rbac) DeleteAssignment(c *gin.Context) {
+	var req struct {
+		Subject string `json:"subject"`
+		RoleID  string `json:"role_id"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	roleID, err := parseUUID(c, "role_id", req.RoleID)
+	if err != nil {
+		return
+	}
+
+	if err := h.as(c).DeleteAssignment(req.Subject, roleID); err != nil {
+		accessError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "assignment deleted successfully"})
+}
+
+func (h *rbac) FindAssignments(c *gin.Context) {
+	assignments, err := h.service.FindAssignments(c.Query("subject"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"assignments": assignments})
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+)
+
+// actorClaims are the claims naming the caller, in order of preference.
+var actorClaims = []string{"sub", "email", "username", "name"}
+
+func (h *rbac) FindAudit(c *gin.Context) {
+	filter := model.AuditFilter{
+		Actor:    c.Query("actor"),
+		Entity:   c.Query("entity"),
+		EntityID: c.Query("entity_id"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	entries, err := h.service.FindAudit(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+func (h *rbac) VerifyAudit(c *gin.Context) {
+	verification, err := h.service.VerifyAudit()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verification": verification})
+}
+
+// as returns the service acting on behalf of the caller of the request.
+func (h *rbac) as(c *gin.Context) service.Rbac {
+	return h.service.As(actor(c, ""))
+}
+
+// actor identifies the caller by the JWT claims, or as the service when the
+// request is a registration authenticated by signature or certificate.
+func actor(c *gin.Context, svc string) model.Actor {
+	a := model.Actor{
+		Name:      service.AnonymousActor,
+		IP:        c.ClientIP(),
+		RequestID: c.GetString(requestIDHeader),
+	}
+	if a.RequestID == "" {
+		a.RequestID = c.GetHeader(requestIDHeader)
+	}
+
+	if svc != "" {
+		a.Name = "service:" + svc
+		return a
+	}
+
+	claims, err := tokenClaims(c)
+	if err != nil {
+		return a
+	}
+	for _, claim := range actorClaims {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			a.Name = name
+			break
+		}
+	}
+	a.Roles = tokenRoles(claims)
+	return a
+}
+
+func parseTimeQuery(c *gin.Context, field string) (time.Time, error) {
+	value := c.Query(field)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + field + ", expected RFC 3339"})
+		return time.Time{}, err
+	}
+	return t, nil
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	model "github.com/demkowo/rbac/models"
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *rbac) Authorize(c *gin.Context) {
+	var req model.AuthorizeRequest
+
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	decision, err := h.as(c).Authorize(req)
+	if errors.Is(err, service.ErrInvalidRoute) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"decision": decision})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *rbac) EndBreakGlass(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	b, err := h.as(c).EndBreakGlass(id)
+	if err != nil {
+		breakGlassError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"break_glass": b})
+}
+
+func (h *rbac) FindBreakGlass(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	b, err := h.service.FindBreakGlass(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"break_glass": b})
+}
+
+func (h *rbac) FindBreakGlasses(c *gin.Context) {
+	active, err := parseBoolQuery(c, "active")
+	if err != nil {
+		return
+	}
+
+	breakGlasses, err := h.service.FindBreakGlasses(active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"break_glass": breakGlasses})
+}
+
+// FindBreakGlassReport lists what was done while the break-glass access was
+// active.
+func (h *rbac) FindBreakGlassReport(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	report, err := h.service.FindBreakGlassReport(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// StartBreakGlass grants the break-glass role to the caller.
+func (h *rbac) StartBreakGlass(c *gin.Context) {
+	var req struct {
+		Justification string `json:"justification"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	b, err := h.as(c).StartBreakGlass(req.Justification)
+	if err != nil {
+		if errors.Is(err, service.ErrBreakGlassActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "break_glass": b})
+			return
+		}
+		breakGlassError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"break_glass": b})
+}
+
+func breakGlassError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidChange):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrBreakGlassDisabled), errors.Is(err, service.ErrNotEligible), errors.Is(err, service.ErrNotAdmin):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrBreakGlassEnded), errors.Is(err, service.ErrAlreadyGranted):
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
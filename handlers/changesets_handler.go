@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	model "github.com/demkowo/rbac/models"
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (h *rbac) AddChangeOperations(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	var ops []model.ChangeOperation
+	if !bindJSON(c, &ops) {
+		return
+	}
+
+	cs, err := h.as(c).AddChangeOperations(id, ops)
+	if err != nil {
+		changeSetError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_set": cs})
+}
+
+func (h *rbac) AddChangeSet(c *gin.Context) {
+	var req struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	cs := &model.ChangeSet{Title: req.Title, Description: req.Description}
+	if err := h.as(c).AddChangeSet(cs); err != nil {
+		changeSetError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"change_set": cs})
+}
+
+func (h *rbac) ApproveChangeSet(c *gin.Context) {
+	h.changeSetAction(c, h.as(c).ApproveChangeSet)
+}
+
+func (h *rbac) DeleteChangeOperation(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid value: index"})
+		return
+	}
+
+	cs, err := h.as(c).DeleteChangeOperation(id, index)
+	if err != nil {
+		changeSetError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_set": cs})
+}
+
+func (h *rbac) DiscardChangeSet(c *gin.Context) {
+	h.changeSetAction(c, h.as(c).DiscardChangeSet)
+}
+
+func (h *rbac) FindChangeSet(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	cs, err := h.service.FindChangeSet(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_set": cs})
+}
+
+func (h *rbac) FindChangeSets(c *gin.Context) {
+	changeSets, err := h.service.FindChangeSets(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_sets": changeSets})
+}
+
+func (h *rbac) PreviewChangeSet(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	preview, err := h.service.PreviewChangeSet(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preview": preview})
+}
+
+// PublishChangeSet answers 409 Conflict with the conflicts when the live
+// policy drifted from what the change set was staged against.
+func (h *rbac) PublishChangeSet(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	cs, conflicts, err := h.as(c).PublishChangeSet(id)
+	if err != nil {
+		changeSetError(c, err, conflicts)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_set": cs})
+}
+
+func (h *rbac) changeSetAction(c *gin.Context, action func(uuid.UUID) (*model.ChangeSet, error)) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	cs, err := action(id)
+	if err != nil {
+		changeSetError(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change_set": cs})
+}
+
+func changeSetError(c *gin.Context, err error, conflicts []model.ChangeConflict) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidChange):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrSelfApproval):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrChangeSetStatus), errors.Is(err, service.ErrChangeSetChanged):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrChangeSetConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "conflicts": conflicts})
+		return
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenClaims returns the claims of the bearer token of the request. The
+// token is verified by auth.AuthMiddleware in front of the handlers, here the
+// payload is only decoded.
+func tokenClaims(c *gin.Context) (map[string]any, error) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return nil, errors.New("missing bearer token")
+	}
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	return claims, nil
+}
+
+// tokenRoles reads the role names from the "roles" claim, a list or a comma
+// separated string, or from the "role" claim.
+func tokenRoles(claims map[string]any) []string {
+	var roles []string
+
+	switch v := claims["roles"].(type) {
+	case []any:
+		for _, role := range v {
+			if name, ok := role.(string); ok && name != "" {
+				roles = append(roles, name)
+			}
+		}
+	case string:
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				roles = append(roles, name)
+			}
+		}
+	}
+
+	if role, ok := claims["role"].(string); ok && role != "" {
+		roles = append(roles, role)
+	}
+
+	return roles
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AddDecisions takes decisions enforcers embedded in the service made on
+// their own.
+func (h *rbac) AddDecisions(c *gin.Context) {
+	var decisions []model.DecisionLog
+
+	if !bindJSON(c, &decisions) {
+		return
+	}
+
+	if err := h.service.RecordDecisions(c.Param("service"), decisions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "decisions recorded"})
+}
+
+func (h *rbac) FindDecisions(c *gin.Context) {
+	filter := model.DecisionFilter{
+		Subject: c.Query("subject"),
+		Role:    c.Query("role"),
+		Service: c.Query("service"),
+		Effect:  c.Query("effect"),
+	}
+
+	var err error
+	if routeID := c.Query("route_id"); routeID != "" {
+		if filter.RouteID, err = parseUUID(c, "route_id", routeID); err != nil {
+			return
+		}
+	}
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	decisions, err := h.service.FindDecisions(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"decisions": decisions})
+}
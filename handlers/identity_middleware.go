@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"crypto/x509"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyClientIdentity allows requests to /:service endpoints only when the
+// verified client certificate carries one of the identities mapped to that
+// service, either as the subject common name or as a DNS, URI or email SAN.
+func VerifyClientIdentity(identities map[string][]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		svc := c.Param("service")
+
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "client certificate required"})
+			return
+		}
+
+		cert := c.Request.TLS.VerifiedChains[0][0]
+		for _, allowed := range identities[svc] {
+			for _, name := range certificateNames(cert) {
+				if name == allowed {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		log.Printf("certificate %q is not allowed to act as service %s", cert.Subject.String(), svc)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "certificate does not match service"})
+	}
+}
+
+func certificateNames(cert *x509.Certificate) []string {
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
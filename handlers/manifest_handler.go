@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FindManifest returns the manifest of the roles in the caller's token. The
+// ETag is a hash of the manifest, so clients revalidate with If-None-Match
+// and only download it again after the grants of their roles change.
+func (h *rbac) FindManifest(c *gin.Context) {
+	claims, err := tokenClaims(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	manifest, err := h.service.FindManifest(actor(c, "").Name, tokenRoles(claims))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := json.Marshal(gin.H{"manifest": manifest})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode manifest"})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	tag := etag(hex.EncodeToString(sum[:]))
+	c.Header("ETag", tag)
+	c.Header("Cache-Control", "private, no-cache")
+	if etagMatches(c, tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
@@ -1,11 +1,18 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	client "github.com/demkowo/rbac/client"
 	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/openapi"
+	"github.com/demkowo/rbac/routepath"
 	service "github.com/demkowo/rbac/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,9 +23,71 @@ var (
 )
 
 type Rbac interface {
+	Authorize(*gin.Context)
+	FindAudit(*gin.Context)
+	VerifyAudit(*gin.Context)
+
+	AddDecisions(*gin.Context)
+	FindDecisions(*gin.Context)
+	FindManifest(*gin.Context)
+
 	AddRbac(*gin.Context)
 	DeleteRbac(*gin.Context)
 	FindRbac(*gin.Context)
+	FindUnusedRbac(*gin.Context)
+	PruneUnusedRbac(*gin.Context)
+
+	AddResource(*gin.Context)
+	DeleteResource(*gin.Context)
+	FindResource(*gin.Context)
+	FindResources(*gin.Context)
+	FindResourcesByRole(*gin.Context)
+	FindRolesByResource(*gin.Context)
+	GrantPermission(*gin.Context)
+	RevokePermission(*gin.Context)
+	UpdateResource(*gin.Context)
+
+	AddAccessRequest(*gin.Context)
+	ApproveAccessRequest(*gin.Context)
+	FindAccessRequest(*gin.Context)
+	FindAccessRequests(*gin.Context)
+	FindApprovers(*gin.Context)
+	RejectAccessRequest(*gin.Context)
+	SetApprovers(*gin.Context)
+
+	AddAssignment(*gin.Context)
+	DeleteAssignment(*gin.Context)
+	FindAssignments(*gin.Context)
+
+	CloseReview(*gin.Context)
+	DecideReview(*gin.Context)
+	FindReview(*gin.Context)
+	FindReviewEvidence(*gin.Context)
+	FindReviewItems(*gin.Context)
+	FindReviews(*gin.Context)
+	ReassignReview(*gin.Context)
+	StartReview(*gin.Context)
+
+	EndBreakGlass(*gin.Context)
+	FindBreakGlass(*gin.Context)
+	FindBreakGlasses(*gin.Context)
+	FindBreakGlassReport(*gin.Context)
+	StartBreakGlass(*gin.Context)
+
+	AddChangeOperations(*gin.Context)
+	AddChangeSet(*gin.Context)
+	ApproveChangeSet(*gin.Context)
+	DeleteChangeOperation(*gin.Context)
+	DiscardChangeSet(*gin.Context)
+	FindChangeSet(*gin.Context)
+	FindChangeSets(*gin.Context)
+	PreviewChangeSet(*gin.Context)
+	PublishChangeSet(*gin.Context)
+
+	DiffRevisions(*gin.Context)
+	FindRevision(*gin.Context)
+	FindRevisions(*gin.Context)
+	RollbackRevision(*gin.Context)
 
 	AddRole(*gin.Context)
 	DeleteRole(*gin.Context)
@@ -29,11 +98,27 @@ type Rbac interface {
 
 	AddRoute(*gin.Context)
 	AddExternalRoutes(*gin.Context)
+	AddOpenAPIRoutes(*gin.Context)
 	DeleteRoute(*gin.Context)
 	FindRoutes(*gin.Context)
 	FindRoutesByRole(*gin.Context)
 	MarkActiveRoutes(*gin.Engine) ([]model.Route, error)
+	MarkActiveRoutesAs(*gin.Context, *gin.Engine) ([]model.Route, error)
+	RenameRoute(*gin.Context)
 	UpdateRoute(*gin.Context)
+
+	FindRouteConflicts(*gin.Context)
+	FindServiceFingerprint(*gin.Context)
+	FindServiceRoutes(*gin.Context)
+	FindServices(*gin.Context)
+	Heartbeat(*gin.Context)
+	RetireServiceVersion(*gin.Context)
+
+	AddRule(*gin.Context)
+	DeleteRule(*gin.Context)
+	FindRules(*gin.Context)
+	PreviewDraftRule(*gin.Context)
+	PreviewRule(*gin.Context)
 }
 
 type rbac struct {
@@ -66,7 +151,7 @@ func (h *rbac) AddRbac(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.AddRbac(rbac); err != nil {
+	if err := h.as(c).AddRbac(rbac); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -94,7 +179,7 @@ func (h *rbac) DeleteRbac(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteRbac(rbac); err != nil {
+	if err := h.as(c).DeleteRbac(rbac); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -126,7 +211,7 @@ func (h *rbac) AddRole(c *gin.Context) {
 		Name: req.Name,
 	}
 
-	if err := h.service.AddRole(role); err != nil {
+	if err := h.as(c).AddRole(role); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -140,7 +225,7 @@ func (h *rbac) AddRole(c *gin.Context) {
 }
 
 func (h *rbac) DeleteRole(c *gin.Context) {
-	if err := h.service.DeleteRole(c.Param("role_id")); err != nil {
+	if err := h.as(c).DeleteRole(c.Param("role_id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -200,7 +285,7 @@ func (h *rbac) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateRole(role); err != nil {
+	if err := h.as(c).UpdateRole(role); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -211,6 +296,7 @@ func (h *rbac) UpdateRole(c *gin.Context) {
 func (h *rbac) AddRoute(c *gin.Context) {
 	var req struct {
 		Method  string   `json:"method"`
+		Host    string   `json:"host"`
 		Path    string   `json:"path"`
 		Service string   `json:"service"`
 		Active  bool     `json:"active"`
@@ -224,12 +310,13 @@ func (h *rbac) AddRoute(c *gin.Context) {
 	route := &model.Route{
 		ID:      uuid.New(),
 		Method:  req.Method,
+		Host:    req.Host,
 		Path:    req.Path,
 		Service: req.Service,
 		Active:  req.Active,
 	}
 
-	if err := h.service.AddRoute(route); err != nil {
+	if err := h.as(c).AddRoute(route); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"AddRoute failed": err.Error()})
 		return
 	}
@@ -241,7 +328,7 @@ func (h *rbac) AddRoute(c *gin.Context) {
 			log.Printf("invalid role ID: %s", roleIdStr)
 			continue
 		}
-		if err := h.service.AddRbac(&model.Rbac{
+		if err := h.as(c).AddRbac(&model.Rbac{
 			RouteID: route.ID,
 			RoleID:  roleId,
 		}); err != nil {
@@ -256,19 +343,70 @@ func (h *rbac) AddExternalRoutes(c *gin.Context) {
 	var routes []model.Route
 	svc := c.Param("service")
 
+	opts, err := parseRegisterOptions(c)
+	if err != nil {
+		return
+	}
+
 	if err := c.ShouldBindJSON(&routes); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	fmt.Printf("fetched %d routes\n%v", len(routes), routes)
-	if err := h.service.SetRoutesInactive(svc); err != nil {
-		log.Println("setting routes inactive failed", err)
+	log.Printf("fetched %d routes of service %s", len(routes), svc)
+
+	h.registerRoutes(c, svc, routes, opts)
+}
+
+// AddOpenAPIRoutes registers the operations of an OpenAPI 3 document, JSON or
+// YAML, as routes of the service.
+func (h *rbac) AddOpenAPIRoutes(c *gin.Context) {
+	svc := c.Param("service")
+
+	opts, err := parseRegisterOptions(c)
+	if err != nil {
+		return
+	}
+
+	metadata, err := parseBoolQuery(c, "metadata")
+	if err != nil {
+		return
+	}
+
+	doc, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	routes, err := openapi.Routes(svc, doc, metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("fetched %d routes of service %s from OpenAPI document", len(routes), svc)
+	opts.Syntax = routepath.Gin
+
+	h.registerRoutes(c, svc, routes, opts)
+}
+
+func (h *rbac) registerRoutes(c *gin.Context, svc string, routes []model.Route, opts model.RegisterOptions) {
+	diff, err := h.service.As(actor(c, svc)).RegisterRoutes(svc, routes, opts)
+	if errors.Is(err, service.ErrRoutesUnchanged) {
+		c.Header("ETag", etag(diff.Fingerprint))
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidRoute) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if err := h.service.AddActiveRoutes(routes); err != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"routes registered": routes})
+
+	c.Header("ETag", etag(diff.Fingerprint))
+	c.JSON(http.StatusOK, gin.H{"dry_run": opts.DryRun, "diff": diff})
 }
 
 func (h *rbac) DeleteRoute(c *gin.Context) {
@@ -277,7 +415,7 @@ func (h *rbac) DeleteRoute(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteRoute(routeID); err != nil {
+	if err := h.as(c).DeleteRoute(routeID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -310,30 +448,55 @@ func (h *rbac) FindRoutesByRole(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"routes": routes})
 }
 
+// MarkActiveRoutes registers the routes of the server itself on startup, the
+// changes are audited as made by the system.
 func (h *rbac) MarkActiveRoutes(router *gin.Engine) ([]model.Route, error) {
-	var routes []model.Route
+	return markActiveRoutes(h.service, router)
+}
 
-	for _, route := range router.Routes() {
-		r := model.Route{
-			ID:      uuid.New(),
-			Method:  route.Method,
-			Path:    route.Path,
-			Service: "rbac",
-			Active:  true,
-		}
+// MarkActiveRoutesAs registers the routes of the server itself on behalf of
+// the caller.
+func (h *rbac) MarkActiveRoutesAs(c *gin.Context, router *gin.Engine) ([]model.Route, error) {
+	return markActiveRoutes(h.as(c), router)
+}
 
-		routes = append(routes, r)
+func markActiveRoutes(svc service.Rbac, router *gin.Engine) ([]model.Route, error) {
+	diff, err := svc.RegisterRoutes(service.SelfService, client.Routes(service.SelfService, router), model.RegisterOptions{Force: true})
+	if err != nil {
+		log.Println("adding routes failed", err)
+		return nil, err
 	}
 
-	if err := h.service.SetRoutesInactive("rbac"); err != nil {
-		log.Println("setting routes inactive failed", err)
+	routes := append(diff.Added, diff.Reactivated...)
+	return append(routes, diff.Unchanged...), nil
+}
+
+func (h *rbac) RenameRoute(c *gin.Context) {
+	var req struct {
+		FromID string `json:"from_id"`
+		ToID   string `json:"to_id"`
 	}
 
-	if err := h.service.AddActiveRoutes(routes); err != nil {
-		log.Println("adding routes failed", err)
-		return nil, err
+	if !bindJSON(c, &req) {
+		return
 	}
-	return routes, nil
+
+	fromID, err := parseUUID(c, "from_id", req.FromID)
+	if err != nil {
+		return
+	}
+
+	toID, err := parseUUID(c, "to_id", req.ToID)
+	if err != nil {
+		return
+	}
+
+	if err := h.as(c).RenameRoute(fromID, toID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "route bindings migrated successfully"})
 }
 
 func (h *rbac) UpdateRoute(c *gin.Context) {
@@ -347,7 +510,7 @@ func (h *rbac) UpdateRoute(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateRoute(&route); err != nil {
+	if err := h.as(c).UpdateRoute(&route); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -355,6 +518,27 @@ func (h *rbac) UpdateRoute(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"route": route})
 }
 
+func (h *rbac) FindServiceFingerprint(c *gin.Context) {
+	version, err := h.service.FindServiceVersion(c.Param("service"), c.Query("version"))
+	if errors.Is(err, service.ErrVersionNotRegistered) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag := etag(version.Fingerprint)
+	c.Header("ETag", tag)
+	if etagMatches(c, tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": version})
+}
+
 func bindJSON(c *gin.Context, req interface{}) bool {
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("invalid JSON data: %s", err.Error())
@@ -373,3 +557,54 @@ func parseUUID(c *gin.Context, field, txt string) (uuid.UUID, error) {
 	}
 	return id, nil
 }
+
+func parseRegisterOptions(c *gin.Context) (model.RegisterOptions, error) {
+	var opts model.RegisterOptions
+
+	if opts.DryRun, e = parseBoolQuery(c, "dry_run"); e != nil {
+		return opts, e
+	}
+
+	if opts.Force, e = parseBoolQuery(c, "force"); e != nil {
+		return opts, e
+	}
+
+	if opts.AcceptRenames, e = parseBoolQuery(c, "accept_renames"); e != nil {
+		return opts, e
+	}
+	opts.Instance = c.Query("instance")
+	opts.Version = c.Query("version")
+
+	if opts.Syntax, e = routepath.ParseSyntax(c.Query("syntax")); e != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Error()})
+		return opts, e
+	}
+
+	return opts, nil
+}
+
+func parseBoolQuery(c *gin.Context, field string) (bool, error) {
+	v, err := strconv.ParseBool(c.DefaultQuery(field, "false"))
+	if err != nil {
+		log.Printf("failed to parse %s: %v", field, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid value: %s", field)})
+		return false, err
+	}
+	return v, nil
+}
+
+func etag(value string) string {
+	return `"` + value + `"`
+}
+
+// etagMatches tells whether If-None-Match lists the tag. Weak tags match
+// too, as the comparison for If-None-Match is weak.
+func etagMatches(c *gin.Context, tag string) bool {
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
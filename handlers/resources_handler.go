@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"net/http"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type resourceRequest struct {
+	Type        string   `json:"type"`
+	Name        string   `json:"name"`
+	Service     string   `json:"service"`
+	Description string   `json:"description"`
+	Actions     []string `json:"actions"`
+}
+
+type permissionRequest struct {
+	RoleID string `json:"role_id"`
+	Action string `json:"action"`
+}
+
+func (h *rbac) AddResource(c *gin.Context) {
+	var req resourceRequest
+
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	resource := &model.Resource{
+		ID:          uuid.New(),
+		Type:        req.Type,
+		Name:        req.Name,
+		Service:     req.Service,
+		Description: req.Description,
+		Actions:     req.Actions,
+	}
+
+	if err := h.as(c).AddResource(resource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"resource": resource})
+}
+
+func (h *rbac) DeleteResource(c *gin.Context) {
+	resourceID, err := parseUUID(c, "resource_id", c.Param("resource_id"))
+	if err != nil {
+		return
+	}
+
+	if err := h.as(c).DeleteResource(resourceID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted resource successfully"})
+}
+
+func (h *rbac) FindResource(c *gin.Context) {
+	resourceID, err := parseUUID(c, "resource_id", c.Param("resource_id"))
+	if err != nil {
+		return
+	}
+
+	resource, err := h.service.FindResource(resourceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resource": resource})
+}
+
+func (h *rbac) FindResources(c *gin.Context) {
+	resources, err := h.service.FindResources(c.Query("type"), c.Query("service"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resources": resources})
+}
+
+func (h *rbac) FindResourcesByRole(c *gin.Context) {
+	roleID, err := parseUUID(c, "role_id", c.Param("role_id"))
+	if err != nil {
+		return
+	}
+
+	resources, err := h.service.FindResourcesByRole(roleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resources": resources})
+}
+
+func (h *rbac) FindRolesByResource(c *gin.Context) {
+	resourceID, err := parseUUID(c, "resource_id", c.Param("resource_id"))
+	if err != nil {
+		return
+	}
+
+	roles, err := h.service.FindRolesByResource(resourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (h *rbac) UpdateResource(c *gin.Context) {
+	var req resourceRequest
+
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	resourceID, err := parseUUID(c, "resource_id", c.Param("resource_id"))
+	if err != nil {
+		return
+	}
+
+	resource := &model.Resource{
+		ID:          resourceID,
+		Type:        req.Type,
+		Name:        req.Name,
+		Service:     req.Service,
+		Description: req.Description,
+		Actions:     req.Actions,
+	}
+
+	if err := h.as(c).UpdateResource(resource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resource": resource})
+}
+
+func (h *rbac) GrantPermission(c *gin.Context) {
+	permission, ok := bindPermission(c)
+	if !ok {
+		return
+	}
+
+	if err := h.as(c).GrantPermission(permission); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"permission": permission})
+}
+
+func (h *rbac) RevokePermission(c *gin.Context) {
+	permission, ok := bindPermission(c)
+	if !ok {
+		return
+	}
+
+	if err := h.as(c).RevokePermission(permission); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "revoked permission successfully"})
+}
+
+func bindPermission(c *gin.Context) (*model.Permission, bool) {
+	var req permissionRequest
+
+	if !bindJSON(c, &req) {
+		return nil, false
+	}
+
+	resourceID, err := parseUUID(c, "resource_id", c.Param("resource_id"))
+	if err != nil {
+		return nil, false
+	}
+
+	roleID, err := parseUUID(c, "role_id", req.RoleID)
+	if err != nil {
+		return nil, false
+	}
+
+	return &model.Permission{ResourceID: resourceID, RoleID: roleID, Action: req.Action}, true
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+)
+
+// evidenceColumns are the columns of evidence exported as CSV.
+var evidenceColumns = []string{"campaign", "service", "method", "host", "path", "role", "reviewer", "decision", "comment",
+	"decided_by", "decided_at", "result"}
+
+// CloseReview closes the campaign, revokes the bindings reviewers revoked
+// and answers with the evidence.
+func (h *rbac) CloseReview(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	if !evidenceFormat(c) {
+		return
+	}
+
+	evidence, err := h.as(c).CloseReview(id)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	writeEvidence(c, evidence)
+}
+
+func (h *rbac) DecideReview(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	var decisions []model.ReviewDecision
+	if !bindJSON(c, &decisions) {
+		return
+	}
+
+	items, err := h.as(c).DecideReview(id, decisions)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func (h *rbac) FindReview(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	campaign, err := h.service.FindReview(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	reviewers, err := h.service.FindReviewProgress(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaign": campaign, "reviewers": reviewers})
+}
+
+// FindReviewEvidence exports the campaign as JSON or, with ?format=csv, as
+// CSV.
+func (h *rbac) FindReviewEvidence(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	if !evidenceFormat(c) {
+		return
+	}
+
+	evidence, err := h.service.FindReviewEvidence(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeEvidence(c, evidence)
+}
+
+func (h *rbac) FindReviewItems(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	filter := model.ReviewItemFilter{
+		Reviewer: c.Query("reviewer"),
+		Decision: c.Query("decision"),
+	}
+
+	items, err := h.service.FindReviewItems(id, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func (h *rbac) FindReviews(c *gin.Context) {
+	campaigns, err := h.service.FindReviews(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
+}
+
+// ReassignReview hands the pending items of a reviewer to another.
+func (h *rbac) ReassignReview(c *gin.Context) {
+	id, err := parseUUID(c, "id", c.Param("id"))
+	if err != nil {
+		return
+	}
+
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	n, err := h.as(c).ReassignReview(id, req.From, req.To)
+	if err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reassigned": n})
+}
+
+func (h *rbac) StartReview(c *gin.Context) {
+	var req struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		Service     string     `json:"service"`
+		RoleID      string     `json:"role_id"`
+		DueAt       *time.Time `json:"due_at"`
+		Reviewers   []string   `json:"reviewers"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	campaign := &model.ReviewCampaign{Name: req.Name, Description: req.Description, Service: req.Service, DueAt: req.DueAt}
+
+	if req.RoleID != "" {
+		roleID, err := parseUUID(c, "role_id", req.RoleID)
+		if err != nil {
+			return
+		}
+		campaign.RoleID = &roleID
+	}
+
+	if err := h.as(c).StartReview(campaign, req.Reviewers); err != nil {
+		reviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"campaign": campaign})
+}
+
+// writeEvidence answers with the evidence as a JSON or, with ?format=csv, a
+// CSV attachment. The format is checked by evidenceFormat.
+func writeEvidence(c *gin.Context, evidence *model.ReviewEvidence) {
+	name := "review-" + evidence.Campaign.ID.String()
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		c.JSON(http.StatusOK, gin.H{"evidence": evidence})
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write(evidenceColumns)
+		for _, item := range evidence.Items {
+			var decidedAt string
+			if item.DecidedAt != nil {
+				decidedAt = item.DecidedAt.Format(time.RFC3339)
+			}
+			row := []string{evidence.Campaign.Name, item.Service, item.Method, item.Host, item.Path, item.Role, item.Reviewer,
+				item.Decision, item.Comment, item.DecidedBy, decidedAt, item.Result}
+			for i := range row {
+				row[i] = csvCell(row[i])
+			}
+			w.Write(row)
+		}
+		w.Flush()
+
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
+
+// csvCell keeps spreadsheets from evaluating a cell as a formula by
+// prefixing cells starting with a formula character with a quote.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// evidenceFormat checks the format evidence is requested in.
+func evidenceFormat(c *gin.Context) bool {
+	switch c.DefaultQuery("format", "json") {
+	case "json", "csv":
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format, expected json or csv"})
+	return false
+}
+
+func reviewError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidChange):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrNotReviewer):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrReviewStatus):
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *rbac) DiffRevisions(c *gin.Context) {
+	from, err := parseRevision(c, "from", c.Query("from"))
+	if err != nil {
+		return
+	}
+
+	var to int64
+	if value := c.Query("to"); value != "" {
+		if to, err = parseRevision(c, "to", value); err != nil {
+			return
+		}
+	}
+
+	diff, err := h.service.DiffRevisions(from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"diff": diff})
+}
+
+func (h *rbac) FindRevision(c *gin.Context) {
+	revision, err := parseRevision(c, "revision", c.Param("revision"))
+	if err != nil {
+		return
+	}
+
+	rev, err := h.service.FindRevision(revision)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revision": rev})
+}
+
+func (h *rbac) FindRevisions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	revisions, err := h.service.FindRevisions(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+func (h *rbac) RollbackRevision(c *gin.Context) {
+	revision, err := parseRevision(c, "revision", c.Param("revision"))
+	if err != nil {
+		return
+	}
+
+	rev, err := h.as(c).RollbackRevision(revision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revision": rev})
+}
+
+func parseRevision(c *gin.Context, field, value string) (int64, error) {
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || revision <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid value: " + field})
+		if err == nil {
+			err = strconv.ErrRange
+		}
+		return 0, err
+	}
+	return revision, nil
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ruleRequest struct {
+	Name        string `json:"name"`
+	Service     string `json:"service"`
+	Method      string `json:"method"`
+	PathPattern string `json:"path_pattern"`
+	RoleID      string `json:"role_id"`
+}
+
+func (h *rbac) AddRule(c *gin.Context) {
+	rule, ok := bindRule(c)
+	if !ok {
+		return
+	}
+	rule.ID = uuid.New()
+
+	if err := h.as(c).AddRule(rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"rule": rule})
+}
+
+func (h *rbac) DeleteRule(c *gin.Context) {
+	ruleID, err := parseUUID(c, "rule_id", c.Param("rule_id"))
+	if err != nil {
+		return
+	}
+
+	if err := h.as(c).DeleteRule(ruleID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted rule successfully"})
+}
+
+func (h *rbac) FindRules(c *gin.Context) {
+	rules, err := h.service.FindRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *rbac) PreviewRule(c *gin.Context) {
+	ruleID, err := parseUUID(c, "rule_id", c.Param("rule_id"))
+	if err != nil {
+		return
+	}
+
+	rule, err := h.service.FindRule(ruleID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.previewRule(c, rule)
+}
+
+func (h *rbac) PreviewDraftRule(c *gin.Context) {
+	rule, ok := bindRule(c)
+	if !ok {
+		return
+	}
+
+	h.previewRule(c, rule)
+}
+
+func (h *rbac) previewRule(c *gin.Context, rule *model.BindingRule) {
+	res, err := h.service.PreviewRule(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule, "routes": res})
+}
+
+func bindRule(c *gin.Context) (*model.BindingRule, bool) {
+	var req ruleRequest
+
+	if !bindJSON(c, &req) {
+		return nil, false
+	}
+
+	roleID, err := parseUUID(c, "role_id", req.RoleID)
+	if err != nil {
+		return nil, false
+	}
+
+	return &model.BindingRule{
+		Name:        req.Name,
+		Service:     req.Service,
+		Method:      req.Method,
+		PathPattern: req.PathPattern,
+		RoleID:      roleID,
+	}, true
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *rbac) FindRouteConflicts(c *gin.Context) {
+	conflicts, err := h.service.FindRouteConflicts(c.Param("service"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conflicts": conflicts})
+}
+
+func (h *rbac) FindServiceRoutes(c *gin.Context) {
+	routes, err := h.service.FindServiceRoutes(c.Param("service"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"routes": routes})
+}
+
+func (h *rbac) FindServices(c *gin.Context) {
+	services, err := h.service.FindServices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"services": services})
+}
+
+func (h *rbac) Heartbeat(c *gin.Context) {
+	if err := h.service.Heartbeat(c.Param("service"), c.Query("instance"), c.Query("version")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "heartbeat recorded"})
+}
+
+func (h *rbac) RetireServiceVersion(c *gin.Context) {
+	if err := h.as(c).RetireServiceVersion(c.Param("service"), c.Param("version")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "service version retired"})
+}
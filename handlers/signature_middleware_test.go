@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	signature "github.com/demkowo/rbac/signatures"
+	"github.com/gin-gonic/gin"
+)
+
+func signedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/:service", VerifySignature(map[string]string{"orders": "s3cr3t"}, time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func signedRequest(service, secret string, signedAt time.Time, body string, sig func(string) string) *http.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/"+service, strings.NewReader(body))
+	req.Header.Set(signature.TimestampHeader, timestamp)
+	req.Header.Set(signature.SignatureHeader, sig(signature.Sign(secret, service, timestamp, []byte(body))))
+	return req
+}
+
+func same(sig string) string { return sig }
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"valid", signedRequest("orders", "s3cr3t", now, `{"routes":[]}`, same), http.StatusNoContent},
+		{"unknown service", signedRequest("users", "s3cr3t", now, `{"routes":[]}`, same), http.StatusUnauthorized},
+		{"other secret", signedRequest("orders", "t0ps3cr3t", now, `{"routes":[]}`, same), http.StatusUnauthorized},
+		{"too old", signedRequest("orders", "s3cr3t", now.Add(-2*time.Minute), `{"routes":[]}`, same), http.StatusUnauthorized},
+		{"too new", signedRequest("orders", "s3cr3t", now.Add(2*time.Minute), `{"routes":[]}`, same), http.StatusUnauthorized},
+		{"too large", signedRequest("orders", "s3cr3t", now, strings.Repeat(" ", maxSignedBody+1), same), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		signedRouter().ServeHTTP(w, tt.req)
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"routes":[]}`))
+	req.Header.Set(signature.SignatureHeader, signature.Sign("s3cr3t", "orders", "", []byte(`{"routes":[]}`)))
+	w := httptest.NewRecorder()
+	signedRouter().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("missing timestamp: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestVerifySignatureReplay(t *testing.T) {
+	r := signedRouter()
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"first", signedRequest("orders", "s3cr3t", now, `{"routes":[]}`, same), http.StatusNoContent},
+		{"replayed", signedRequest("orders", "s3cr3t", now, `{"routes":[]}`, same), http.StatusUnauthorized},
+		{"replayed in upper case", signedRequest("orders", "s3cr3t", now, `{"routes":[]}`, strings.ToUpper), http.StatusUnauthorized},
+		{"other body", signedRequest("orders", "s3cr3t", now, `{"routes":null}`, same), http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, tt.req)
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	seen := &replayCache{entries: make(map[string]time.Time)}
+	now := time.Now()
+
+	if !seen.add("a", now.Add(time.Minute)) {
+		t.Fatalf("first signature was rejected")
+	}
+	if seen.add("a", now.Add(time.Minute)) {
+		t.Errorf("repeated signature was accepted")
+	}
+
+	seen.add("b", now.Add(-time.Second))
+	seen.add("c", now.Add(time.Minute))
+	if _, ok := seen.entries["b"]; ok {
+		t.Errorf("expired signature was not evicted")
+	}
+	if len(seen.entries) != 2 {
+		t.Errorf("got %d remembered signatures, want 2", len(seen.entries))
+	}
+}
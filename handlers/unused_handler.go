@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	service "github.com/demkowo/rbac/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (h *rbac) FindUnusedRbac(c *gin.Context) {
+	days, roleID, ok := parseUnusedQuery(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.service.FindUnusedRbac(days, roleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// PruneUnusedRbac removes the suggested bindings and returns the report of
+// the removed ones.
+func (h *rbac) PruneUnusedRbac(c *gin.Context) {
+	days, roleID, ok := parseUnusedQuery(c)
+	if !ok {
+		return
+	}
+
+	force, err := parseBoolQuery(c, "force")
+	if err != nil {
+		return
+	}
+
+	report, err := h.as(c).PruneUnusedRbac(days, roleID, force)
+	if errors.Is(err, service.ErrIncompleteDecisionLog) || errors.Is(err, service.ErrRedactedDecisionLog) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+func parseUnusedQuery(c *gin.Context) (int, uuid.UUID, bool) {
+	var days int
+	if value := c.Query("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days"})
+			return 0, uuid.Nil, false
+		}
+	}
+
+	var roleID uuid.UUID
+	if value := c.Query("role_id"); value != "" {
+		var err error
+		if roleID, err = parseUUID(c, "role_id", value); err != nil {
+			return 0, uuid.Nil, false
+		}
+	}
+
+	return days, roleID, true
+}
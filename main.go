@@ -1,7 +1,19 @@
 package main
 
-import "github.com/demkowo/rbac/app"
+import (
+	"log"
+	"os"
+
+	"github.com/demkowo/rbac/app"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := app.RunCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	app.Start()
 }
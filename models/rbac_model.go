@@ -1,15 +1,254 @@
 package model
 
 import (
+	"encoding/json"
+	"time"
+
+	"github.com/demkowo/rbac/routepath"
 	"github.com/google/uuid"
 )
 
 type Route struct {
-	ID      uuid.UUID `json:"id"`
-	Method  string    `json:"method"`
-	Path    string    `json:"path"`
-	Service string    `json:"service"`
-	Active  bool      `json:"active"`
+	ID     uuid.UUID `json:"id"`
+	Method string    `json:"method"`
+	// Host the route is served on, "*.example.com" matches subdomains. Routes
+	// without a host match any host.
+	Host    string `json:"host,omitempty"`
+	Path    string `json:"path"`
+	Service string `json:"service"`
+	Active  bool   `json:"active"`
+
+	// Replaces is the path of a route of the same method that the route
+	// renames, sent by services on registration.
+	Replaces string `json:"replaces,omitempty"`
+
+	// Versions of the service that expose the route.
+	Versions []string `json:"versions,omitempty"`
+
+	Metadata *RouteMetadata `json:"metadata,omitempty"`
+}
+
+// RouteMetadata describes the operation behind a route, taken from the
+// OpenAPI document of the service.
+type RouteMetadata struct {
+	OperationID string   `json:"operation_id,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+type RemovedRoute struct {
+	Route
+	Roles []string `json:"roles"`
+}
+
+// RouteDiff describes what a registration of a service's routes changes
+// compared to the routes stored for that service.
+type RouteDiff struct {
+	Added       []Route         `json:"added"`
+	Reactivated []Route         `json:"reactivated"`
+	Unchanged   []Route         `json:"unchanged"`
+	Removed     []RemovedRoute  `json:"removed"`
+	Renamed     []Rename        `json:"renamed"`
+	Proposed    []Rename        `json:"proposed_renames"`
+	Bound       []Rbac          `json:"bound"`
+	Conflicts   []RouteConflict `json:"conflicts"`
+	Fingerprint string          `json:"fingerprint"`
+}
+
+// RouteConflict describes two routes of a service matching the same request,
+// e.g. "/users/:id" and "/users/me". Example is a path both match; the roles
+// bound to only one of the routes are the bindings that differ depending on
+// which route a router picks.
+type RouteConflict struct {
+	Kind           string   `json:"kind"`
+	Route          Route    `json:"route"`
+	Other          Route    `json:"other"`
+	Example        string   `json:"example"`
+	RolesOnlyRoute []string `json:"roles_only_route"`
+	RolesOnlyOther []string `json:"roles_only_other"`
+}
+
+// Rename carries the role bindings of a route over to the route replacing it.
+type Rename struct {
+	From       Route   `json:"from"`
+	To         Route   `json:"to"`
+	Source     string  `json:"source"`
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+type RegisterOptions struct {
+	DryRun        bool
+	Force         bool
+	AcceptRenames bool
+	Instance      string
+	Version       string
+
+	// Syntax of the submitted paths, they are stored in the canonical form.
+	Syntax routepath.Syntax
+}
+
+// Registration is what a service registration writes to the DB.
+type Registration struct {
+	Service     string   `json:"service"`
+	Version     string   `json:"version"`
+	Fingerprint string   `json:"fingerprint"`
+	Routes      []Route  `json:"routes"`
+	Renames     []Rename `json:"renames"`
+	Bindings    []Rbac   `json:"bindings"`
+
+	Diff *RouteDiff `json:"-"`
+}
+
+type Service struct {
+	Name         string     `json:"name"`
+	Fingerprint  string     `json:"fingerprint"`
+	RegisteredAt time.Time  `json:"registered_at"`
+	LastSeen     *time.Time `json:"last_seen"`
+	Stale        bool       `json:"stale"`
+	Instances    []Instance `json:"instances,omitempty"`
+	Versions     []Version  `json:"versions,omitempty"`
+}
+
+type Instance struct {
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Version is a route set registered by a version of a service. Routes stay
+// active while any version of the service exposes them.
+type Version struct {
+	Service      string    `json:"service"`
+	Version      string    `json:"version"`
+	Fingerprint  string    `json:"fingerprint"`
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// AuthorizeRequest asks whether any of the roles may send the request to the
+// service. Host is the host the request is sent to, routes without a host
+// match any. Without a service the routes of all services are considered.
+// Subject, e.g. the user ID, only ends up in the decision log.
+type AuthorizeRequest struct {
+	Subject string   `json:"subject"`
+	Service string   `json:"service"`
+	Method  string   `json:"method"`
+	Host    string   `json:"host"`
+	Path    string   `json:"path"`
+	Roles   []string `json:"roles"`
+}
+
+// Decision answers an AuthorizeRequest. Route is the route the request
+// matched, Roles the roles of the request bound to it.
+type Decision struct {
+	Allowed bool        `json:"allowed"`
+	Route   *Route      `json:"route,omitempty"`
+	Roles   []string    `json:"roles"`
+	RoleIDs []uuid.UUID `json:"-"`
+	Reason  string      `json:"reason"`
+}
+
+// DecisionLog records an authorization decision, made by the authorize
+// endpoint or reported by an enforcer embedded in a service. Route is the
+// matched route as "METHOD host/path". SampleRate is the share of decisions
+// like this one that are logged, 1 for every deny by default. RoleIDs are the
+// IDs of the bound roles that allowed the request. Decisions to Keep are
+// neither sampled out nor dropped.
+type DecisionLog struct {
+	ID         uuid.UUID   `json:"id"`
+	Time       time.Time   `json:"time"`
+	Source     string      `json:"source"`
+	RequestID  string      `json:"request_id"`
+	Subject    string      `json:"subject"`
+	Roles      []string    `json:"roles"`
+	RoleIDs    []uuid.UUID `json:"role_ids"`
+	Service    string      `json:"service"`
+	Method     string      `json:"method"`
+	Host       string      `json:"host"`
+	Path       string      `json:"path"`
+	RouteID    *uuid.UUID  `json:"route_id,omitempty"`
+	Route      string      `json:"route"`
+	Effect     string      `json:"effect"`
+	Reason     string      `json:"reason"`
+	LatencyUS  int64       `json:"latency_us"`
+	SampleRate float64     `json:"sample_rate"`
+	Keep       bool        `json:"-"`
+}
+
+// UnusedBinding is a role binding no logged decision used since the start
+// of the analysed window. LastUsed is when it was last used, if ever.
+type UnusedBinding struct {
+	Role     Role       `json:"role"`
+	Route    Route      `json:"route"`
+	LastUsed *time.Time `json:"last_used"`
+}
+
+// UnusedReport suggests role bindings to remove. Complete tells whether
+// decisions were logged for the whole window, otherwise bindings may only
+// look unused because logging started recently. Redacted tells whether
+// allows in the window were logged with their roles redacted, which makes
+// the bindings they used look unused.
+type UnusedReport struct {
+	Days         int             `json:"days"`
+	Since        time.Time       `json:"since"`
+	LoggingSince *time.Time      `json:"logging_since"`
+	Complete     bool            `json:"complete"`
+	Redacted     bool            `json:"redacted"`
+	Unused       []UnusedBinding `json:"unused"`
+}
+
+// DecisionFilter narrows down logged decisions, zero values match
+// everything.
+type DecisionFilter struct {
+	Subject string
+	Role    string
+	Service string
+	Effect  string
+	RouteID uuid.UUID
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+// Manifest lists what the roles of a caller are allowed to do, for frontends
+// to decide what to show. Routes maps services to "METHOD path" pairs, with
+// the host before the path of host specific routes, Resources maps resource
+// types to resource names to actions.
+type Manifest struct {
+	Roles     []string                       `json:"roles"`
+	Routes    map[string][]string            `json:"routes"`
+	Resources map[string]map[string][]string `json:"resources"`
+}
+
+// Resource is anything access to is granted on: HTTP routes, UI elements,
+// queue topics or resources of custom types. Actions lists the verbs roles
+// can be granted, routes have the single action "access".
+type Resource struct {
+	ID          uuid.UUID `json:"id"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Service     string    `json:"service"`
+	Description string    `json:"description"`
+	Actions     []string  `json:"actions"`
+}
+
+// Permission grants a role an action on a resource.
+type Permission struct {
+	ResourceID uuid.UUID `json:"resource_id"`
+	RoleID     uuid.UUID `json:"role_id"`
+	Action     string    `json:"action"`
+}
+
+// RoleActions lists the actions a role is granted on a resource.
+type RoleActions struct {
+	Role    Role     `json:"role"`
+	Actions []string `json:"actions"`
+}
+
+// ResourceActions lists the actions granted on a resource.
+type ResourceActions struct {
+	Resource Resource `json:"resource"`
+	Actions  []string `json:"actions"`
 }
 
 type Role struct {
@@ -18,6 +257,332 @@ type Role struct {
 }
 
 type Rbac struct {
-	RouteID uuid.UUID `json:"route_id"`
-	RoleID  uuid.UUID `json:"role_id"`
+	RouteID uuid.UUID  `json:"route_id"`
+	RoleID  uuid.UUID  `json:"role_id"`
+	RuleID  *uuid.UUID `json:"rule_id,omitempty"`
+}
+
+// BindingRule binds routes seen for the first time to a role. Empty service
+// and method, or "*", match any; in the path pattern "*" matches any
+// sequence of characters.
+type BindingRule struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Service     string    `json:"service"`
+	Method      string    `json:"method"`
+	PathPattern string    `json:"path_pattern"`
+	RoleID      uuid.UUID `json:"role_id"`
+}
+
+type RulePreview struct {
+	Route Route `json:"route"`
+	Bound bool  `json:"bound"`
+}
+
+// Actor is who makes a change: the subject of the caller's JWT, a service
+// registering its routes or the system itself for background jobs. Roles are
+// the roles of the caller's JWT.
+type Actor struct {
+	Name      string   `json:"name"`
+	IP        string   `json:"ip"`
+	RequestID string   `json:"request_id"`
+	Roles     []string `json:"-"`
+}
+
+// AuditEntry records a change of the policy. Before and After hold the
+// entity as JSON, Before is empty for additions and After for deletions.
+// Hash covers the entry and PrevHash, the hash of the entry before it, so
+// editing or removing an entry breaks the chain; Signature signs the hash.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"request_id"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// AuditVerification is the result of walking the audit chain. Unsealed
+// counts the entries written before the chain was introduced, Signed the
+// entries whose signature was verified. BrokenID is the first entry that does
+// not verify.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	Unsealed int    `json:"unsealed"`
+	Signed   int    `json:"signed"`
+	Head     string `json:"head"`
+	BrokenID int64  `json:"broken_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditFilter narrows down audit entries, zero values match everything.
+type AuditFilter struct {
+	Actor    string
+	Entity   string
+	EntityID string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// Revision is a version of the policy: roles, routes and the bindings
+// between them. Every change creates a new revision with a snapshot of the
+// whole policy, Hash tells snapshots apart.
+type Revision struct {
+	Revision  int64           `json:"revision"`
+	CreatedAt time.Time       `json:"created_at"`
+	Actor     string          `json:"actor"`
+	Reason    string          `json:"reason"`
+	Hash      string          `json:"hash"`
+	Snapshot  *PolicySnapshot `json:"snapshot,omitempty"`
+
+	// KeptRoles and KeptRoutes are set by a rollback to the roles and routes
+	// missing from the restored revision that were kept, because other data
+	// still refers to them.
+	KeptRoles  []Role  `json:"kept_roles,omitempty"`
+	KeptRoutes []Route `json:"kept_routes,omitempty"`
+}
+
+type PolicySnapshot struct {
+	Roles  []Role  `json:"roles"`
+	Routes []Route `json:"routes"`
+	Rbac   []Rbac  `json:"rbac"`
+}
+
+type RoleChange struct {
+	Before Role `json:"before"`
+	After  Role `json:"after"`
+}
+
+type RouteChange struct {
+	Before Route `json:"before"`
+	After  Route `json:"after"`
+}
+
+// PolicyDiff lists what changed from one revision to another.
+type PolicyDiff struct {
+	From            int64         `json:"from,omitempty"`
+	To              int64         `json:"to,omitempty"`
+	AddedRoles      []Role        `json:"added_roles"`
+	RemovedRoles    []Role        `json:"removed_roles"`
+	ChangedRoles    []RoleChange  `json:"changed_roles"`
+	AddedRoutes     []Route       `json:"added_routes"`
+	RemovedRoutes   []Route       `json:"removed_routes"`
+	ChangedRoutes   []RouteChange `json:"changed_routes"`
+	AddedBindings   []Rbac        `json:"added_bindings"`
+	RemovedBindings []Rbac        `json:"removed_bindings"`
+}
+
+// Operations of change sets.
+const (
+	ChangeAdd    = "add"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// ChangeSet stages changes of roles, routes and bindings that are published
+// together once a user who did not contribute to them approved them. Until
+// then they do not affect decisions. Contributors are the author and every
+// user who edited the operations. Version is incremented on every change of
+// the set.
+type ChangeSet struct {
+	ID           uuid.UUID         `json:"id"`
+	Title        string            `json:"title"`
+	Description  string            `json:"description,omitempty"`
+	Status       string            `json:"status"`
+	Author       string            `json:"author"`
+	Contributors []string          `json:"contributors"`
+	Operations   []ChangeOperation `json:"operations"`
+	Version      int               `json:"version"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	ApprovedBy   string            `json:"approved_by,omitempty"`
+	ApprovedAt   *time.Time        `json:"approved_at,omitempty"`
+	PublishedBy  string            `json:"published_by,omitempty"`
+	PublishedAt  *time.Time        `json:"published_at,omitempty"`
+	Revision     int64             `json:"revision,omitempty"`
+}
+
+// ChangeOperation adds, updates or deletes exactly one of a role, a route or
+// a binding. BaseRole and BaseRoute hold the live role or route an update or
+// deletion was staged against, publishing fails when it changed since.
+type ChangeOperation struct {
+	Op        string `json:"op"`
+	Role      *Role  `json:"role,omitempty"`
+	Route     *Route `json:"route,omitempty"`
+	Rbac      *Rbac  `json:"rbac,omitempty"`
+	BaseRole  *Role  `json:"base_role,omitempty"`
+	BaseRoute *Route `json:"base_route,omitempty"`
+}
+
+// ChangeConflict tells why the operation at the index cannot be applied to
+// the live policy.
+type ChangeConflict struct {
+	Operation int    `json:"operation"`
+	Reason    string `json:"reason"`
+}
+
+// ChangeSetPreview is what publishing the change set would change now.
+type ChangeSetPreview struct {
+	Diff      *PolicyDiff      `json:"diff"`
+	Conflicts []ChangeConflict `json:"conflicts"`
+}
+
+// RoleAssignment grants a role to a subject in addition to the roles of its
+// JWT. Assignments without ExpiresAt do not expire.
+type RoleAssignment struct {
+	Subject   string     `json:"subject"`
+	RoleID    uuid.UUID  `json:"role_id"`
+	Role      string     `json:"role"`
+	GrantedBy string     `json:"granted_by"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AccessRequest asks for a role to be assigned to the requester or, with
+// RouteID, for a route to be bound to a role. Duration, a Go duration such as
+// "72h", limits the grant; ExpiresAt is set when the request is approved.
+// GrantOwned tells whether the binding an approved route request granted
+// still exists as granted; once it was removed, the request no longer owns a
+// binding added again and leaves it at its expiry.
+type AccessRequest struct {
+	ID         uuid.UUID  `json:"id"`
+	Requester  string     `json:"requester"`
+	RoleID     uuid.UUID  `json:"role_id"`
+	Role       string     `json:"role"`
+	RouteID    *uuid.UUID `json:"route_id,omitempty"`
+	Reason     string     `json:"reason"`
+	Duration   string     `json:"duration,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DecidedBy  string     `json:"decided_by,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	GrantOwned bool       `json:"grant_owned"`
+}
+
+// AccessRequestFilter narrows down access requests, zero values match
+// everything.
+type AccessRequestFilter struct {
+	Requester string
+	Status    string
+	RoleID    uuid.UUID
+}
+
+// BreakGlass is emergency access: the role assigned to the actor from
+// StartedAt until ExpiresAt, or until it is ended early.
+type BreakGlass struct {
+	ID            uuid.UUID  `json:"id"`
+	Actor         string     `json:"actor"`
+	RoleID        uuid.UUID  `json:"role_id"`
+	Role          string     `json:"role"`
+	Justification string     `json:"justification"`
+	StartedAt     time.Time  `json:"started_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	EndedBy       string     `json:"ended_by,omitempty"`
+}
+
+// BreakGlassReport lists what the actor of break-glass access changed and
+// which decisions were made for it while the access was active.
+type BreakGlassReport struct {
+	BreakGlass *BreakGlass    `json:"break_glass"`
+	Changes    []*AuditEntry  `json:"changes"`
+	Decisions  []*DecisionLog `json:"decisions"`
+}
+
+// Event is sent to webhooks and notification hooks.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Message string    `json:"message"`
+	Data    any       `json:"data,omitempty"`
+}
+
+// Decisions on review items.
+const (
+	ReviewPending = "pending"
+	ReviewKeep    = "keep"
+	ReviewRevoke  = "revoke"
+)
+
+// ReviewCampaign recertifies the role bindings in its scope, of a service,
+// a role or, without either, all bindings. The bindings are copied into
+// review items when the campaign starts.
+type ReviewCampaign struct {
+	ID          uuid.UUID      `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Service     string         `json:"service,omitempty"`
+	RoleID      *uuid.UUID     `json:"role_id,omitempty"`
+	Role        string         `json:"role,omitempty"`
+	Status      string         `json:"status"`
+	CreatedBy   string         `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DueAt       *time.Time     `json:"due_at,omitempty"`
+	ClosedBy    string         `json:"closed_by,omitempty"`
+	ClosedAt    *time.Time     `json:"closed_at,omitempty"`
+	Progress    ReviewProgress `json:"progress"`
+}
+
+// ReviewProgress counts the items of a campaign, of one reviewer if set.
+type ReviewProgress struct {
+	Reviewer string `json:"reviewer,omitempty"`
+	Total    int    `json:"total"`
+	Kept     int    `json:"kept"`
+	Revoked  int    `json:"revoked"`
+	Pending  int    `json:"pending"`
+}
+
+// ReviewItem is a binding under review. The route and role are copied, so
+// the item still reads after they are deleted. Result tells what closing the
+// campaign did to a revoked binding.
+type ReviewItem struct {
+	ID         uuid.UUID  `json:"id"`
+	CampaignID uuid.UUID  `json:"campaign_id"`
+	RouteID    uuid.UUID  `json:"route_id"`
+	Method     string     `json:"method"`
+	Host       string     `json:"host,omitempty"`
+	Path       string     `json:"path"`
+	Service    string     `json:"service"`
+	RoleID     uuid.UUID  `json:"role_id"`
+	Role       string     `json:"role"`
+	Reviewer   string     `json:"reviewer"`
+	Decision   string     `json:"decision"`
+	Comment    string     `json:"comment,omitempty"`
+	DecidedBy  string     `json:"decided_by,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	Result     string     `json:"result,omitempty"`
+}
+
+// ReviewItemFilter narrows down review items, zero values match everything.
+type ReviewItemFilter struct {
+	Reviewer string
+	Decision string
+}
+
+// ReviewDecision keeps or revokes a review item.
+type ReviewDecision struct {
+	ItemID   uuid.UUID `json:"item_id"`
+	Decision string    `json:"decision"`
+	Comment  string    `json:"comment"`
+}
+
+// ReviewEvidence documents a campaign with every item and its decision.
+type ReviewEvidence struct {
+	Campaign   *ReviewCampaign  `json:"campaign"`
+	Reviewers  []ReviewProgress `json:"reviewers"`
+	Items      []*ReviewItem    `json:"items"`
+	ExportedAt time.Time        `json:"exported_at"`
 }
@@ -0,0 +1,64 @@
+// Package notify sends events, such as break-glass access, to webhooks and
+// chat notification hooks.
+package notify
+
+import (
+	"log"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+const bufferSize = 64
+
+// Hook delivers events.
+type Hook interface {
+	Send(*model.Event) error
+}
+
+type Notifier interface {
+	Notify(*model.Event)
+}
+
+type notifier struct {
+	hooks  []Hook
+	events chan *model.Event
+}
+
+// New starts a notifier sending to the hooks in the background, so slow
+// hooks do not hold up requests. When the hooks fall behind events are
+// dropped.
+func New(hooks ...Hook) Notifier {
+	n := &notifier{
+		hooks:  hooks,
+		events: make(chan *model.Event, bufferSize),
+	}
+	go n.send()
+	return n
+}
+
+func (n *notifier) Notify(event *model.Event) {
+	if len(n.hooks) == 0 {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	select {
+	case n.events <- event:
+	default:
+		log.Printf("notification buffer full, dropping %s event", event.Type)
+	}
+}
+
+func (n *notifier) send() {
+	for event := range n.events {
+		for _, hook := range n.hooks {
+			if err := hook.Send(event); err != nil {
+				log.Printf("failed to send %s event: %v", event.Type, err)
+			}
+		}
+	}
+}
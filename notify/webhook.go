@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	signature "github.com/demkowo/rbac/signatures"
+)
+
+const (
+	// SignatureService is signed in place of a service name, so receivers
+	// verify webhooks with signature.Verify like registrations.
+	SignatureService = "rbac"
+
+	timeout = 10 * time.Second
+)
+
+var client = &http.Client{Timeout: timeout}
+
+type webhook struct {
+	url    string
+	secret string
+}
+
+// NewWebhook posts events as JSON to the URL. With a secret the body is
+// signed like registrations, in the X-RBAC-Timestamp and X-RBAC-Signature
+// headers.
+func NewWebhook(url, secret string) Hook {
+	return &webhook{url: url, secret: secret}
+}
+
+func (w *webhook) Send(event *model.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(signature.TimestampHeader, timestamp)
+		req.Header.Set(signature.SignatureHeader, signature.Sign(w.secret, SignatureService, timestamp, body))
+	}
+
+	return post(req)
+}
+
+type chat struct {
+	url string
+}
+
+// NewChat posts the message of events as {"text": ...}, which incoming
+// webhooks of Slack, Mattermost and similar chats accept.
+func NewChat(url string) Hook {
+	return &chat{url: url}
+}
+
+func (c *chat) Send(event *model.Event) error {
+	body, err := json.Marshal(map[string]string{"text": event.Message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return post(req)
+}
+
+func post(req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
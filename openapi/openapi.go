@@ -0,0 +1,109 @@
+// Package openapi converts OpenAPI 3 documents to the routes of a service.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
+	"gopkg.in/yaml.v3"
+)
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type document struct {
+	OpenAPI string                          `yaml:"openapi"`
+	Servers []server                        `yaml:"servers"`
+	Paths   map[string]map[string]yaml.Node `yaml:"paths"`
+}
+
+type server struct {
+	URL string `yaml:"url"`
+}
+
+type operation struct {
+	OperationID string   `yaml:"operationId"`
+	Summary     string   `yaml:"summary"`
+	Tags        []string `yaml:"tags"`
+}
+
+// Routes returns a route for every operation of the document, JSON or YAML,
+// with paths in the canonical form. Paths are
+// prefixed with the path of the first server URL. With metadata set the
+// operationId, summary and tags of each operation are kept on the route.
+func Routes(service string, doc []byte, metadata bool) ([]model.Route, error) {
+	var d document
+	if err := yaml.Unmarshal(doc, &d); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(d.OpenAPI, "3.") {
+		return nil, errors.New("only OpenAPI 3 documents are supported")
+	}
+
+	base := basePath(d.Servers)
+
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var routes []model.Route
+	for _, path := range paths {
+		converted, err := routepath.Normalize(base+path, routepath.OpenAPI)
+		if err != nil {
+			return nil, err
+		}
+
+		item := d.Paths[path]
+		for _, method := range methods {
+			node, ok := item[method]
+			if !ok {
+				continue
+			}
+
+			route := model.Route{
+				Method:  strings.ToUpper(method),
+				Path:    converted,
+				Service: service,
+				Active:  true,
+			}
+
+			if metadata {
+				var op operation
+				if err := node.Decode(&op); err != nil {
+					return nil, fmt.Errorf("invalid operation %s %s: %w", route.Method, path, err)
+				}
+				if op.OperationID != "" || op.Summary != "" || len(op.Tags) > 0 {
+					route.Metadata = &model.RouteMetadata{
+						OperationID: op.OperationID,
+						Summary:     op.Summary,
+						Tags:        op.Tags,
+					}
+				}
+			}
+
+			routes = append(routes, route)
+		}
+	}
+
+	return routes, nil
+}
+
+// basePath returns the path of the first server URL, ignoring templated URLs.
+func basePath(servers []server) string {
+	if len(servers) == 0 || strings.Contains(servers[0].URL, "{") {
+		return ""
+	}
+
+	u, err := url.Parse(servers[0].URL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(u.Path, "/")
+}
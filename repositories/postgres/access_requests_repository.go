@@ -0,0 +1,238 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	ACCESS_REQUEST_COLUMNS = `r.id, r.requester, r.role_id, roles.name, r.route_id, r.reason, r.duration, r.status, r.created_at,
+            r.decided_by, r.decided_at, r.comment, r.expires_at, r.grant_owned`
+	ADD_ACCESS_REQUEST = `
+        INSERT INTO access_requests (id, requester, role_id, route_id, reason, duration, status)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at
+    `
+	// A request is decided only if its status is still the one read.
+	// Approving a binding request makes it own the binding.
+	DECIDE_ACCESS_REQUEST = `
+        UPDATE access_requests SET status = $3, decided_by = $4, decided_at = $5, comment = $6, expires_at = $7,
+            grant_owned = grant_owned OR ($2 = 'pending' AND $3 = 'approved' AND route_id IS NOT NULL)
+        WHERE id = $1 AND status = $2
+        RETURNING grant_owned
+    `
+	// Once the binding of a request is gone, a binding added again is not
+	// the request's to revoke.
+	DISOWN_REMOVED_GRANTS = `
+        UPDATE access_requests SET grant_owned = false
+        WHERE grant_owned AND NOT EXISTS (
+            SELECT 1 FROM rbac WHERE rbac.route_id = access_requests.route_id AND rbac.role_id = access_requests.role_id
+        )
+    `
+	FIND_ACCESS_REQUESTS = `
+        SELECT ` + ACCESS_REQUEST_COLUMNS + `
+        FROM access_requests AS r
+        INNER JOIN roles ON roles.id = r.role_id
+        WHERE ($1::text = '' OR r.requester = $1)
+            AND ($2::text = '' OR r.status = $2)
+            AND ($3::uuid IS NULL OR r.role_id = $3)
+        ORDER BY r.created_at DESC
+    `
+	FIND_ACCESS_REQUEST = `
+        SELECT ` + ACCESS_REQUEST_COLUMNS + `
+        FROM access_requests AS r
+        INNER JOIN roles ON roles.id = r.role_id
+        WHERE r.id = $1
+    `
+	FIND_EXPIRED_GRANTS = `
+        SELECT ` + ACCESS_REQUEST_COLUMNS + `
+        FROM access_requests AS r
+        INNER JOIN roles ON roles.id = r.role_id
+        WHERE r.status = $1 AND r.expires_at <= now()
+        ORDER BY r.expires_at
+    `
+
+	ADD_APPROVERS    = "INSERT INTO role_approvers (role_id, approver) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING"
+	DELETE_APPROVERS = "DELETE FROM role_approvers WHERE role_id = $1"
+	FIND_APPROVERS   = "SELECT approver FROM role_approvers WHERE role_id = $1 ORDER BY approver"
+)
+
+type AccessRequests interface {
+	Add(*model.AccessRequest) error
+	Decide(*model.AccessRequest, string) (bool, error)
+	DisownRemovedGrants() error
+	Find(model.AccessRequestFilter) ([]*model.AccessRequest, error)
+	FindApprovers(uuid.UUID) ([]string, error)
+	FindByID(uuid.UUID) (*model.AccessRequest, error)
+	FindExpired(string) ([]*model.AccessRequest, error)
+	SetApprovers(uuid.UUID, []string) error
+}
+
+type accessRequests struct {
+	db DB
+}
+
+func NewAccessRequests(db DB) AccessRequests {
+	return &accessRequests{db: db}
+}
+
+func (r *accessRequests) Add(req *model.AccessRequest) error {
+	err := r.db.QueryRow(ADD_ACCESS_REQUEST, req.ID, req.Requester, req.RoleID, req.RouteID, req.Reason, req.Duration, req.Status).
+		Scan(&req.CreatedAt)
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow ADD_ACCESS_REQUEST: %v", err)
+		return errors.New("failed to add access request")
+	}
+	return nil
+}
+
+// Decide saves the status, decision and expiry of the request, reads
+// whether it owns its binding and reports false if its status is no longer
+// from.
+func (r *accessRequests) Decide(req *model.AccessRequest, from string) (bool, error) {
+	err := r.db.QueryRow(DECIDE_ACCESS_REQUEST, req.ID, from, req.Status, req.DecidedBy, req.DecidedAt, req.Comment, req.ExpiresAt).
+		Scan(&req.GrantOwned)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow DECIDE_ACCESS_REQUEST: %v", err)
+		return false, errors.New("failed to decide access request")
+	}
+	return true, nil
+}
+
+// DisownRemovedGrants clears GrantOwned of the requests whose binding no
+// longer exists.
+func (r *accessRequests) DisownRemovedGrants() error {
+	if _, err := r.db.Exec(DISOWN_REMOVED_GRANTS); err != nil {
+		log.Printf("failed to execute db.Exec DISOWN_REMOVED_GRANTS: %v", err)
+		return errors.New("failed to update access requests")
+	}
+	return nil
+}
+
+func (r *accessRequests) Find(filter model.AccessRequestFilter) ([]*model.AccessRequest, error) {
+	return r.find(FIND_ACCESS_REQUESTS, "FIND_ACCESS_REQUESTS", filter.Requester, filter.Status, nullUUID(filter.RoleID))
+}
+
+func (r *accessRequests) FindApprovers(roleID uuid.UUID) ([]string, error) {
+	rows, err := r.db.Query(FIND_APPROVERS, roleID)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_APPROVERS: %v", err)
+		return nil, errors.New("failed to find approvers")
+	}
+	defer rows.Close()
+
+	var approvers []string
+	for rows.Next() {
+		var approver string
+		if err := rows.Scan(&approver); err != nil {
+			log.Printf("failed to scan FIND_APPROVERS record: %v", err)
+			return nil, errors.New("failed to find approvers")
+		}
+		approvers = append(approvers, approver)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over approvers: %v", err)
+		return nil, errors.New("failed to find approvers")
+	}
+
+	return approvers, nil
+}
+
+func (r *accessRequests) FindByID(id uuid.UUID) (*model.AccessRequest, error) {
+	req, err := scanAccessRequest(r.db.QueryRow(FIND_ACCESS_REQUEST, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("access request not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_ACCESS_REQUEST: %v", err)
+		return nil, errors.New("failed to find access request")
+	}
+	return req, nil
+}
+
+// FindExpired returns the requests with the status whose grant expired.
+func (r *accessRequests) FindExpired(status string) ([]*model.AccessRequest, error) {
+	return r.find(FIND_EXPIRED_GRANTS, "FIND_EXPIRED_GRANTS", status)
+}
+
+// SetApprovers replaces the approvers of the role.
+func (r *accessRequests) SetApprovers(roleID uuid.UUID, approvers []string) error {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to set approvers")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(DELETE_APPROVERS, roleID); err != nil {
+		log.Printf("failed to execute tx.Exec DELETE_APPROVERS: %v", err)
+		return errors.New("failed to set approvers")
+	}
+
+	if _, err := tx.Exec(ADD_APPROVERS, roleID, pq.Array(approvers)); err != nil {
+		log.Printf("failed to execute tx.Exec ADD_APPROVERS: %v", err)
+		return errors.New("failed to set approvers")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit approvers: %v", err)
+		return errors.New("failed to set approvers")
+	}
+	return nil
+}
+
+func (r *accessRequests) find(query, name string, args ...any) ([]*model.AccessRequest, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("failed to execute db.Query %s: %v", name, err)
+		return nil, errors.New("failed to find access requests")
+	}
+	defer rows.Close()
+
+	var res []*model.AccessRequest
+	for rows.Next() {
+		req, err := scanAccessRequest(rows)
+		if err != nil {
+			log.Printf("failed to scan %s record: %v", name, err)
+			return nil, errors.New("failed to find access requests")
+		}
+		res = append(res, req)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over access requests: %v", err)
+		return nil, errors.New("failed to find access requests")
+	}
+
+	return res, nil
+}
+
+func scanAccessRequest(row rowScanner) (*model.AccessRequest, error) {
+	var req model.AccessRequest
+	var routeID uuid.NullUUID
+	var decidedAt, expiresAt sql.NullTime
+	if err := row.Scan(&req.ID, &req.Requester, &req.RoleID, &req.Role, &routeID, &req.Reason, &req.Duration, &req.Status,
+		&req.CreatedAt, &req.DecidedBy, &decidedAt, &req.Comment, &expiresAt, &req.GrantOwned); err != nil {
+		return nil, err
+	}
+
+	if routeID.Valid {
+		req.RouteID = &routeID.UUID
+	}
+	if decidedAt.Valid {
+		req.DecidedAt = &decidedAt.Time
+	}
+	if expiresAt.Valid {
+		req.ExpiresAt = &expiresAt.Time
+	}
+	return &req, nil
+}
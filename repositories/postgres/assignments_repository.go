@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	ADD_ASSIGNMENT = `
+        INSERT INTO role_assignments (subject, role_id, granted_by, reason, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (subject, role_id) DO UPDATE SET granted_by = EXCLUDED.granted_by, reason = EXCLUDED.reason,
+            created_at = now(), expires_at = EXCLUDED.expires_at
+        RETURNING created_at
+    `
+	DELETE_ASSIGNMENT = "DELETE FROM role_assignments WHERE subject = $1 AND role_id = $2"
+	// An assignment renewed since it was found expired is kept.
+	EXPIRE_ASSIGNMENT = "DELETE FROM role_assignments WHERE subject = $1 AND role_id = $2 AND expires_at <= now()"
+	FIND_ASSIGNMENTS  = `
+        SELECT a.subject, a.role_id, roles.name, a.granted_by, a.reason, a.created_at, a.expires_at
+        FROM role_assignments AS a
+        INNER JOIN roles ON roles.id = a.role_id
+        WHERE ($1::text = '' OR a.subject = $1) AND (a.expires_at IS NULL OR a.expires_at > now())
+        ORDER BY a.subject, roles.name
+    `
+	FIND_EXPIRED_ASSIGNMENTS = `
+        SELECT a.subject, a.role_id, roles.name, a.granted_by, a.reason, a.created_at, a.expires_at
+        FROM role_assignments AS a
+        INNER JOIN roles ON roles.id = a.role_id
+        WHERE a.expires_at <= now()
+        ORDER BY a.expires_at
+    `
+	FIND_ASSIGNED_ROLES = `
+        SELECT roles.name FROM role_assignments AS a
+        INNER JOIN roles ON roles.id = a.role_id
+        WHERE a.subject = $1 AND (a.expires_at IS NULL OR a.expires_at > now())
+    `
+)
+
+type Assignments interface {
+	Add(*model.RoleAssignment) error
+	Delete(string, uuid.UUID) error
+	Expire(string, uuid.UUID) (bool, error)
+	Find(string) ([]*model.RoleAssignment, error)
+	FindExpired() ([]*model.RoleAssignment, error)
+	FindRoles(string) ([]string, error)
+}
+
+type assignments struct {
+	db DB
+}
+
+func NewAssignments(db DB) Assignments {
+	return &assignments{db: db}
+}
+
+// Add assigns the role to the subject, replacing an earlier assignment of
+// the same role.
+func (r *assignments) Add(a *model.RoleAssignment) error {
+	err := r.db.QueryRow(ADD_ASSIGNMENT, a.Subject, a.RoleID, a.GrantedBy, a.Reason, a.ExpiresAt).Scan(&a.CreatedAt)
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow ADD_ASSIGNMENT: %v", err)
+		return errors.New("failed to assign role")
+	}
+	return nil
+}
+
+func (r *assignments) Delete(subject string, roleID uuid.UUID) error {
+	res, err := r.db.Exec(DELETE_ASSIGNMENT, subject, roleID)
+	if err != nil {
+		log.Printf("failed to execute db.Exec DELETE_ASSIGNMENT: %v", err)
+		return errors.New("failed to delete assignment")
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("assignment not found")
+	}
+	return nil
+}
+
+// Expire deletes the assignment if it is still expired and reports whether
+// it did.
+func (r *assignments) Expire(subject string, roleID uuid.UUID) (bool, error) {
+	res, err := r.db.Exec(EXPIRE_ASSIGNMENT, subject, roleID)
+	if err != nil {
+		log.Printf("failed to execute db.Exec EXPIRE_ASSIGNMENT: %v", err)
+		return false, errors.New("failed to expire assignment")
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Find returns the assignments of the subject, of all subjects if it is
+// empty, that did not expire.
+func (r *assignments) Find(subject string) ([]*model.RoleAssignment, error) {
+	return r.find(FIND_ASSIGNMENTS, "FIND_ASSIGNMENTS", subject)
+}
+
+func (r *assignments) FindExpired() ([]*model.RoleAssignment, error) {
+	return r.find(FIND_EXPIRED_ASSIGNMENTS, "FIND_EXPIRED_ASSIGNMENTS")
+}
+
+// FindRoles returns the names of the roles assigned to the subject.
+func (r *assignments) FindRoles(subject string) ([]string, error) {
+	rows, err := r.db.Query(FIND_ASSIGNED_ROLES, subject)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_ASSIGNED_ROLES: %v", err)
+		return nil, errors.New("failed to find assigned roles")
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Printf("failed to scan FIND_ASSIGNED_ROLES record: %v", err)
+			return nil, errors.New("failed to find assigned roles")
+		}
+		res = append(res, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over assigned roles: %v", err)
+		return nil, errors.New("failed to find assigned roles")
+	}
+
+	return res, nil
+}
+
+func (r *assignments) find(query, name string, args ...any) ([]*model.RoleAssignment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("failed to execute db.Query %s: %v", name, err)
+		return nil, errors.New("failed to find assignments")
+	}
+	defer rows.Close()
+
+	var res []*model.RoleAssignment
+	for rows.Next() {
+		var a model.RoleAssignment
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&a.Subject, &a.RoleID, &a.Role, &a.GrantedBy, &a.Reason, &a.CreatedAt, &expiresAt); err != nil {
+			log.Printf("failed to scan %s record: %v", name, err)
+			return nil, errors.New("failed to find assignments")
+		}
+		if expiresAt.Valid {
+			a.ExpiresAt = &expiresAt.Time
+		}
+		res = append(res, &a)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over assignments: %v", err)
+		return nil, errors.New("failed to find assignments")
+	}
+
+	return res, nil
+}
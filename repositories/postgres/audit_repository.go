@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+// The audit_log table is append-only, a trigger rejects updates and deletes.
+// Entries are chained: each stores the hash of the entry before it, so they
+// are added one at a time under an advisory lock.
+const (
+	LOCK_AUDIT_LOG  = "SELECT pg_advisory_xact_lock(hashtext('audit_log'))"
+	LAST_AUDIT_HASH = "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1"
+	NEXT_AUDIT_ID   = "SELECT nextval(pg_get_serial_sequence('audit_log', 'id'))"
+	ADD_AUDIT_ENTRY = `
+        INSERT INTO audit_log (id, actor, ip, request_id, action, entity, entity_id, before, after, created_at, prev_hash, hash, signature)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+    `
+	AUDIT_COLUMNS      = "id, actor, ip, request_id, action, entity, entity_id, before, after, created_at, prev_hash, hash, signature"
+	FIND_AUDIT_ENTRIES = `
+        SELECT ` + AUDIT_COLUMNS + ` FROM audit_log
+        WHERE ($1::text = '' OR actor = $1)
+            AND ($2::text = '' OR entity = $2)
+            AND ($3::text = '' OR entity_id = $3)
+            AND ($4::timestamptz IS NULL OR created_at >= $4)
+            AND ($5::timestamptz IS NULL OR created_at < $5)
+        ORDER BY id DESC
+        LIMIT $6
+    `
+	FIND_AUDIT_CHAIN = `
+        SELECT ` + AUDIT_COLUMNS + ` FROM audit_log
+        WHERE id > $1
+        ORDER BY id
+        LIMIT $2
+    `
+)
+
+type Audit interface {
+	Add(*model.AuditEntry, func(*model.AuditEntry) error) error
+	Find(model.AuditFilter) ([]*model.AuditEntry, error)
+	FindChain(int64, int) ([]*model.AuditEntry, error)
+}
+
+type audit struct {
+	db DB
+}
+
+func NewAudit(db DB) Audit {
+	return &audit{db: db}
+}
+
+// Add assigns the entry its ID, timestamp and the hash of the last entry,
+// lets seal hash and sign it and appends it to the log.
+func (r *audit) Add(entry *model.AuditEntry, seal func(*model.AuditEntry) error) error {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to add audit entry")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_AUDIT_LOG); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_AUDIT_LOG: %v", err)
+		return errors.New("failed to add audit entry")
+	}
+
+	entry.PrevHash = ""
+	if err := tx.QueryRow(LAST_AUDIT_HASH).Scan(&entry.PrevHash); err != nil && err != sql.ErrNoRows {
+		log.Printf("failed to execute tx.QueryRow LAST_AUDIT_HASH: %v", err)
+		return errors.New("failed to add audit entry")
+	}
+
+	if err := tx.QueryRow(NEXT_AUDIT_ID).Scan(&entry.ID); err != nil {
+		log.Printf("failed to execute tx.QueryRow NEXT_AUDIT_ID: %v", err)
+		return errors.New("failed to add audit entry")
+	}
+
+	// Postgres keeps microseconds, the hash must cover the stored time.
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	if err := seal(entry); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ADD_AUDIT_ENTRY, entry.ID, entry.Actor, entry.IP, entry.RequestID, entry.Action, entry.Entity, entry.EntityID,
+		jsonColumn(entry.Before), jsonColumn(entry.After), entry.CreatedAt, entry.PrevHash, entry.Hash, entry.Signature)
+	if err != nil {
+		log.Printf("failed to execute tx.Exec ADD_AUDIT_ENTRY: %v", err)
+		return errors.New("failed to add audit entry")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit audit entry: %v", err)
+		return errors.New("failed to add audit entry")
+	}
+	return nil
+}
+
+func (r *audit) Find(filter model.AuditFilter) ([]*model.AuditEntry, error) {
+	rows, err := r.db.Query(FIND_AUDIT_ENTRIES, filter.Actor, filter.Entity, filter.EntityID,
+		nullTime(filter.From), nullTime(filter.To), filter.Limit)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_AUDIT_ENTRIES: %v", err)
+		return nil, errors.New("failed to find audit entries")
+	}
+	defer rows.Close()
+
+	entries, err := scanAuditEntries(rows)
+	if err != nil {
+		log.Printf("failed to scan FIND_AUDIT_ENTRIES record: %v", err)
+		return nil, errors.New("failed to find audit entries")
+	}
+	return entries, nil
+}
+
+// FindChain returns up to limit entries following the entry with the ID, in
+// the order they were added.
+func (r *audit) FindChain(afterID int64, limit int) ([]*model.AuditEntry, error) {
+	rows, err := r.db.Query(FIND_AUDIT_CHAIN, afterID, limit)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_AUDIT_CHAIN: %v", err)
+		return nil, errors.New("failed to read audit chain")
+	}
+	defer rows.Close()
+
+	entries, err := scanAuditEntries(rows)
+	if err != nil {
+		log.Printf("failed to scan FIND_AUDIT_CHAIN record: %v", err)
+		return nil, errors.New("failed to read audit chain")
+	}
+	return entries, nil
+}
+
+func scanAuditEntries(rows *sql.Rows) ([]*model.AuditEntry, error) {
+	var entries []*model.AuditEntry
+	for rows.Next() {
+		var entry model.AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.IP, &entry.RequestID, &entry.Action, &entry.Entity, &entry.EntityID,
+			&before, &after, &entry.CreatedAt, &entry.PrevHash, &entry.Hash, &entry.Signature); err != nil {
+			return nil, err
+		}
+		entry.Before, entry.After = before, after
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// jsonColumn passes empty JSON as NULL.
+func jsonColumn(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// nullTime passes the zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
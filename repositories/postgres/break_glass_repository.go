@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	BREAK_GLASS_COLUMNS = "id, actor, role_id, role, justification, started_at, expires_at, ended_at, ended_by"
+	ADD_BREAK_GLASS     = `
+        INSERT INTO break_glass (id, actor, role_id, role, justification, started_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+	END_BREAK_GLASS    = "UPDATE break_glass SET ended_at = $2, ended_by = $3 WHERE id = $1 AND ended_at IS NULL"
+	FIND_BREAK_GLASSES = `
+        SELECT ` + BREAK_GLASS_COLUMNS + `
+        FROM break_glass
+        WHERE NOT $1 OR ended_at IS NULL
+        ORDER BY started_at DESC
+    `
+	FIND_BREAK_GLASS = `
+        SELECT ` + BREAK_GLASS_COLUMNS + `
+        FROM break_glass
+        WHERE id = $1
+    `
+	FIND_ACTIVE_BREAK_GLASS = `
+        SELECT ` + BREAK_GLASS_COLUMNS + `
+        FROM break_glass
+        WHERE actor = $1 AND ended_at IS NULL
+    `
+	FIND_EXPIRED_BREAK_GLASS = `
+        SELECT ` + BREAK_GLASS_COLUMNS + `
+        FROM break_glass
+        WHERE ended_at IS NULL AND expires_at <= now()
+        ORDER BY expires_at
+    `
+)
+
+type BreakGlass interface {
+	Add(*model.BreakGlass) (bool, error)
+	End(uuid.UUID, time.Time, string) (bool, error)
+	Find(bool) ([]*model.BreakGlass, error)
+	FindActive(string) (*model.BreakGlass, error)
+	FindByID(uuid.UUID) (*model.BreakGlass, error)
+	FindExpired() ([]*model.BreakGlass, error)
+}
+
+type breakGlass struct {
+	db DB
+}
+
+func NewBreakGlass(db DB) BreakGlass {
+	return &breakGlass{db: db}
+}
+
+// Add adds the access unless the actor has one active already, which it
+// reports with false.
+func (r *breakGlass) Add(b *model.BreakGlass) (bool, error) {
+	_, err := r.db.Exec(ADD_BREAK_GLASS, b.ID, b.Actor, b.RoleID, b.Role, b.Justification, b.StartedAt, b.ExpiresAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return false, nil
+		}
+		log.Printf("failed to execute db.Exec ADD_BREAK_GLASS: %v", err)
+		return false, errors.New("failed to add break-glass access")
+	}
+	return true, nil
+}
+
+// End ends the access unless it ended already, which it reports with false.
+func (r *breakGlass) End(id uuid.UUID, at time.Time, by string) (bool, error) {
+	res, err := r.db.Exec(END_BREAK_GLASS, id, at, by)
+	if err != nil {
+		log.Printf("failed to execute db.Exec END_BREAK_GLASS: %v", err)
+		return false, errors.New("failed to end break-glass access")
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Find returns break-glass accesses, only those not ended if active is set.
+func (r *breakGlass) Find(active bool) ([]*model.BreakGlass, error) {
+	return r.find(FIND_BREAK_GLASSES, "FIND_BREAK_GLASSES", active)
+}
+
+// FindActive returns the access of the actor that did not end, nil if there
+// is none.
+func (r *breakGlass) FindActive(actor string) (*model.BreakGlass, error) {
+	b, err := scanBreakGlass(r.db.QueryRow(FIND_ACTIVE_BREAK_GLASS, actor))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_ACTIVE_BREAK_GLASS: %v", err)
+		return nil, errors.New("failed to find break-glass access")
+	}
+	return b, nil
+}
+
+func (r *breakGlass) FindByID(id uuid.UUID) (*model.BreakGlass, error) {
+	b, err := scanBreakGlass(r.db.QueryRow(FIND_BREAK_GLASS, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("break-glass access not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_BREAK_GLASS: %v", err)
+		return nil, errors.New("failed to find break-glass access")
+	}
+	return b, nil
+}
+
+// FindExpired returns the accesses past their expiry that did not end yet.
+func (r *breakGlass) FindExpired() ([]*model.BreakGlass, error) {
+	return r.find(FIND_EXPIRED_BREAK_GLASS, "FIND_EXPIRED_BREAK_GLASS")
+}
+
+func (r *breakGlass) find(query, name string, args ...any) ([]*model.BreakGlass, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("failed to execute db.Query %s: %v", name, err)
+		return nil, errors.New("failed to find break-glass access")
+	}
+	defer rows.Close()
+
+	var res []*model.BreakGlass
+	for rows.Next() {
+		b, err := scanBreakGlass(rows)
+		if err != nil {
+			log.Printf("failed to scan %s record: %v", name, err)
+			return nil, errors.New("failed to find break-glass access")
+		}
+		res = append(res, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over break-glass access: %v", err)
+		return nil, errors.New("failed to find break-glass access")
+	}
+
+	return res, nil
+}
+
+func scanBreakGlass(row rowScanner) (*model.BreakGlass, error) {
+	var b model.BreakGlass
+	var endedAt sql.NullTime
+	if err := row.Scan(&b.ID, &b.Actor, &b.RoleID, &b.Role, &b.Justification, &b.StartedAt, &b.ExpiresAt, &endedAt, &b.EndedBy); err != nil {
+		return nil, err
+	}
+
+	if endedAt.Valid {
+		b.EndedAt = &endedAt.Time
+	}
+	return &b, nil
+}
@@ -0,0 +1,243 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Change sets are updated only if their version is still the one read, so
+// concurrent edits, approvals and publishes cannot overwrite each other.
+const (
+	CHANGE_SET_COLUMNS = `id, title, description, status, author, contributors, operations, version, created_at, updated_at,
+            approved_by, approved_at, published_by, published_at, revision`
+	ADD_CHANGE_SET = `
+        INSERT INTO change_sets (id, title, description, status, author, contributors, operations)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING version, created_at, updated_at
+    `
+	FIND_CHANGE_SETS = `
+        SELECT ` + CHANGE_SET_COLUMNS + ` FROM change_sets
+        WHERE ($1::text = '' OR status = $1)
+        ORDER BY created_at DESC
+    `
+	FIND_CHANGE_SET   = "SELECT " + CHANGE_SET_COLUMNS + " FROM change_sets WHERE id = $1"
+	UPDATE_CHANGE_SET = `
+        UPDATE change_sets SET title = $3, description = $4, status = $5, operations = $6, approved_by = $7, approved_at = $8,
+            contributors = $9, version = version + 1, updated_at = now()
+        WHERE id = $1 AND version = $2
+        RETURNING version, updated_at
+    `
+	PUBLISH_CHANGE_SET = `
+        UPDATE change_sets SET status = $3, published_by = $4, published_at = now(), revision = $5,
+            version = version + 1, updated_at = now()
+        WHERE id = $1 AND version = $2
+        RETURNING version, updated_at, published_at
+    `
+)
+
+type ChangeSets interface {
+	Add(*model.ChangeSet) error
+	Find(string) ([]*model.ChangeSet, error)
+	FindByID(uuid.UUID) (*model.ChangeSet, error)
+	Publish(*model.ChangeSet, func(*model.PolicySnapshot) error) (bool, error)
+	Update(*model.ChangeSet) (bool, error)
+}
+
+type changeSets struct {
+	db DB
+}
+
+func NewChangeSets(db DB) ChangeSets {
+	return &changeSets{db: db}
+}
+
+func (r *changeSets) Add(cs *model.ChangeSet) error {
+	operations, err := json.Marshal(cs.Operations)
+	if err != nil {
+		log.Printf("failed to marshal change set operations: %v", err)
+		return errors.New("failed to add change set")
+	}
+
+	err = r.db.QueryRow(ADD_CHANGE_SET, cs.ID, cs.Title, cs.Description, cs.Status, cs.Author, pq.Array(cs.Contributors), operations).
+		Scan(&cs.Version, &cs.CreatedAt, &cs.UpdatedAt)
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow ADD_CHANGE_SET: %v", err)
+		return errors.New("failed to add change set")
+	}
+	return nil
+}
+
+func (r *changeSets) Find(status string) ([]*model.ChangeSet, error) {
+	rows, err := r.db.Query(FIND_CHANGE_SETS, status)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_CHANGE_SETS: %v", err)
+		return nil, errors.New("failed to find change sets")
+	}
+	defer rows.Close()
+
+	var res []*model.ChangeSet
+	for rows.Next() {
+		cs, err := scanChangeSet(rows)
+		if err != nil {
+			log.Printf("failed to scan FIND_CHANGE_SETS record: %v", err)
+			return nil, errors.New("failed to find change sets")
+		}
+		res = append(res, cs)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over change sets: %v", err)
+		return nil, errors.New("failed to find change sets")
+	}
+
+	return res, nil
+}
+
+func (r *changeSets) FindByID(id uuid.UUID) (*model.ChangeSet, error) {
+	cs, err := scanChangeSet(r.db.QueryRow(FIND_CHANGE_SET, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("change set not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_CHANGE_SET: %v", err)
+		return nil, errors.New("failed to find change set")
+	}
+	return cs, nil
+}
+
+// Publish applies the operations of the change set to the live policy, with
+// the policy tables locked, after check accepted the live policy. The policy
+// is recorded as a new revision and the change set is saved with its status
+// and publisher, all in one transaction. It reports false, publishing
+// nothing, when the change set changed since it was read.
+func (r *changeSets) Publish(cs *model.ChangeSet, check func(*model.PolicySnapshot) error) (bool, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return false, errors.New("failed to publish change set")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_POLICY); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_POLICY: %v", err)
+		return false, errors.New("failed to publish change set")
+	}
+
+	live, err := scanSnapshot(tx.QueryRow(POLICY_SNAPSHOT))
+	if err != nil {
+		log.Printf("failed to execute tx.QueryRow POLICY_SNAPSHOT: %v", err)
+		return false, errors.New("failed to publish change set")
+	}
+
+	if err := check(live); err != nil {
+		return false, err
+	}
+
+	for i, op := range cs.Operations {
+		if err := applyChange(tx, op); err != nil {
+			log.Printf("failed to apply operation %d of change set %s: %v", i, cs.ID, err)
+			return false, errors.New("failed to publish change set, the policy was left unchanged")
+		}
+	}
+
+	rev, err := addRevision(tx, cs.PublishedBy, "publish change set "+cs.ID.String()+": "+cs.Title, true)
+	if err != nil {
+		return false, err
+	}
+	cs.Revision = rev.Revision
+
+	var publishedAt sql.NullTime
+	err = tx.QueryRow(PUBLISH_CHANGE_SET, cs.ID, cs.Version, cs.Status, cs.PublishedBy, cs.Revision).
+		Scan(&cs.Version, &cs.UpdatedAt, &publishedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute tx.QueryRow PUBLISH_CHANGE_SET: %v", err)
+		return false, errors.New("failed to publish change set")
+	}
+	cs.PublishedAt = &publishedAt.Time
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit change set: %v", err)
+		return false, errors.New("failed to publish change set")
+	}
+	return true, nil
+}
+
+// Update saves the change set and reports false if it changed since it was
+// read.
+func (r *changeSets) Update(cs *model.ChangeSet) (bool, error) {
+	operations, err := json.Marshal(cs.Operations)
+	if err != nil {
+		log.Printf("failed to marshal change set operations: %v", err)
+		return false, errors.New("failed to update change set")
+	}
+
+	err = r.db.QueryRow(UPDATE_CHANGE_SET, cs.ID, cs.Version, cs.Title, cs.Description, cs.Status, operations,
+		cs.ApprovedBy, cs.ApprovedAt, pq.Array(cs.Contributors)).Scan(&cs.Version, &cs.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow UPDATE_CHANGE_SET: %v", err)
+		return false, errors.New("failed to update change set")
+	}
+	return true, nil
+}
+
+// applyChange runs one operation with the statements of the repositories of
+// roles, routes and bindings.
+func applyChange(tx Tx, op model.ChangeOperation) error {
+	var err error
+	switch {
+	case op.Role != nil && op.Op == model.ChangeAdd:
+		_, err = tx.Exec(ADD_ROLE, op.Role.ID, op.Role.Name)
+	case op.Role != nil && op.Op == model.ChangeUpdate:
+		_, err = tx.Exec(UPDATE_ROLE, op.Role.ID, op.Role.Name)
+	case op.Role != nil && op.Op == model.ChangeDelete:
+		_, err = tx.Exec(DELETE_ROLE, op.Role.ID)
+	case op.Route != nil && op.Op == model.ChangeAdd:
+		_, err = tx.Exec(ADD_ROUTE, op.Route.ID, op.Route.Method, op.Route.Host, op.Route.Path, op.Route.Service, op.Route.Active)
+	case op.Route != nil && op.Op == model.ChangeUpdate:
+		_, err = tx.Exec(UPDATE_ROUTE, op.Route.ID, op.Route.Method, op.Route.Host, op.Route.Path, op.Route.Service, op.Route.Active)
+	case op.Route != nil && op.Op == model.ChangeDelete:
+		_, err = tx.Exec(DELETE_ROUTE, op.Route.ID)
+	case op.Rbac != nil && op.Op == model.ChangeAdd:
+		_, err = tx.Exec(ADD_RBAC, op.Rbac.RouteID, op.Rbac.RoleID)
+	case op.Rbac != nil && op.Op == model.ChangeDelete:
+		_, err = tx.Exec(DELETE_RBAC, op.Rbac.RouteID, op.Rbac.RoleID)
+	default:
+		err = errors.New("unsupported operation " + op.Op)
+	}
+	return err
+}
+
+func scanChangeSet(row rowScanner) (*model.ChangeSet, error) {
+	var cs model.ChangeSet
+	var operations []byte
+	var approvedAt, publishedAt sql.NullTime
+	var revision sql.NullInt64
+	if err := row.Scan(&cs.ID, &cs.Title, &cs.Description, &cs.Status, &cs.Author, pq.Array(&cs.Contributors), &operations, &cs.Version, &cs.CreatedAt,
+		&cs.UpdatedAt, &cs.ApprovedBy, &approvedAt, &cs.PublishedBy, &publishedAt, &revision); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(operations, &cs.Operations); err != nil {
+		return nil, err
+	}
+	if approvedAt.Valid {
+		cs.ApprovedAt = &approvedAt.Time
+	}
+	if publishedAt.Valid {
+		cs.PublishedAt = &publishedAt.Time
+	}
+	cs.Revision = revision.Int64
+	return &cs, nil
+}
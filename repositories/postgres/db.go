@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// DB is what repositories run their statements on: the database or, inside
+// Atomic, the transaction of the operation.
+type DB interface {
+	Exec(string, ...any) (sql.Result, error)
+	Prepare(string) (*sql.Stmt, error)
+	Query(string, ...any) (*sql.Rows, error)
+	QueryRow(string, ...any) *sql.Row
+}
+
+// Tx is a transaction begun on a DB, a savepoint inside Atomic.
+type Tx interface {
+	DB
+	Commit() error
+	Rollback() error
+}
+
+// Atomic runs fn in one transaction, committed if fn returns nil. Repositories
+// created on the DB fn gets run in the transaction, their own transactions
+// become savepoints of it.
+func Atomic(db *sql.DB, fn func(DB) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := fn(&transaction{Tx: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit transaction: %v", err)
+		return errors.New("failed to commit transaction")
+	}
+	return nil
+}
+
+// begin begins a transaction on the database or a savepoint in the
+// transaction of Atomic.
+func begin(db DB) (Tx, error) {
+	switch db := db.(type) {
+	case *sql.DB:
+		return db.Begin()
+	case *transaction:
+		return db.savepoint()
+	}
+	return nil, fmt.Errorf("cannot begin a transaction on %T", db)
+}
+
+type transaction struct {
+	*sql.Tx
+	savepoints int
+}
+
+func (t *transaction) savepoint() (Tx, error) {
+	t.savepoints++
+	sp := &savepoint{Tx: t.Tx, name: "sp" + strconv.Itoa(t.savepoints)}
+	if _, err := t.Exec("SAVEPOINT " + sp.name); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// savepoint releases on Commit and rolls back to where it was taken on
+// Rollback, so a failed repository call leaves the transaction usable.
+type savepoint struct {
+	*sql.Tx
+	name string
+	done bool
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Exec("RELEASE SAVEPOINT " + s.name)
+	return err
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+	_, err := s.Exec("ROLLBACK TO SAVEPOINT " + s.name)
+	return err
+}
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	ADD_DECISION = `
+        INSERT INTO decision_log (id, time, source, request_id, subject, roles, role_ids, service, method, host, path,
+            route_id, route, effect, reason, latency_us, sample_rate)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+    `
+	// Decisions logged before role IDs were, or with redacted roles, do not
+	// tell which bindings they used.
+	FIRST_DECISION = "SELECT min(time) FROM decision_log WHERE role_ids IS NOT NULL"
+	ALLOWED_ROLE   = `
+        SELECT EXISTS (SELECT 1 FROM decision_log WHERE time >= $1 AND effect = 'allow' AND $2 = ANY(roles))
+    `
+	// A binding is used when the route allowed a request by the role of the
+	// binding.
+	FIND_UNUSED_BINDINGS = `
+        SELECT roles.id, roles.name, routes.id, routes.method, routes.host, routes.path, routes.service, routes.active, last.time
+        FROM rbac
+        INNER JOIN roles ON roles.id = rbac.role_id
+        INNER JOIN routes ON routes.id = rbac.route_id
+        LEFT JOIN LATERAL (
+            SELECT max(d.time) AS time FROM decision_log AS d
+            WHERE d.route_id = rbac.route_id AND d.effect = 'allow' AND rbac.role_id = ANY(d.role_ids)
+        ) AS last ON true
+        WHERE (last.time IS NULL OR last.time < $1) AND ($2::uuid IS NULL OR rbac.role_id = $2)
+        ORDER BY roles.name, routes.service, routes.path, routes.method
+    `
+	FIND_DECISIONS = `
+        SELECT id, time, source, request_id, subject, roles, role_ids, service, method, host, path,
+            route_id, route, effect, reason, latency_us, sample_rate
+        FROM decision_log
+        WHERE ($1::text = '' OR subject = $1)
+            AND ($2::text = '' OR $2 = ANY(roles))
+            AND ($3::text = '' OR service = $3)
+            AND ($4::text = '' OR effect = $4)
+            AND ($5::uuid IS NULL OR route_id = $5)
+            AND ($6::timestamptz IS NULL OR time >= $6)
+            AND ($7::timestamptz IS NULL OR time < $7)
+        ORDER BY time DESC
+        LIMIT $8
+    `
+)
+
+type Decisions interface {
+	Add(*model.DecisionLog) error
+	AllowedRole(time.Time, string) (bool, error)
+	Find(model.DecisionFilter) ([]*model.DecisionLog, error)
+	FindFirst() (*time.Time, error)
+	FindUnused(time.Time, uuid.UUID) ([]model.UnusedBinding, error)
+}
+
+type decisions struct {
+	db DB
+}
+
+func NewDecisions(db DB) Decisions {
+	return &decisions{db: db}
+}
+
+func (r *decisions) Add(d *model.DecisionLog) error {
+	roles := pq.StringArray(d.Roles)
+	if roles == nil {
+		roles = pq.StringArray{}
+	}
+
+	_, err := r.db.Exec(ADD_DECISION, d.ID, d.Time, d.Source, d.RequestID, d.Subject, roles, uuidArray(d.RoleIDs), d.Service, d.Method, d.Host, d.Path,
+		d.RouteID, d.Route, d.Effect, d.Reason, d.LatencyUS, d.SampleRate)
+	if err != nil {
+		log.Printf("failed to execute db.Exec ADD_DECISION: %v", err)
+		return errors.New("failed to log decision")
+	}
+	return nil
+}
+
+func (r *decisions) Find(filter model.DecisionFilter) ([]*model.DecisionLog, error) {
+	rows, err := r.db.Query(FIND_DECISIONS, filter.Subject, filter.Role, filter.Service, filter.Effect, nullUUID(filter.RouteID),
+		nullTime(filter.From), nullTime(filter.To), filter.Limit)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_DECISIONS: %v", err)
+		return nil, errors.New("failed to find decisions")
+	}
+	defer rows.Close()
+
+	var res []*model.DecisionLog
+	for rows.Next() {
+		var d model.DecisionLog
+		var roles, roleIDs pq.StringArray
+		if err := rows.Scan(&d.ID, &d.Time, &d.Source, &d.RequestID, &d.Subject, &roles, &roleIDs, &d.Service, &d.Method, &d.Host, &d.Path,
+			&d.RouteID, &d.Route, &d.Effect, &d.Reason, &d.LatencyUS, &d.SampleRate); err != nil {
+			log.Printf("failed to scan FIND_DECISIONS record: %v", err)
+			return nil, errors.New("failed to find decisions")
+		}
+		d.Roles = roles
+		for _, id := range roleIDs {
+			roleID, err := uuid.Parse(id)
+			if err != nil {
+				log.Printf("failed to parse role ID of decision %s: %v", d.ID, err)
+				return nil, errors.New("failed to find decisions")
+			}
+			d.RoleIDs = append(d.RoleIDs, roleID)
+		}
+		res = append(res, &d)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over decisions: %v", err)
+		return nil, errors.New("failed to find decisions")
+	}
+
+	return res, nil
+}
+
+// AllowedRole tells whether an allow was logged since the time for a request
+// with the role.
+func (r *decisions) AllowedRole(since time.Time, role string) (bool, error) {
+	var allowed bool
+	if err := r.db.QueryRow(ALLOWED_ROLE, since, role).Scan(&allowed); err != nil {
+		log.Printf("failed to execute db.QueryRow ALLOWED_ROLE: %v", err)
+		return false, errors.New("failed to find decisions")
+	}
+	return allowed, nil
+}
+
+// FindFirst returns the time of the first decision logged with the IDs of
+// its roles, nil if none was.
+func (r *decisions) FindFirst() (*time.Time, error) {
+	var first sql.NullTime
+	if err := r.db.QueryRow(FIRST_DECISION).Scan(&first); err != nil {
+		log.Printf("failed to execute db.QueryRow FIRST_DECISION: %v", err)
+		return nil, errors.New("failed to find first decision")
+	}
+	if !first.Valid {
+		return nil, nil
+	}
+	return &first.Time, nil
+}
+
+// FindUnused returns the bindings, of the role if one is given, that no
+// logged decision used since the time.
+func (r *decisions) FindUnused(since time.Time, roleID uuid.UUID) ([]model.UnusedBinding, error) {
+	rows, err := r.db.Query(FIND_UNUSED_BINDINGS, since, nullUUID(roleID))
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_UNUSED_BINDINGS: %v", err)
+		return nil, errors.New("failed to find unused bindings")
+	}
+	defer rows.Close()
+
+	var res []model.UnusedBinding
+	for rows.Next() {
+		var b model.UnusedBinding
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&b.Role.ID, &b.Role.Name, &b.Route.ID, &b.Route.Method, &b.Route.Host, &b.Route.Path, &b.Route.Service, &b.Route.Active, &lastUsed); err != nil {
+			log.Printf("failed to scan FIND_UNUSED_BINDINGS record: %v", err)
+			return nil, errors.New("failed to find unused bindings")
+		}
+		if lastUsed.Valid {
+			b.LastUsed = &lastUsed.Time
+		}
+		res = append(res, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over bindings: %v", err)
+		return nil, errors.New("failed to find unused bindings")
+	}
+
+	return res, nil
+}
+
+// uuidArray passes nil IDs as NULL.
+func uuidArray(ids []uuid.UUID) any {
+	if ids == nil {
+		return nil
+	}
+	arr := make(pq.StringArray, len(ids))
+	for i, id := range ids {
+		arr[i] = id.String()
+	}
+	return arr
+}
+
+// nullUUID passes the nil UUID as NULL.
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
@@ -1,30 +1,32 @@
 package postgres
 
 import (
-	"database/sql"
 	"errors"
 	"log"
 
 	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
 )
 
 const (
 	ADD_RBAC    = "INSERT INTO rbac (route_id, role_id) VALUES ($1, $2) ON CONFLICT (route_id, role_id) DO NOTHING;"
+	COPY_RBAC   = "INSERT INTO rbac (route_id, role_id) SELECT $2, role_id FROM rbac WHERE route_id = $1 ON CONFLICT (route_id, role_id) DO NOTHING;"
 	DELETE_RBAC = "DELETE FROM rbac WHERE route_id = $1 AND role_id = $2;"
-	FIND_RBAC   = "SELECT route_id, role_id FROM rbac;"
+	FIND_RBAC   = "SELECT route_id, role_id, rule_id FROM rbac;"
 )
 
 type Rbac interface {
 	Add(*model.Rbac) error
+	Copy(uuid.UUID, uuid.UUID) error
 	Delete(*model.Rbac) error
 	Find() ([]*model.Rbac, error)
 }
 
 type rbac struct {
-	db *sql.DB
+	db DB
 }
 
-func NewRbac(db *sql.DB) Rbac {
+func NewRbac(db DB) Rbac {
 	return &rbac{db: db}
 }
 
@@ -37,6 +39,15 @@ func (r *rbac) Add(rbac *model.Rbac) error {
 	return nil
 }
 
+func (r *rbac) Copy(fromRouteID, toRouteID uuid.UUID) error {
+	_, err := r.db.Exec(COPY_RBAC, fromRouteID, toRouteID)
+	if err != nil {
+		log.Printf("failed to execute db.Exec COPY_RBAC: %v", err)
+		return errors.New("failed to copy rbac records")
+	}
+	return nil
+}
+
 func (r *rbac) Delete(rbac *model.Rbac) error {
 	_, err := r.db.Exec(DELETE_RBAC, rbac.RouteID, rbac.RoleID)
 	if err != nil {
@@ -58,10 +69,14 @@ func (r *rbac) Find() ([]*model.Rbac, error) {
 	var rbacs []*model.Rbac
 	for rows.Next() {
 		var rbac model.Rbac
-		if err := rows.Scan(&rbac.RouteID, &rbac.RoleID); err != nil {
+		var ruleID uuid.NullUUID
+		if err := rows.Scan(&rbac.RouteID, &rbac.RoleID, &ruleID); err != nil {
 			log.Printf("failed to scan FIND_RBAC rows: %v", err)
 			return nil, errors.New("failed to find rbac records")
 		}
+		if ruleID.Valid {
+			rbac.RuleID = &ruleID.UUID
+		}
 		rbacs = append(rbacs, &rbac)
 	}
 
@@ -0,0 +1,308 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Routes are resources of type http_route, the queries below read them from
+// the routes table and their grants from the rbac table.
+const (
+	ADD_RESOURCE = `
+        INSERT INTO resources (id, type, name, service, description, actions)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `
+	DELETE_RESOURCE = "DELETE FROM resources WHERE id = $1"
+	ALL_RESOURCES   = `
+        SELECT id, type, name, service, description, actions FROM resources
+        UNION ALL
+        SELECT id, 'http_route', method || ' ' || host || path, service, '', ARRAY['access'] FROM routes
+    `
+	FIND_RESOURCES = `
+        SELECT id, type, name, service, description, actions FROM (` + ALL_RESOURCES + `) AS r
+        WHERE ($1::text = '' OR type = $1) AND ($2::text = '' OR service = $2)
+        ORDER BY type, service, name
+    `
+	FIND_RESOURCE_BY_ID = `
+        SELECT id, type, name, service, description, actions FROM (` + ALL_RESOURCES + `) AS r
+        WHERE id = $1
+    `
+	ALL_PERMISSIONS = `
+        SELECT resource_id, role_id, action FROM resource_permissions
+        UNION ALL
+        SELECT route_id, role_id, 'access' FROM rbac
+    `
+	FIND_RESOURCE_ROLES = `
+        SELECT roles.id, roles.name, array_agg(p.action ORDER BY p.action)
+        FROM (` + ALL_PERMISSIONS + `) AS p
+        INNER JOIN roles ON roles.id = p.role_id
+        WHERE p.resource_id = $1
+        GROUP BY roles.id, roles.name
+        ORDER BY roles.name
+    `
+	FIND_ROLE_RESOURCES = `
+        SELECT r.id, r.type, r.name, r.service, r.description, r.actions, array_agg(p.action ORDER BY p.action)
+        FROM (` + ALL_PERMISSIONS + `) AS p
+        INNER JOIN (` + ALL_RESOURCES + `) AS r ON r.id = p.resource_id
+        WHERE p.role_id = $1
+        GROUP BY r.id, r.type, r.name, r.service, r.description, r.actions
+        ORDER BY r.type, r.service, r.name
+    `
+	FIND_RESOURCES_BY_ROLE_NAMES = `
+        SELECT resources.id, resources.type, resources.name, resources.service, resources.description, resources.actions,
+            array_agg(DISTINCT p.action ORDER BY p.action)
+        FROM resource_permissions AS p
+        INNER JOIN resources ON resources.id = p.resource_id
+        INNER JOIN roles ON roles.id = p.role_id
+        WHERE roles.name = ANY($1)
+        GROUP BY resources.id
+    `
+	GRANT_PERMISSION  = "INSERT INTO resource_permissions (resource_id, role_id, action) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING"
+	REVOKE_PERMISSION = "DELETE FROM resource_permissions WHERE resource_id = $1 AND role_id = $2 AND action = $3"
+	PRUNE_PERMISSIONS = `
+        DELETE FROM resource_permissions
+        WHERE resource_id = $1 AND NOT action = ANY($2)
+        RETURNING role_id, action
+    `
+	UPDATE_RESOURCE = `
+        UPDATE resources SET type = $2, name = $3, service = $4, description = $5, actions = $6
+        WHERE id = $1
+    `
+)
+
+type Resources interface {
+	Add(*model.Resource) error
+	Delete(uuid.UUID) error
+	Find(string, string) ([]*model.Resource, error)
+	FindByID(uuid.UUID) (*model.Resource, error)
+	FindByRole(uuid.UUID) ([]*model.ResourceActions, error)
+	FindByRoleNames([]string) ([]*model.ResourceActions, error)
+	FindRoles(uuid.UUID) ([]*model.RoleActions, error)
+	Grant(*model.Permission) error
+	Revoke(*model.Permission) error
+	Update(*model.Resource) ([]model.Permission, error)
+}
+
+type resources struct {
+	db DB
+}
+
+func NewResources(db DB) Resources {
+	return &resources{db: db}
+}
+
+func (r *resources) Add(resource *model.Resource) error {
+	_, err := r.db.Exec(ADD_RESOURCE, resource.ID, resource.Type, resource.Name, resource.Service, resource.Description, pq.Array(resource.Actions))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			log.Printf("duplicate key error on ADD_RESOURCE: %v", pqErr.Detail)
+			return errors.New("resource with the given type, name and service already exists")
+		}
+		log.Printf("failed to execute db.Exec ADD_RESOURCE: %v", err)
+		return errors.New("failed to add resource")
+	}
+	return nil
+}
+
+func (r *resources) Delete(id uuid.UUID) error {
+	_, err := r.db.Exec(DELETE_RESOURCE, id)
+	if err != nil {
+		log.Printf("failed to execute db.Exec DELETE_RESOURCE: %v", err)
+		return errors.New("failed to delete resource")
+	}
+	return nil
+}
+
+func (r *resources) Find(resourceType, service string) ([]*model.Resource, error) {
+	rows, err := r.db.Query(FIND_RESOURCES, resourceType, service)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_RESOURCES: %v", err)
+		return nil, errors.New("failed to find resources")
+	}
+	defer rows.Close()
+
+	var resources []*model.Resource
+	for rows.Next() {
+		resource, err := scanResource(rows)
+		if err != nil {
+			log.Printf("failed to scan FIND_RESOURCES record: %v", err)
+			return nil, errors.New("failed to find resources")
+		}
+		resources = append(resources, resource)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over resources: %v", err)
+		return nil, errors.New("failed to find resources")
+	}
+
+	return resources, nil
+}
+
+func (r *resources) FindByID(id uuid.UUID) (*model.Resource, error) {
+	resource, err := scanResource(r.db.QueryRow(FIND_RESOURCE_BY_ID, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("resource not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_RESOURCE_BY_ID: %v", err)
+		return nil, errors.New("failed to find resource")
+	}
+	return resource, nil
+}
+
+func (r *resources) FindByRole(roleID uuid.UUID) ([]*model.ResourceActions, error) {
+	res, err := r.findResourceActions(FIND_ROLE_RESOURCES, roleID)
+	if err != nil {
+		return nil, errors.New("failed to find resources for role")
+	}
+	return res, nil
+}
+
+// FindByRoleNames returns the resources, routes aside, any of the roles is
+// granted actions on.
+func (r *resources) FindByRoleNames(names []string) ([]*model.ResourceActions, error) {
+	res, err := r.findResourceActions(FIND_RESOURCES_BY_ROLE_NAMES, pq.Array(names))
+	if err != nil {
+		return nil, errors.New("failed to find resources for roles")
+	}
+	return res, nil
+}
+
+func (r *resources) FindRoles(resourceID uuid.UUID) ([]*model.RoleActions, error) {
+	rows, err := r.db.Query(FIND_RESOURCE_ROLES, resourceID)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_RESOURCE_ROLES: %v", err)
+		return nil, errors.New("failed to find roles for resource")
+	}
+	defer rows.Close()
+
+	var res []*model.RoleActions
+	for rows.Next() {
+		var ra model.RoleActions
+		var actions pq.StringArray
+		if err := rows.Scan(&ra.Role.ID, &ra.Role.Name, &actions); err != nil {
+			log.Printf("failed to scan FIND_RESOURCE_ROLES record: %v", err)
+			return nil, errors.New("failed to find roles for resource")
+		}
+		ra.Actions = actions
+		res = append(res, &ra)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over roles: %v", err)
+		return nil, errors.New("failed to find roles for resource")
+	}
+
+	return res, nil
+}
+
+func (r *resources) Grant(permission *model.Permission) error {
+	_, err := r.db.Exec(GRANT_PERMISSION, permission.ResourceID, permission.RoleID, permission.Action)
+	if err != nil {
+		log.Printf("failed to execute db.Exec GRANT_PERMISSION: %v", err)
+		return errors.New("failed to grant permission")
+	}
+	return nil
+}
+
+func (r *resources) Revoke(permission *model.Permission) error {
+	_, err := r.db.Exec(REVOKE_PERMISSION, permission.ResourceID, permission.RoleID, permission.Action)
+	if err != nil {
+		log.Printf("failed to execute db.Exec REVOKE_PERMISSION: %v", err)
+		return errors.New("failed to revoke permission")
+	}
+	return nil
+}
+
+// Update updates the resource and, in the same transaction, removes the
+// permissions granting actions it no longer has, which it returns.
+func (r *resources) Update(resource *model.Resource) ([]model.Permission, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return nil, errors.New("failed to update resource")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(UPDATE_RESOURCE, resource.ID, resource.Type, resource.Name, resource.Service, resource.Description, pq.Array(resource.Actions))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			log.Printf("duplicate key error on UPDATE_RESOURCE: %v", pqErr.Detail)
+			return nil, errors.New("resource with the given type, name and service already exists")
+		}
+		log.Printf("failed to execute tx.Exec UPDATE_RESOURCE: %v", err)
+		return nil, errors.New("failed to update resource")
+	}
+
+	rows, err := tx.Query(PRUNE_PERMISSIONS, resource.ID, pq.Array(resource.Actions))
+	if err != nil {
+		log.Printf("failed to execute tx.Query PRUNE_PERMISSIONS: %v", err)
+		return nil, errors.New("failed to update resource")
+	}
+	defer rows.Close()
+
+	var pruned []model.Permission
+	for rows.Next() {
+		p := model.Permission{ResourceID: resource.ID}
+		if err := rows.Scan(&p.RoleID, &p.Action); err != nil {
+			log.Printf("failed to scan PRUNE_PERMISSIONS record: %v", err)
+			return nil, errors.New("failed to update resource")
+		}
+		pruned = append(pruned, p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over pruned permissions: %v", err)
+		return nil, errors.New("failed to update resource")
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit resource update: %v", err)
+		return nil, errors.New("failed to update resource")
+	}
+	return pruned, nil
+}
+
+func (r *resources) findResourceActions(query string, args ...any) ([]*model.ResourceActions, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("failed to execute db.Query resource actions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*model.ResourceActions
+	for rows.Next() {
+		var ra model.ResourceActions
+		var actions, granted pq.StringArray
+		if err := rows.Scan(&ra.Resource.ID, &ra.Resource.Type, &ra.Resource.Name, &ra.Resource.Service, &ra.Resource.Description, &actions, &granted); err != nil {
+			log.Printf("failed to scan resource actions record: %v", err)
+			return nil, err
+		}
+		ra.Resource.Actions, ra.Actions = actions, granted
+		res = append(res, &ra)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over resources: %v", err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func scanResource(row rowScanner) (*model.Resource, error) {
+	var resource model.Resource
+	var actions pq.StringArray
+	if err := row.Scan(&resource.ID, &resource.Type, &resource.Name, &resource.Service, &resource.Description, &actions); err != nil {
+		return nil, err
+	}
+	resource.Actions = actions
+	return &resource, nil
+}
@@ -0,0 +1,316 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// Progress counts the decisions model.ReviewKeep, model.ReviewRevoke and
+	// model.ReviewPending.
+	REVIEW_PROGRESS_COLUMNS = `count(i.id), count(i.id) FILTER (WHERE i.decision = 'keep'),
+            count(i.id) FILTER (WHERE i.decision = 'revoke'), count(i.id) FILTER (WHERE i.decision = 'pending')`
+	REVIEW_CAMPAIGN_COLUMNS = `c.id, c.name, c.description, c.service, c.role_id, c.role, c.status, c.created_by, c.created_at,
+            c.due_at, c.closed_by, c.closed_at, ` + REVIEW_PROGRESS_COLUMNS
+	REVIEW_ITEM_COLUMNS = `id, campaign_id, route_id, method, host, path, service, role_id, role, reviewer, decision, comment,
+            decided_by, decided_at, result`
+
+	ADD_REVIEW_CAMPAIGN = `
+        INSERT INTO review_campaigns (id, name, description, service, role_id, role, status, created_by, due_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING created_at
+    `
+	ADD_REVIEW_ITEM = `
+        INSERT INTO review_items (` + REVIEW_ITEM_COLUMNS + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+    `
+	// A campaign is closed only if its status is still the one read.
+	CLOSE_REVIEW_CAMPAIGN = `
+        UPDATE review_campaigns SET status = $3, closed_by = $4, closed_at = $5
+        WHERE id = $1 AND status = $2
+    `
+	// Items are decided and reassigned only while the campaign has the
+	// status.
+	DECIDE_REVIEW_ITEM = `
+        UPDATE review_items SET decision = $4, comment = $5, decided_by = $6, decided_at = $7
+        WHERE id = $1 AND campaign_id = $2
+            AND EXISTS (SELECT 1 FROM review_campaigns WHERE id = $2 AND status = $3)
+    `
+	REASSIGN_REVIEW_ITEMS = `
+        UPDATE review_items SET reviewer = $4
+        WHERE campaign_id = $1 AND reviewer = $3 AND decision = 'pending'
+            AND EXISTS (SELECT 1 FROM review_campaigns WHERE id = $1 AND status = $2)
+    `
+	SET_REVIEW_RESULT     = "UPDATE review_items SET result = $2 WHERE id = $1"
+	FIND_REVIEW_CAMPAIGNS = `
+        SELECT ` + REVIEW_CAMPAIGN_COLUMNS + `
+        FROM review_campaigns AS c
+        LEFT JOIN review_items AS i ON i.campaign_id = c.id
+        WHERE $1::text = '' OR c.status = $1
+        GROUP BY c.id
+        ORDER BY c.created_at DESC
+    `
+	FIND_REVIEW_CAMPAIGN = `
+        SELECT ` + REVIEW_CAMPAIGN_COLUMNS + `
+        FROM review_campaigns AS c
+        LEFT JOIN review_items AS i ON i.campaign_id = c.id
+        WHERE c.id = $1
+        GROUP BY c.id
+    `
+	FIND_REVIEW_ITEMS = `
+        SELECT ` + REVIEW_ITEM_COLUMNS + `
+        FROM review_items
+        WHERE campaign_id = $1 AND ($2::text = '' OR reviewer = $2) AND ($3::text = '' OR decision = $3)
+        ORDER BY service, path, method, role
+    `
+	FIND_REVIEW_PROGRESS = `
+        SELECT i.reviewer, ` + REVIEW_PROGRESS_COLUMNS + `
+        FROM review_items AS i
+        WHERE i.campaign_id = $1
+        GROUP BY i.reviewer
+        ORDER BY i.reviewer
+    `
+)
+
+type Reviews interface {
+	Add(*model.ReviewCampaign, []*model.ReviewItem) error
+	Close(*model.ReviewCampaign, string) (bool, error)
+	Decide(uuid.UUID, string, []*model.ReviewItem) (bool, error)
+	Find(string) ([]*model.ReviewCampaign, error)
+	FindByID(uuid.UUID) (*model.ReviewCampaign, error)
+	FindItems(uuid.UUID, model.ReviewItemFilter) ([]*model.ReviewItem, error)
+	FindProgress(uuid.UUID) ([]model.ReviewProgress, error)
+	Reassign(uuid.UUID, string, string, string) (int64, error)
+	SetResult(uuid.UUID, string) error
+}
+
+type reviews struct {
+	db DB
+}
+
+func NewReviews(db DB) Reviews {
+	return &reviews{db: db}
+}
+
+// Add stores the campaign together with its items.
+func (r *reviews) Add(c *model.ReviewCampaign, items []*model.ReviewItem) error {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to add review campaign")
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(ADD_REVIEW_CAMPAIGN, c.ID, c.Name, c.Description, c.Service, c.RoleID, c.Role, c.Status, c.CreatedBy, c.DueAt).
+		Scan(&c.CreatedAt)
+	if err != nil {
+		log.Printf("failed to execute tx.QueryRow ADD_REVIEW_CAMPAIGN: %v", err)
+		return errors.New("failed to add review campaign")
+	}
+
+	stmt, err := tx.Prepare(ADD_REVIEW_ITEM)
+	if err != nil {
+		log.Printf("failed to prepare ADD_REVIEW_ITEM: %v", err)
+		return errors.New("failed to add review campaign")
+	}
+	defer stmt.Close()
+
+	for _, i := range items {
+		_, err := stmt.Exec(i.ID, i.CampaignID, i.RouteID, i.Method, i.Host, i.Path, i.Service, i.RoleID, i.Role, i.Reviewer,
+			i.Decision, i.Comment, i.DecidedBy, i.DecidedAt, i.Result)
+		if err != nil {
+			log.Printf("failed to execute stmt.Exec ADD_REVIEW_ITEM: %v", err)
+			return errors.New("failed to add review campaign")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit review campaign: %v", err)
+		return errors.New("failed to add review campaign")
+	}
+	return nil
+}
+
+// Close saves the status and closing of the campaign and reports false if
+// its status is no longer from.
+func (r *reviews) Close(c *model.ReviewCampaign, from string) (bool, error) {
+	res, err := r.db.Exec(CLOSE_REVIEW_CAMPAIGN, c.ID, from, c.Status, c.ClosedBy, c.ClosedAt)
+	if err != nil {
+		log.Printf("failed to execute db.Exec CLOSE_REVIEW_CAMPAIGN: %v", err)
+		return false, errors.New("failed to close review campaign")
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Decide saves the decisions of the items in one transaction. It reports
+// false and saves nothing if the campaign no longer has the status or an
+// item is not part of it.
+func (r *reviews) Decide(campaignID uuid.UUID, status string, items []*model.ReviewItem) (bool, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return false, errors.New("failed to decide review items")
+	}
+	defer tx.Rollback()
+
+	for _, i := range items {
+		res, err := tx.Exec(DECIDE_REVIEW_ITEM, i.ID, campaignID, status, i.Decision, i.Comment, i.DecidedBy, i.DecidedAt)
+		if err != nil {
+			log.Printf("failed to execute tx.Exec DECIDE_REVIEW_ITEM: %v", err)
+			return false, errors.New("failed to decide review items")
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return false, nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit review decisions: %v", err)
+		return false, errors.New("failed to decide review items")
+	}
+	return true, nil
+}
+
+// Find returns the campaigns with the status, all if empty, newest first.
+func (r *reviews) Find(status string) ([]*model.ReviewCampaign, error) {
+	rows, err := r.db.Query(FIND_REVIEW_CAMPAIGNS, status)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_REVIEW_CAMPAIGNS: %v", err)
+		return nil, errors.New("failed to find review campaigns")
+	}
+	defer rows.Close()
+
+	var res []*model.ReviewCampaign
+	for rows.Next() {
+		c, err := scanReviewCampaign(rows)
+		if err != nil {
+			log.Printf("failed to scan FIND_REVIEW_CAMPAIGNS record: %v", err)
+			return nil, errors.New("failed to find review campaigns")
+		}
+		res = append(res, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over review campaigns: %v", err)
+		return nil, errors.New("failed to find review campaigns")
+	}
+
+	return res, nil
+}
+
+func (r *reviews) FindByID(id uuid.UUID) (*model.ReviewCampaign, error) {
+	c, err := scanReviewCampaign(r.db.QueryRow(FIND_REVIEW_CAMPAIGN, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("review campaign not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_REVIEW_CAMPAIGN: %v", err)
+		return nil, errors.New("failed to find review campaign")
+	}
+	return c, nil
+}
+
+func (r *reviews) FindItems(campaignID uuid.UUID, filter model.ReviewItemFilter) ([]*model.ReviewItem, error) {
+	rows, err := r.db.Query(FIND_REVIEW_ITEMS, campaignID, filter.Reviewer, filter.Decision)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_REVIEW_ITEMS: %v", err)
+		return nil, errors.New("failed to find review items")
+	}
+	defer rows.Close()
+
+	var res []*model.ReviewItem
+	for rows.Next() {
+		var i model.ReviewItem
+		var decidedAt sql.NullTime
+		if err := rows.Scan(&i.ID, &i.CampaignID, &i.RouteID, &i.Method, &i.Host, &i.Path, &i.Service, &i.RoleID, &i.Role,
+			&i.Reviewer, &i.Decision, &i.Comment, &i.DecidedBy, &decidedAt, &i.Result); err != nil {
+			log.Printf("failed to scan FIND_REVIEW_ITEMS record: %v", err)
+			return nil, errors.New("failed to find review items")
+		}
+		if decidedAt.Valid {
+			i.DecidedAt = &decidedAt.Time
+		}
+		res = append(res, &i)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over review items: %v", err)
+		return nil, errors.New("failed to find review items")
+	}
+
+	return res, nil
+}
+
+// FindProgress returns the progress of each reviewer of the campaign.
+func (r *reviews) FindProgress(campaignID uuid.UUID) ([]model.ReviewProgress, error) {
+	rows, err := r.db.Query(FIND_REVIEW_PROGRESS, campaignID)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_REVIEW_PROGRESS: %v", err)
+		return nil, errors.New("failed to find review progress")
+	}
+	defer rows.Close()
+
+	res := []model.ReviewProgress{}
+	for rows.Next() {
+		var p model.ReviewProgress
+		if err := rows.Scan(&p.Reviewer, &p.Total, &p.Kept, &p.Revoked, &p.Pending); err != nil {
+			log.Printf("failed to scan FIND_REVIEW_PROGRESS record: %v", err)
+			return nil, errors.New("failed to find review progress")
+		}
+		res = append(res, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over review progress: %v", err)
+		return nil, errors.New("failed to find review progress")
+	}
+
+	return res, nil
+}
+
+// Reassign moves the pending items of a reviewer to another while the
+// campaign has the status and returns how many were moved.
+func (r *reviews) Reassign(campaignID uuid.UUID, status, from, to string) (int64, error) {
+	res, err := r.db.Exec(REASSIGN_REVIEW_ITEMS, campaignID, status, from, to)
+	if err != nil {
+		log.Printf("failed to execute db.Exec REASSIGN_REVIEW_ITEMS: %v", err)
+		return 0, errors.New("failed to reassign review items")
+	}
+
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+func (r *reviews) SetResult(itemID uuid.UUID, result string) error {
+	if _, err := r.db.Exec(SET_REVIEW_RESULT, itemID, result); err != nil {
+		log.Printf("failed to execute db.Exec SET_REVIEW_RESULT: %v", err)
+		return errors.New("failed to set review result")
+	}
+	return nil
+}
+
+func scanReviewCampaign(row rowScanner) (*model.ReviewCampaign, error) {
+	var c model.ReviewCampaign
+	var roleID uuid.NullUUID
+	var dueAt, closedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.Name, &c.Description, &c.Service, &roleID, &c.Role, &c.Status, &c.CreatedBy, &c.CreatedAt,
+		&dueAt, &c.ClosedBy, &closedAt, &c.Progress.Total, &c.Progress.Kept, &c.Progress.Revoked, &c.Progress.Pending); err != nil {
+		return nil, err
+	}
+	if roleID.Valid {
+		c.RoleID = &roleID.UUID
+	}
+	if dueAt.Valid {
+		c.DueAt = &dueAt.Time
+	}
+	if closedAt.Valid {
+		c.ClosedAt = &closedAt.Time
+	}
+	return &c, nil
+}
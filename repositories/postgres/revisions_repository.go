@@ -0,0 +1,356 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+// Snapshots hold the whole policy as built by POLICY_SNAPSHOT. A rollback
+// writes a snapshot back with the tables locked against concurrent changes,
+// registrations included, and records the result as a new revision. Roles and
+// routes missing from the snapshot are deleted only if nothing outside the
+// snapshot refers to them, deleting them would cascade into that data.
+const (
+	LOCK_REVISIONS  = "SELECT pg_advisory_xact_lock(hashtext('policy_revisions'))"
+	LOCK_POLICY     = "LOCK TABLE roles, routes, rbac IN SHARE ROW EXCLUSIVE MODE"
+	POLICY_SNAPSHOT = `
+        SELECT jsonb_build_object(
+            'roles', COALESCE((SELECT jsonb_agg(jsonb_build_object('id', id, 'name', name) ORDER BY name, id) FROM roles), '[]'),
+            'routes', COALESCE((SELECT jsonb_agg(jsonb_build_object(
+                'id', id, 'method', method, 'host', host, 'path', path, 'service', service, 'active', active, 'metadata', metadata
+            ) ORDER BY service, path, method, host, id) FROM routes), '[]'),
+            'rbac', COALESCE((SELECT jsonb_agg(jsonb_build_object('route_id', route_id, 'role_id', role_id, 'rule_id', rule_id)
+                ORDER BY route_id, role_id) FROM rbac), '[]')
+        )
+    `
+	ADD_REVISION = `
+        WITH snapshot AS (SELECT (` + POLICY_SNAPSHOT + `) AS doc)
+        INSERT INTO policy_revisions (actor, reason, snapshot, hash)
+        SELECT $1, $2, doc, md5(doc::text) FROM snapshot
+        WHERE $3 OR md5(doc::text) IS DISTINCT FROM (SELECT hash FROM policy_revisions ORDER BY revision DESC LIMIT 1)
+        RETURNING revision, created_at, actor, reason, hash
+    `
+	FIND_REVISIONS = `
+        SELECT revision, created_at, actor, reason, hash FROM policy_revisions
+        ORDER BY revision DESC
+        LIMIT $1
+    `
+	FIND_REVISION = "SELECT revision, created_at, actor, reason, hash, snapshot FROM policy_revisions WHERE revision = $1"
+	FIND_SNAPSHOT = "SELECT snapshot FROM policy_revisions WHERE revision = $1"
+	LAST_REVISION = "SELECT revision, created_at, actor, reason, hash, snapshot FROM policy_revisions ORDER BY revision DESC LIMIT 1"
+
+	RESTORE_DELETE_RBAC = `
+        DELETE FROM rbac WHERE (route_id, role_id) NOT IN (
+            SELECT route_id, role_id FROM jsonb_to_recordset($1::jsonb->'rbac') AS x(route_id uuid, role_id uuid)
+        )
+    `
+	RESTORE_DELETE_ROLES = `
+        DELETE FROM roles WHERE id NOT IN (SELECT id FROM jsonb_to_recordset($1::jsonb->'roles') AS x(id uuid))
+            AND NOT EXISTS (SELECT 1 FROM resource_permissions WHERE role_id = roles.id)
+            AND NOT EXISTS (SELECT 1 FROM role_assignments WHERE role_id = roles.id)
+            AND NOT EXISTS (SELECT 1 FROM role_approvers WHERE role_id = roles.id)
+            AND NOT EXISTS (SELECT 1 FROM access_requests WHERE role_id = roles.id)
+            AND NOT EXISTS (SELECT 1 FROM binding_rules WHERE role_id = roles.id)
+    `
+	RESTORE_DELETE_ROUTES = `
+        DELETE FROM routes WHERE id NOT IN (SELECT id FROM jsonb_to_recordset($1::jsonb->'routes') AS x(id uuid))
+            AND NOT EXISTS (SELECT 1 FROM route_versions WHERE route_id = routes.id)
+            AND NOT EXISTS (SELECT 1 FROM access_requests WHERE route_id = routes.id)
+    `
+	RESTORE_KEPT_ROLES = `
+        SELECT id, name FROM roles
+        WHERE id NOT IN (SELECT id FROM jsonb_to_recordset($1::jsonb->'roles') AS x(id uuid))
+        ORDER BY name
+    `
+	RESTORE_KEPT_ROUTES = `
+        SELECT id, method, host, path, service, active FROM routes
+        WHERE id NOT IN (SELECT id FROM jsonb_to_recordset($1::jsonb->'routes') AS x(id uuid))
+        ORDER BY service, path, method
+    `
+	RESTORE_ROLES = `
+        INSERT INTO roles (id, name)
+        SELECT id, name FROM jsonb_to_recordset($1::jsonb->'roles') AS x(id uuid, name text)
+        ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name
+    `
+	RESTORE_ROUTES = `
+        INSERT INTO routes (id, method, host, path, service, active, metadata)
+        SELECT id, method, host, path, service, active, metadata
+        FROM jsonb_to_recordset($1::jsonb->'routes') AS x(id uuid, method text, host text, path text, service text, active boolean, metadata jsonb)
+        ON CONFLICT (id) DO UPDATE SET method = EXCLUDED.method, host = EXCLUDED.host, path = EXCLUDED.path,
+            service = EXCLUDED.service, active = EXCLUDED.active, metadata = EXCLUDED.metadata
+    `
+	RESTORE_RBAC = `
+        INSERT INTO rbac (route_id, role_id, rule_id)
+        SELECT x.route_id, x.role_id, binding_rules.id
+        FROM jsonb_to_recordset($1::jsonb->'rbac') AS x(route_id uuid, role_id uuid, rule_id uuid)
+        LEFT JOIN binding_rules ON binding_rules.id = x.rule_id
+        ON CONFLICT (route_id, role_id) DO NOTHING
+    `
+	// Services registering the same routes again must not be told they are
+	// unchanged, their routes may differ from the restored ones.
+	RESET_FINGERPRINTS = `
+        WITH versions AS (UPDATE service_versions SET fingerprint = '')
+        UPDATE services SET fingerprint = ''
+    `
+)
+
+type Revisions interface {
+	Add(string, string) (*model.Revision, error)
+	Find(int) ([]*model.Revision, error)
+	FindByID(int64) (*model.Revision, error)
+	FindLast() (*model.Revision, error)
+	Rollback(int64, string, string) (*model.Revision, error)
+	Snapshot() (*model.PolicySnapshot, error)
+}
+
+type revisions struct {
+	db DB
+}
+
+func NewRevisions(db DB) Revisions {
+	return &revisions{db: db}
+}
+
+// Add snapshots the policy as a new revision, unless it did not change
+// since the last one; the revision is nil then.
+func (r *revisions) Add(actor, reason string) (*model.Revision, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return nil, errors.New("failed to add revision")
+	}
+	defer tx.Rollback()
+
+	rev, err := addRevision(tx, actor, reason, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit revision: %v", err)
+		return nil, errors.New("failed to add revision")
+	}
+	return rev, nil
+}
+
+func (r *revisions) Find(limit int) ([]*model.Revision, error) {
+	rows, err := r.db.Query(FIND_REVISIONS, limit)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_REVISIONS: %v", err)
+		return nil, errors.New("failed to find revisions")
+	}
+	defer rows.Close()
+
+	var res []*model.Revision
+	for rows.Next() {
+		var rev model.Revision
+		if err := rows.Scan(&rev.Revision, &rev.CreatedAt, &rev.Actor, &rev.Reason, &rev.Hash); err != nil {
+			log.Printf("failed to scan FIND_REVISIONS record: %v", err)
+			return nil, errors.New("failed to find revisions")
+		}
+		res = append(res, &rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over revisions: %v", err)
+		return nil, errors.New("failed to find revisions")
+	}
+
+	return res, nil
+}
+
+func (r *revisions) FindByID(revision int64) (*model.Revision, error) {
+	rev, err := scanRevision(r.db.QueryRow(FIND_REVISION, revision))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("revision not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_REVISION: %v", err)
+		return nil, errors.New("failed to find revision")
+	}
+	return rev, nil
+}
+
+// FindLast returns the latest revision, nil if there is none yet.
+func (r *revisions) FindLast() (*model.Revision, error) {
+	rev, err := scanRevision(r.db.QueryRow(LAST_REVISION))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow LAST_REVISION: %v", err)
+		return nil, errors.New("failed to find revision")
+	}
+	return rev, nil
+}
+
+// Rollback restores the policy of the revision and records it as a new
+// revision, all in one transaction.
+func (r *revisions) Rollback(revision int64, actor, reason string) (*model.Revision, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return nil, errors.New("failed to roll back")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_POLICY); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_POLICY: %v", err)
+		return nil, errors.New("failed to roll back")
+	}
+
+	var snapshot []byte
+	err = tx.QueryRow(FIND_SNAPSHOT, revision).Scan(&snapshot)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("revision not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute tx.QueryRow FIND_SNAPSHOT: %v", err)
+		return nil, errors.New("failed to roll back")
+	}
+
+	steps := []struct {
+		name  string
+		query string
+	}{
+		{"RESTORE_DELETE_RBAC", RESTORE_DELETE_RBAC},
+		{"RESTORE_DELETE_ROLES", RESTORE_DELETE_ROLES},
+		{"RESTORE_DELETE_ROUTES", RESTORE_DELETE_ROUTES},
+		{"RESTORE_ROLES", RESTORE_ROLES},
+		{"RESTORE_ROUTES", RESTORE_ROUTES},
+		{"RESTORE_RBAC", RESTORE_RBAC},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, string(snapshot)); err != nil {
+			log.Printf("failed to execute tx.Exec %s: %v", step.name, err)
+			return nil, errors.New("failed to roll back, the policy was left unchanged")
+		}
+	}
+
+	if _, err := tx.Exec(RESET_FINGERPRINTS); err != nil {
+		log.Printf("failed to execute tx.Exec RESET_FINGERPRINTS: %v", err)
+		return nil, errors.New("failed to roll back")
+	}
+
+	rev, err := addRevision(tx, actor, reason, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if rev.KeptRoles, rev.KeptRoutes, err = keptPolicy(tx, snapshot); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit rollback: %v", err)
+		return nil, errors.New("failed to roll back")
+	}
+	return rev, nil
+}
+
+// Snapshot returns the live policy.
+func (r *revisions) Snapshot() (*model.PolicySnapshot, error) {
+	snapshot, err := scanSnapshot(r.db.QueryRow(POLICY_SNAPSHOT))
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow POLICY_SNAPSHOT: %v", err)
+		return nil, errors.New("failed to find policy")
+	}
+	return snapshot, nil
+}
+
+// keptPolicy returns the roles and routes missing from the snapshot that a
+// rollback kept.
+func keptPolicy(tx Tx, snapshot []byte) ([]model.Role, []model.Route, error) {
+	rows, err := tx.Query(RESTORE_KEPT_ROLES, string(snapshot))
+	if err != nil {
+		log.Printf("failed to execute tx.Query RESTORE_KEPT_ROLES: %v", err)
+		return nil, nil, errors.New("failed to roll back")
+	}
+	defer rows.Close()
+
+	var roles []model.Role
+	for rows.Next() {
+		var role model.Role
+		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+			log.Printf("failed to scan RESTORE_KEPT_ROLES record: %v", err)
+			return nil, nil, errors.New("failed to roll back")
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over kept roles: %v", err)
+		return nil, nil, errors.New("failed to roll back")
+	}
+
+	rows, err = tx.Query(RESTORE_KEPT_ROUTES, string(snapshot))
+	if err != nil {
+		log.Printf("failed to execute tx.Query RESTORE_KEPT_ROUTES: %v", err)
+		return nil, nil, errors.New("failed to roll back")
+	}
+	defer rows.Close()
+
+	var routes []model.Route
+	for rows.Next() {
+		var route model.Route
+		if err := rows.Scan(&route.ID, &route.Method, &route.Host, &route.Path, &route.Service, &route.Active); err != nil {
+			log.Printf("failed to scan RESTORE_KEPT_ROUTES record: %v", err)
+			return nil, nil, errors.New("failed to roll back")
+		}
+		routes = append(routes, route)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over kept routes: %v", err)
+		return nil, nil, errors.New("failed to roll back")
+	}
+
+	return roles, routes, nil
+}
+
+func addRevision(tx Tx, actor, reason string, always bool) (*model.Revision, error) {
+	if _, err := tx.Exec(LOCK_REVISIONS); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_REVISIONS: %v", err)
+		return nil, errors.New("failed to add revision")
+	}
+
+	var rev model.Revision
+	err := tx.QueryRow(ADD_REVISION, actor, reason, always).Scan(&rev.Revision, &rev.CreatedAt, &rev.Actor, &rev.Reason, &rev.Hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute tx.QueryRow ADD_REVISION: %v", err)
+		return nil, errors.New("failed to add revision")
+	}
+	return &rev, nil
+}
+
+func scanRevision(row rowScanner) (*model.Revision, error) {
+	var rev model.Revision
+	var snapshot []byte
+	if err := row.Scan(&rev.Revision, &rev.CreatedAt, &rev.Actor, &rev.Reason, &rev.Hash, &snapshot); err != nil {
+		return nil, err
+	}
+
+	rev.Snapshot = &model.PolicySnapshot{}
+	if err := json.Unmarshal(snapshot, rev.Snapshot); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+func scanSnapshot(row rowScanner) (*model.PolicySnapshot, error) {
+	var doc []byte
+	if err := row.Scan(&doc); err != nil {
+		return nil, err
+	}
+
+	var snapshot model.PolicySnapshot
+	if err := json.Unmarshal(doc, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
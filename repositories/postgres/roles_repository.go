@@ -14,6 +14,7 @@ const (
 	ADD_ROLE               = "INSERT INTO roles (id, name) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING;"
 	DELETE_ROLE            = "DELETE FROM roles WHERE id = $1;"
 	FIND_ROLES             = "SELECT id, name FROM roles ORDER BY name;"
+	FIND_ROLE_BY_ID        = "SELECT id, name FROM roles WHERE id = $1;"
 	FIND_ROLES_BY_ROUTE_ID = `
         SELECT roles.id, roles.name
         FROM roles
@@ -29,15 +30,16 @@ type Roles interface {
 	Delete(string) error
 	ExistsByID(uuid.UUID) (bool, error)
 	Find() ([]*model.Role, error)
+	FindByID(uuid.UUID) (*model.Role, error)
 	FindByRoute(uuid.UUID) ([]*model.Role, error)
 	Update(*model.Role) error
 }
 
 type roles struct {
-	db *sql.DB
+	db DB
 }
 
-func NewRoles(db *sql.DB) Roles {
+func NewRoles(db DB) Roles {
 	return &roles{db: db}
 }
 
@@ -96,6 +98,19 @@ func (r *roles) Find() ([]*model.Role, error) {
 	return roles, nil
 }
 
+func (r *roles) FindByID(id uuid.UUID) (*model.Role, error) {
+	var role model.Role
+	err := r.db.QueryRow(FIND_ROLE_BY_ID, id).Scan(&role.ID, &role.Name)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("role not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_ROLE_BY_ID: %v", err)
+		return nil, errors.New("failed to find role")
+	}
+	return &role, nil
+}
+
 func (r *roles) FindByRoute(routeID uuid.UUID) ([]*model.Role, error) {
 	rows, err := r.db.Query(FIND_ROLES_BY_ROUTE_ID, routeID)
 	if err != nil {
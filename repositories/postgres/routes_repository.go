@@ -2,27 +2,104 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log"
 
 	model "github.com/demkowo/rbac/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const (
-	ADD_ACTIVE_ROUTES      = `INSERT INTO routes (id, method, path, service, active) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (method, path, service) DO UPDATE SET active=$5`
-	ADD_ROUTE              = `INSERT INTO routes (id, method, path, service, active) VALUES ($1,$2,$3,$4,$5) ON CONFLICT (method, path, service) DO UPDATE SET active = EXCLUDED.active`
+	ADD_ACTIVE_ROUTES = `
+        INSERT INTO routes (id, method, host, path, service, active)
+        SELECT DISTINCT ON (method, host, path, service) *
+        FROM unnest($1::uuid[], $2::text[], $3::text[], $4::text[], $5::text[], $6::boolean[]) AS r(id, method, host, path, service, active)
+        ON CONFLICT (method, host, path, service) DO UPDATE SET active = EXCLUDED.active
+    `
+	ADD_ROUTE              = `INSERT INTO routes (id, method, host, path, service, active) VALUES ($1,$2,$3,$4,$5,$6) ON CONFLICT (method, host, path, service) DO UPDATE SET active = EXCLUDED.active`
 	DELETE_ROUTE           = "DELETE FROM routes WHERE id = $1"
 	ROUTE_EXISTS_BY_ID     = "SELECT EXISTS(SELECT 1 FROM routes WHERE id=$1)"
-	FIND_ROUTES            = "SELECT id, method, path, service, active FROM routes ORDER BY path, method"
+	FIND_ROUTES            = "SELECT id, method, host, path, service, active FROM routes ORDER BY path, method, host"
+	FIND_ROUTE_BY_ID       = "SELECT id, method, host, path, service, active FROM routes WHERE id = $1"
 	FIND_ROUTES_BY_ROLE_ID = `
-        SELECT routes.id, routes.method, routes.path, routes.service, routes.active
+        SELECT routes.id, routes.method, routes.host, routes.path, routes.service, routes.active
         FROM routes
         INNER JOIN rbac ON routes.id = rbac.route_id
         WHERE rbac.role_id = $1
+    `
+	FIND_ROUTES_BY_ROLE_NAMES = `
+        SELECT DISTINCT routes.id, routes.method, routes.host, routes.path, routes.service, routes.active
+        FROM routes
+        INNER JOIN rbac ON routes.id = rbac.route_id
+        INNER JOIN roles ON roles.id = rbac.role_id
+        WHERE routes.active AND roles.name = ANY($1)
+    `
+	LOCK_SERVICE_ROUTES    = "SELECT pg_advisory_xact_lock(hashtext('routes:' || $1))"
+	FIND_ROUTES_BY_SERVICE = `
+        SELECT routes.id, routes.method, routes.host, routes.path, routes.service, routes.active, routes.metadata,
+            COALESCE(array_agg(route_versions.version ORDER BY route_versions.version) FILTER (WHERE route_versions.version IS NOT NULL), '{}')
+        FROM routes
+        LEFT JOIN route_versions ON route_versions.route_id = routes.id
+        WHERE routes.service = $1
+        GROUP BY routes.id
+        ORDER BY routes.path, routes.method, routes.host
+    `
+	REGISTER_ROUTES = `
+        INSERT INTO routes (id, method, host, path, service, active, metadata)
+        SELECT id, method, host, path, $1, true, NULLIF(metadata, '')::jsonb
+        FROM unnest($2::uuid[], $3::text[], $4::text[], $5::text[], $6::text[]) AS s(id, method, host, path, metadata)
+        ON CONFLICT (method, host, path, service) DO UPDATE SET active = true, metadata = COALESCE(EXCLUDED.metadata, routes.metadata)
+    `
+	DELETE_ROUTE_VERSIONS = `
+        DELETE FROM route_versions
+        WHERE version = $2 AND route_id IN (SELECT id FROM routes WHERE service = $1)
+        RETURNING route_id
+    `
+	ADD_ROUTE_VERSIONS = `
+        INSERT INTO route_versions (route_id, version)
+        SELECT routes.id, $2
+        FROM routes
+        INNER JOIN unnest($3::text[], $4::text[], $5::text[]) AS s(method, host, path)
+            ON routes.method = s.method AND routes.host = s.host AND routes.path = s.path
+        WHERE routes.service = $1
+        ON CONFLICT (route_id, version) DO NOTHING
+    `
+	DEACTIVATE_UNEXPOSED = `
+        UPDATE routes SET active = false
+        WHERE id = ANY($1::uuid[]) AND active
+        AND NOT EXISTS (SELECT 1 FROM route_versions WHERE route_versions.route_id = routes.id)
+    `
+	MIGRATE_RBAC = `
+        INSERT INTO rbac (route_id, role_id)
+        SELECT m.to_id, rbac.role_id
+        FROM unnest($1::uuid[], $2::uuid[]) AS m(from_id, to_id)
+        INNER JOIN rbac ON rbac.route_id = m.from_id
+        ON CONFLICT (route_id, role_id) DO NOTHING
+    `
+	ADD_RULE_RBAC = `
+        INSERT INTO rbac (route_id, role_id, rule_id)
+        SELECT * FROM unnest($1::uuid[], $2::uuid[], $3::uuid[])
+        ON CONFLICT (route_id, role_id) DO NOTHING
+    `
+	SAVE_FINGERPRINT = `
+        INSERT INTO services (name, fingerprint, registered_at) VALUES ($1, $2, now())
+        ON CONFLICT (name) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, registered_at = EXCLUDED.registered_at
+    `
+	SAVE_VERSION = `
+        INSERT INTO service_versions (service, version, fingerprint, registered_at, last_seen) VALUES ($1, $2, $3, now(), now())
+        ON CONFLICT (service, version) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, registered_at = EXCLUDED.registered_at, last_seen = EXCLUDED.last_seen
+    `
+	RESET_FINGERPRINT = "UPDATE services SET fingerprint = '' WHERE name = $1"
+	RESET_VERSIONS    = `
+        WITH dropped AS (
+            DELETE FROM route_versions WHERE route_id IN (SELECT id FROM routes WHERE service = $1)
+        )
+        DELETE FROM service_versions WHERE service = $1
     `
 	SET_ROUTE_INACTIVE = "UPDATE routes SET active = false WHERE service = $1"
-	UPDATE_ROUTE       = "UPDATE routes SET method = $2, path = $3, service = $4, active = $5 WHERE id = $1"
+	UPDATE_ROUTE       = "UPDATE routes SET method = $2, host = $3, path = $4, service = $5, active = $6 WHERE id = $1"
 )
 
 type Routes interface {
@@ -31,32 +108,36 @@ type Routes interface {
 	Delete(uuid.UUID) error
 	ExistsByID(uuid.UUID) (bool, error)
 	Find() ([]*model.Route, error)
+	FindByID(uuid.UUID) (*model.Route, error)
 	FindByRole(uuid.UUID) ([]*model.Route, error)
+	FindByRoleNames([]string) ([]*model.Route, error)
+	FindByService(string) ([]*model.Route, error)
+	Register(string, func([]*model.Route) (*model.Registration, error)) error
 	SetInactive(string) error
 	Update(*model.Route) error
 }
 
 type routes struct {
-	db *sql.DB
+	db DB
 }
 
-func NewRoutes(db *sql.DB) Routes {
+func NewRoutes(db DB) Routes {
 	return &routes{db: db}
 }
 
 func (r *routes) AddActive(routes []model.Route) error {
-	for _, route := range routes {
-		_, err := r.db.Exec(ADD_ACTIVE_ROUTES, route.ID, route.Method, route.Path, route.Service, route.Active)
-		if err != nil {
-			log.Printf("failed to execute db.Exec ADD_ACTIVE_ROUTES: %v", err)
-			return errors.New("failed to update list of routes")
-		}
+	ids, methods, hosts, paths, services, active := routeColumns(routes)
+
+	_, err := r.db.Exec(ADD_ACTIVE_ROUTES, pq.Array(ids), pq.Array(methods), pq.Array(hosts), pq.Array(paths), pq.Array(services), pq.Array(active))
+	if err != nil {
+		log.Printf("failed to execute db.Exec ADD_ACTIVE_ROUTES: %v", err)
+		return errors.New("failed to update list of routes")
 	}
 	return nil
 }
 
 func (r *routes) Add(route *model.Route) error {
-	_, err := r.db.Exec(ADD_ROUTE, route.ID, route.Method, route.Path, route.Service, route.Active)
+	_, err := r.db.Exec(ADD_ROUTE, route.ID, route.Method, route.Host, route.Path, route.Service, route.Active)
 	if err != nil {
 		log.Printf("failed to execute db.Exec ADD_ROUTE: %v", err)
 		return errors.New("failed to add route")
@@ -95,7 +176,7 @@ func (r *routes) Find() ([]*model.Route, error) {
 	var routes []*model.Route
 	for rows.Next() {
 		var route model.Route
-		if err := rows.Scan(&route.ID, &route.Method, &route.Path, &route.Service, &route.Active); err != nil {
+		if err := rows.Scan(&route.ID, &route.Method, &route.Host, &route.Path, &route.Service, &route.Active); err != nil {
 			log.Printf("failed to scan FIND_ROUTES record: %v", err)
 			return nil, errors.New("failed to fetch routes")
 		}
@@ -111,6 +192,19 @@ func (r *routes) Find() ([]*model.Route, error) {
 	return routes, nil
 }
 
+func (r *routes) FindByID(id uuid.UUID) (*model.Route, error) {
+	var route model.Route
+	err := r.db.QueryRow(FIND_ROUTE_BY_ID, id).Scan(&route.ID, &route.Method, &route.Host, &route.Path, &route.Service, &route.Active)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("route not found")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_ROUTE_BY_ID: %v", err)
+		return nil, errors.New("failed to find route")
+	}
+	return &route, nil
+}
+
 func (r *routes) FindByRole(roleID uuid.UUID) ([]*model.Route, error) {
 	rows, err := r.db.Query(FIND_ROUTES_BY_ROLE_ID, roleID)
 	if err != nil {
@@ -122,7 +216,7 @@ func (r *routes) FindByRole(roleID uuid.UUID) ([]*model.Route, error) {
 	var routes []*model.Route
 	for rows.Next() {
 		var route model.Route
-		if err := rows.Scan(&route.ID, &route.Method, &route.Path, &route.Service, &route.Active); err != nil {
+		if err := rows.Scan(&route.ID, &route.Method, &route.Host, &route.Path, &route.Service, &route.Active); err != nil {
 			log.Printf("failed to scan FIND_ROUTES_BY_ROLE_ID record: %v", err)
 			return nil, errors.New("failed to find routes for role")
 		}
@@ -137,10 +231,165 @@ func (r *routes) FindByRole(roleID uuid.UUID) ([]*model.Route, error) {
 	return routes, nil
 }
 
+// FindByRoleNames returns the active routes bound to any of the roles.
+func (r *routes) FindByRoleNames(names []string) ([]*model.Route, error) {
+	rows, err := r.db.Query(FIND_ROUTES_BY_ROLE_NAMES, pq.Array(names))
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_ROUTES_BY_ROLE_NAMES: %v", err)
+		return nil, errors.New("failed to find routes for roles")
+	}
+	defer rows.Close()
+
+	var routes []*model.Route
+	for rows.Next() {
+		var route model.Route
+		if err := rows.Scan(&route.ID, &route.Method, &route.Host, &route.Path, &route.Service, &route.Active); err != nil {
+			log.Printf("failed to scan FIND_ROUTES_BY_ROLE_NAMES record: %v", err)
+			return nil, errors.New("failed to find routes for roles")
+		}
+		routes = append(routes, &route)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over routes: %v", err)
+		return nil, errors.New("failed to find routes for roles")
+	}
+
+	return routes, nil
+}
+
+func (r *routes) FindByService(service string) ([]*model.Route, error) {
+	return findByService(r.db, service)
+}
+
+// Register replaces the routes of a version of the service in a single
+// transaction. Routes dropped from the version that no other version exposes
+// become inactive.
+// Registrations of the same service are serialized with an advisory lock, plan
+// receives the routes stored before the registration and returns what to
+// register.
+func (r *routes) Register(service string, plan func([]*model.Route) (*model.Registration, error)) error {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to register routes")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_SERVICE_ROUTES, service); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_SERVICE_ROUTES: %v", err)
+		return errors.New("failed to register routes")
+	}
+
+	existing, err := findByService(tx, service)
+	if err != nil {
+		return err
+	}
+
+	reg, err := plan(existing)
+	if err != nil {
+		return err
+	}
+
+	ids, methods, hosts, paths, _, _ := routeColumns(reg.Routes)
+	metadata, err := metadataColumn(reg.Routes)
+	if err != nil {
+		log.Printf("failed to marshal route metadata: %v", err)
+		return errors.New("failed to register routes")
+	}
+	if _, err := tx.Exec(REGISTER_ROUTES, service, pq.Array(ids), pq.Array(methods), pq.Array(hosts), pq.Array(paths), pq.Array(metadata)); err != nil {
+		log.Printf("failed to execute tx.Exec REGISTER_ROUTES: %v", err)
+		return errors.New("failed to register routes")
+	}
+
+	dropped, err := deleteRouteVersions(tx, service, reg.Version)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ADD_ROUTE_VERSIONS, service, reg.Version, pq.Array(methods), pq.Array(hosts), pq.Array(paths)); err != nil {
+		log.Printf("failed to execute tx.Exec ADD_ROUTE_VERSIONS: %v", err)
+		return errors.New("failed to register routes")
+	}
+
+	if err := deactivateUnexposed(tx, dropped); err != nil {
+		return err
+	}
+
+	if len(reg.Renames) > 0 {
+		var from, to []string
+		for _, rename := range reg.Renames {
+			from = append(from, rename.From.ID.String())
+			to = append(to, rename.To.ID.String())
+		}
+		if _, err := tx.Exec(MIGRATE_RBAC, pq.Array(from), pq.Array(to)); err != nil {
+			log.Printf("failed to execute tx.Exec MIGRATE_RBAC: %v", err)
+			return errors.New("failed to register routes")
+		}
+	}
+
+	if len(reg.Bindings) > 0 {
+		var routeIDs, roleIDs, ruleIDs []string
+		for _, binding := range reg.Bindings {
+			routeIDs = append(routeIDs, binding.RouteID.String())
+			roleIDs = append(roleIDs, binding.RoleID.String())
+			ruleIDs = append(ruleIDs, binding.RuleID.String())
+		}
+		if _, err := tx.Exec(ADD_RULE_RBAC, pq.Array(routeIDs), pq.Array(roleIDs), pq.Array(ruleIDs)); err != nil {
+			log.Printf("failed to execute tx.Exec ADD_RULE_RBAC: %v", err)
+			return errors.New("failed to register routes")
+		}
+	}
+
+	if _, err := tx.Exec(SAVE_FINGERPRINT, service, reg.Fingerprint); err != nil {
+		log.Printf("failed to execute tx.Exec SAVE_FINGERPRINT: %v", err)
+		return errors.New("failed to register routes")
+	}
+
+	if _, err := tx.Exec(SAVE_VERSION, service, reg.Version, reg.Fingerprint); err != nil {
+		log.Printf("failed to execute tx.Exec SAVE_VERSION: %v", err)
+		return errors.New("failed to register routes")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit REGISTER_ROUTES: %v", err)
+		return errors.New("failed to register routes")
+	}
+
+	return nil
+}
+
 func (r *routes) SetInactive(service string) error {
-	_, err := r.db.Exec(SET_ROUTE_INACTIVE, service)
+	tx, err := begin(r.db)
 	if err != nil {
-		log.Printf("failed to execute db.Exec SET_ROUTE_INACTIVE: %v", err)
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to set routes inactive")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_SERVICE_ROUTES, service); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_SERVICE_ROUTES: %v", err)
+		return errors.New("failed to set routes inactive")
+	}
+
+	if _, err := tx.Exec(SET_ROUTE_INACTIVE, service); err != nil {
+		log.Printf("failed to execute tx.Exec SET_ROUTE_INACTIVE: %v", err)
+		return errors.New("failed to set routes inactive")
+	}
+
+	// the next registration must not be skipped as unchanged
+	if _, err := tx.Exec(RESET_FINGERPRINT, service); err != nil {
+		log.Printf("failed to execute tx.Exec RESET_FINGERPRINT: %v", err)
+		return errors.New("failed to set routes inactive")
+	}
+
+	if _, err := tx.Exec(RESET_VERSIONS, service); err != nil {
+		log.Printf("failed to execute tx.Exec RESET_VERSIONS: %v", err)
+		return errors.New("failed to set routes inactive")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit SET_ROUTE_INACTIVE: %v", err)
 		return errors.New("failed to set routes inactive")
 	}
 
@@ -148,7 +397,7 @@ func (r *routes) SetInactive(service string) error {
 }
 
 func (r *routes) Update(route *model.Route) error {
-	_, err := r.db.Exec(UPDATE_ROUTE, route.ID, route.Method, route.Path, route.Service, route.Active)
+	_, err := r.db.Exec(UPDATE_ROUTE, route.ID, route.Method, route.Host, route.Path, route.Service, route.Active)
 	if err != nil {
 		log.Printf("failed to execute db.Exec UPDATE_ROUTE: %v", err)
 		return errors.New("failed to update route")
@@ -156,3 +405,114 @@ func (r *routes) Update(route *model.Route) error {
 
 	return nil
 }
+
+type querier interface {
+	Query(string, ...any) (*sql.Rows, error)
+}
+
+func findByService(q querier, service string) ([]*model.Route, error) {
+	rows, err := q.Query(FIND_ROUTES_BY_SERVICE, service)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_ROUTES_BY_SERVICE: %v", err)
+		return nil, errors.New("failed to find routes for service")
+	}
+	defer rows.Close()
+
+	var routes []*model.Route
+	for rows.Next() {
+		var route model.Route
+		var metadata []byte
+		var versions pq.StringArray
+		if err := rows.Scan(&route.ID, &route.Method, &route.Host, &route.Path, &route.Service, &route.Active, &metadata, &versions); err != nil {
+			log.Printf("failed to scan FIND_ROUTES_BY_SERVICE record: %v", err)
+			return nil, errors.New("failed to find routes for service")
+		}
+		if metadata != nil {
+			if err := json.Unmarshal(metadata, &route.Metadata); err != nil {
+				log.Printf("failed to unmarshal metadata of route %s: %v", route.ID, err)
+				return nil, errors.New("failed to find routes for service")
+			}
+		}
+		route.Versions = versions
+		routes = append(routes, &route)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over routes: %v", err)
+		return nil, errors.New("failed to find routes for service")
+	}
+
+	return routes, nil
+}
+
+// deleteRouteVersions drops the route set of the version and returns the IDs of
+// the routes that were in it.
+func deleteRouteVersions(tx DB, service, version string) ([]string, error) {
+	rows, err := tx.Query(DELETE_ROUTE_VERSIONS, service, version)
+	if err != nil {
+		log.Printf("failed to execute tx.Query DELETE_ROUTE_VERSIONS: %v", err)
+		return nil, errors.New("failed to delete route versions")
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("failed to scan DELETE_ROUTE_VERSIONS record: %v", err)
+			return nil, errors.New("failed to delete route versions")
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over route versions: %v", err)
+		return nil, errors.New("failed to delete route versions")
+	}
+
+	return ids, nil
+}
+
+// deactivateUnexposed sets the routes inactive that no version exposes anymore.
+// Only routes dropped from a version are passed in, routes added through the
+// routes API are never version-tracked and stay as they are.
+func deactivateUnexposed(tx DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(DEACTIVATE_UNEXPOSED, pq.Array(ids)); err != nil {
+		log.Printf("failed to execute tx.Exec DEACTIVATE_UNEXPOSED: %v", err)
+		return errors.New("failed to deactivate unexposed routes")
+	}
+	return nil
+}
+
+func routeColumns(routes []model.Route) (ids, methods, hosts, paths, services []string, active []bool) {
+	for _, route := range routes {
+		ids = append(ids, route.ID.String())
+		methods = append(methods, route.Method)
+		hosts = append(hosts, route.Host)
+		paths = append(paths, route.Path)
+		services = append(services, route.Service)
+		active = append(active, route.Active)
+	}
+	return
+}
+
+// metadataColumn marshals the metadata of each route, an empty string keeps the
+// stored metadata.
+func metadataColumn(routes []model.Route) ([]string, error) {
+	column := make([]string, 0, len(routes))
+	for _, route := range routes {
+		if route.Metadata == nil {
+			column = append(column, "")
+			continue
+		}
+		b, err := json.Marshal(route.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		column = append(column, string(b))
+	}
+	return column, nil
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	ADD_RULE        = "INSERT INTO binding_rules (id, name, service, method, path_pattern, role_id) VALUES ($1, $2, $3, $4, $5, $6);"
+	DELETE_RULE     = "DELETE FROM binding_rules WHERE id = $1;"
+	FIND_RULES      = "SELECT id, name, service, method, path_pattern, role_id FROM binding_rules ORDER BY name;"
+	FIND_RULE_BY_ID = "SELECT id, name, service, method, path_pattern, role_id FROM binding_rules WHERE id = $1;"
+)
+
+type Rules interface {
+	Add(*model.BindingRule) error
+	Delete(uuid.UUID) error
+	Find() ([]*model.BindingRule, error)
+	FindByID(uuid.UUID) (*model.BindingRule, error)
+}
+
+type rules struct {
+	db DB
+}
+
+func NewRules(db DB) Rules {
+	return &rules{db: db}
+}
+
+func (r *rules) Add(rule *model.BindingRule) error {
+	_, err := r.db.Exec(ADD_RULE, rule.ID, rule.Name, rule.Service, rule.Method, rule.PathPattern, rule.RoleID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			log.Printf("duplicate key error on ADD_RULE: %v", pqErr.Detail)
+			return errors.New("rule with the given name already exists")
+		}
+		log.Printf("failed to execute db.Exec ADD_RULE: %v", err)
+		return errors.New("failed to add rule")
+	}
+	return nil
+}
+
+func (r *rules) Delete(id uuid.UUID) error {
+	_, err := r.db.Exec(DELETE_RULE, id)
+	if err != nil {
+		log.Printf("failed to execute db.Exec DELETE_RULE: %v", err)
+		return errors.New("failed to delete rule")
+	}
+	return nil
+}
+
+func (r *rules) Find() ([]*model.BindingRule, error) {
+	rows, err := r.db.Query(FIND_RULES)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_RULES: %v", err)
+		return nil, errors.New("failed to find rules")
+	}
+	defer rows.Close()
+
+	var rules []*model.BindingRule
+	for rows.Next() {
+		var rule model.BindingRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Service, &rule.Method, &rule.PathPattern, &rule.RoleID); err != nil {
+			log.Printf("failed to scan FIND_RULES record: %v", err)
+			return nil, errors.New("failed to find rules")
+		}
+		rules = append(rules, &rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over rules: %v", err)
+		return nil, errors.New("failed to find rules")
+	}
+
+	return rules, nil
+}
+
+func (r *rules) FindByID(id uuid.UUID) (*model.BindingRule, error) {
+	var rule model.BindingRule
+	err := r.db.QueryRow(FIND_RULE_BY_ID, id).Scan(&rule.ID, &rule.Name, &rule.Service, &rule.Method, &rule.PathPattern, &rule.RoleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("rule does not exist")
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_RULE_BY_ID: %v", err)
+		return nil, errors.New("failed to find rule")
+	}
+	return &rule, nil
+}
@@ -0,0 +1,373 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+const (
+	FIND_SERVICE   = "SELECT name, fingerprint, registered_at, last_seen, stale FROM services WHERE name = $1"
+	FIND_SERVICES  = "SELECT name, fingerprint, registered_at, last_seen, stale FROM services ORDER BY name"
+	FIND_INSTANCES = "SELECT service, instance, version, last_seen FROM service_instances ORDER BY service, instance"
+	FIND_VERSION   = "SELECT service, version, fingerprint, registered_at, last_seen FROM service_versions WHERE service = $1 AND version = $2"
+	FIND_VERSIONS  = "SELECT service, version, fingerprint, registered_at, last_seen FROM service_versions ORDER BY service, version"
+	FIND_EXPIRED   = `
+        SELECT service, version, fingerprint, registered_at, last_seen FROM service_versions AS v
+        WHERE last_seen < now() - make_interval(secs => $1)
+        AND EXISTS (
+            SELECT 1 FROM service_versions AS live
+            WHERE live.service = v.service AND live.version <> v.version
+            AND live.last_seen >= now() - make_interval(secs => $1)
+        )
+    `
+	FIND_STALE = `
+        SELECT name FROM services
+        WHERE NOT stale AND COALESCE(last_seen, registered_at) < now() - make_interval(secs => $1)
+    `
+	HEARTBEAT_INSTANCE = `
+        INSERT INTO service_instances (service, instance, version, last_seen) VALUES ($1, $2, $3, now())
+        ON CONFLICT (service, instance) DO UPDATE SET version = EXCLUDED.version, last_seen = EXCLUDED.last_seen
+    `
+	HEARTBEAT_VERSION = "UPDATE service_versions SET last_seen = now() WHERE service = $1 AND version = $2"
+	HEARTBEAT_SERVICE = `
+        INSERT INTO services (name, last_seen) VALUES ($1, now())
+        ON CONFLICT (name) DO UPDATE SET last_seen = EXCLUDED.last_seen, stale = false
+    `
+	MARK_STALE = `
+        UPDATE services SET stale = true
+        WHERE name = $1 AND NOT stale AND COALESCE(last_seen, registered_at) < now() - make_interval(secs => $2)
+    `
+	DEACTIVATE_STALE = "UPDATE routes SET active = false WHERE service = $1"
+	// Admin changes to the routes of a service make its next registration
+	// apply in full.
+	CLEAR_FINGERPRINTS = `
+        WITH versions AS (UPDATE service_versions SET fingerprint = '' WHERE service = $1)
+        UPDATE services SET fingerprint = '' WHERE name = $1
+    `
+	RETIRE_VERSION = `
+        DELETE FROM service_versions
+        WHERE service = $1 AND version = $2 AND ($3::float8 = 0 OR last_seen < now() - make_interval(secs => $3::float8))
+    `
+)
+
+type Services interface {
+	Find(string) (*model.Service, error)
+	FindAll() ([]*model.Service, error)
+	FindExpiredVersions(time.Duration) ([]*model.Version, error)
+	FindStale(time.Duration) ([]string, error)
+	FindVersion(string, string) (*model.Version, error)
+	Heartbeat(string, string, string) error
+	MarkStale(string, time.Duration, bool) (bool, error)
+	ResetFingerprints(string) error
+	RetireVersion(string, string, time.Duration) (bool, error)
+}
+
+type services struct {
+	db DB
+}
+
+func NewServices(db DB) Services {
+	return &services{db: db}
+}
+
+func (r *services) Find(name string) (*model.Service, error) {
+	svc, err := scanService(r.db.QueryRow(FIND_SERVICE, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_SERVICE: %v", err)
+		return nil, errors.New("failed to find service")
+	}
+	return svc, nil
+}
+
+func (r *services) FindAll() ([]*model.Service, error) {
+	rows, err := r.db.Query(FIND_SERVICES)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_SERVICES: %v", err)
+		return nil, errors.New("failed to find services")
+	}
+	defer rows.Close()
+
+	var services []*model.Service
+	byName := make(map[string]*model.Service)
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			log.Printf("failed to scan FIND_SERVICES record: %v", err)
+			return nil, errors.New("failed to find services")
+		}
+		svc.Instances = []model.Instance{}
+		services = append(services, svc)
+		byName[svc.Name] = svc
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over services: %v", err)
+		return nil, errors.New("failed to find services")
+	}
+
+	instances, err := r.db.Query(FIND_INSTANCES)
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_INSTANCES: %v", err)
+		return nil, errors.New("failed to find services")
+	}
+	defer instances.Close()
+
+	for instances.Next() {
+		var service string
+		var instance model.Instance
+		if err := instances.Scan(&service, &instance.Name, &instance.Version, &instance.LastSeen); err != nil {
+			log.Printf("failed to scan FIND_INSTANCES record: %v", err)
+			return nil, errors.New("failed to find services")
+		}
+		if svc, ok := byName[service]; ok {
+			svc.Instances = append(svc.Instances, instance)
+		}
+	}
+
+	if err := instances.Err(); err != nil {
+		log.Printf("error while iterating over instances: %v", err)
+		return nil, errors.New("failed to find services")
+	}
+
+	versions, err := r.findVersions(FIND_VERSIONS)
+	if err != nil {
+		return nil, errors.New("failed to find services")
+	}
+
+	for _, version := range versions {
+		if svc, ok := byName[version.Service]; ok {
+			svc.Versions = append(svc.Versions, *version)
+		}
+	}
+
+	return services, nil
+}
+
+func (r *services) FindExpiredVersions(ttl time.Duration) ([]*model.Version, error) {
+	versions, err := r.findVersions(FIND_EXPIRED, ttl.Seconds())
+	if err != nil {
+		return nil, errors.New("failed to find expired versions")
+	}
+	return versions, nil
+}
+
+func (r *services) FindStale(ttl time.Duration) ([]string, error) {
+	rows, err := r.db.Query(FIND_STALE, ttl.Seconds())
+	if err != nil {
+		log.Printf("failed to execute db.Query FIND_STALE: %v", err)
+		return nil, errors.New("failed to find stale services")
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Printf("failed to scan FIND_STALE record: %v", err)
+			return nil, errors.New("failed to find stale services")
+		}
+		names = append(names, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over stale services: %v", err)
+		return nil, errors.New("failed to find stale services")
+	}
+
+	return names, nil
+}
+
+func (r *services) FindVersion(service, version string) (*model.Version, error) {
+	var v model.Version
+	err := r.db.QueryRow(FIND_VERSION, service, version).Scan(&v.Service, &v.Version, &v.Fingerprint, &v.RegisteredAt, &v.LastSeen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("failed to execute db.QueryRow FIND_VERSION: %v", err)
+		return nil, errors.New("failed to find service version")
+	}
+	return &v, nil
+}
+
+func (r *services) Heartbeat(service, instance, version string) error {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return errors.New("failed to record heartbeat")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(HEARTBEAT_INSTANCE, service, instance, version); err != nil {
+		log.Printf("failed to execute tx.Exec HEARTBEAT_INSTANCE: %v", err)
+		return errors.New("failed to record heartbeat")
+	}
+
+	if _, err := tx.Exec(HEARTBEAT_VERSION, service, version); err != nil {
+		log.Printf("failed to execute tx.Exec HEARTBEAT_VERSION: %v", err)
+		return errors.New("failed to record heartbeat")
+	}
+
+	if _, err := tx.Exec(HEARTBEAT_SERVICE, service); err != nil {
+		log.Printf("failed to execute tx.Exec HEARTBEAT_SERVICE: %v", err)
+		return errors.New("failed to record heartbeat")
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit heartbeat: %v", err)
+		return errors.New("failed to record heartbeat")
+	}
+
+	return nil
+}
+
+// MarkStale flags the service as stale if it still was not seen within ttl
+// and, with deactivate, sets its routes inactive. The advisory lock is taken
+// first, as on registration, so both can't deadlock on each other.
+func (r *services) MarkStale(service string, ttl time.Duration, deactivate bool) (bool, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return false, errors.New("failed to mark service stale")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_SERVICE_ROUTES, service); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_SERVICE_ROUTES: %v", err)
+		return false, errors.New("failed to mark service stale")
+	}
+
+	res, err := tx.Exec(MARK_STALE, service, ttl.Seconds())
+	if err != nil {
+		log.Printf("failed to execute tx.Exec MARK_STALE: %v", err)
+		return false, errors.New("failed to mark service stale")
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if deactivate {
+		if _, err := tx.Exec(DEACTIVATE_STALE, service); err != nil {
+			log.Printf("failed to execute tx.Exec DEACTIVATE_STALE: %v", err)
+			return false, errors.New("failed to mark service stale")
+		}
+		// the next registration must not be skipped as unchanged
+		if _, err := tx.Exec(RESET_FINGERPRINT, service); err != nil {
+			log.Printf("failed to execute tx.Exec RESET_FINGERPRINT: %v", err)
+			return false, errors.New("failed to mark service stale")
+		}
+		if _, err := tx.Exec(RESET_VERSIONS, service); err != nil {
+			log.Printf("failed to execute tx.Exec RESET_VERSIONS: %v", err)
+			return false, errors.New("failed to mark service stale")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit MARK_STALE: %v", err)
+		return false, errors.New("failed to mark service stale")
+	}
+
+	return true, nil
+}
+
+// ResetFingerprints clears the fingerprints of the service and its versions.
+func (r *services) ResetFingerprints(service string) error {
+	if _, err := r.db.Exec(CLEAR_FINGERPRINTS, service); err != nil {
+		log.Printf("failed to execute db.Exec CLEAR_FINGERPRINTS: %v", err)
+		return errors.New("failed to reset fingerprints")
+	}
+	return nil
+}
+
+// RetireVersion drops the route set of the version and deactivates routes no
+// other version exposes. With ttl the version is only retired if it still was
+// not seen within ttl.
+func (r *services) RetireVersion(service, version string, ttl time.Duration) (bool, error) {
+	tx, err := begin(r.db)
+	if err != nil {
+		log.Printf("failed to begin transaction: %v", err)
+		return false, errors.New("failed to retire version")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(LOCK_SERVICE_ROUTES, service); err != nil {
+		log.Printf("failed to execute tx.Exec LOCK_SERVICE_ROUTES: %v", err)
+		return false, errors.New("failed to retire version")
+	}
+
+	res, err := tx.Exec(RETIRE_VERSION, service, version, ttl.Seconds())
+	if err != nil {
+		log.Printf("failed to execute tx.Exec RETIRE_VERSION: %v", err)
+		return false, errors.New("failed to retire version")
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	dropped, err := deleteRouteVersions(tx, service, version)
+	if err != nil {
+		return false, err
+	}
+
+	if err := deactivateUnexposed(tx, dropped); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit RETIRE_VERSION: %v", err)
+		return false, errors.New("failed to retire version")
+	}
+
+	return true, nil
+}
+
+func (r *services) findVersions(query string, args ...any) ([]*model.Version, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		log.Printf("failed to execute db.Query service versions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*model.Version
+	for rows.Next() {
+		var v model.Version
+		if err := rows.Scan(&v.Service, &v.Version, &v.Fingerprint, &v.RegisteredAt, &v.LastSeen); err != nil {
+			log.Printf("failed to scan service versions record: %v", err)
+			return nil, err
+		}
+		versions = append(versions, &v)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("error while iterating over service versions: %v", err)
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+type rowScanner interface {
+	Scan(...any) error
+}
+
+func scanService(row rowScanner) (*model.Service, error) {
+	var svc model.Service
+	var lastSeen sql.NullTime
+	if err := row.Scan(&svc.Name, &svc.Fingerprint, &svc.RegisteredAt, &lastSeen, &svc.Stale); err != nil {
+		return nil, err
+	}
+	if lastSeen.Valid {
+		svc.LastSeen = &lastSeen.Time
+	}
+	return &svc, nil
+}
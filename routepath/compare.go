@@ -0,0 +1,190 @@
+package routepath
+
+import "strings"
+
+// Relation tells how the sets of request paths matched by two patterns
+// relate.
+type Relation int
+
+const (
+	Disjoint Relation = iota
+	// Equal patterns differ at most in parameter names.
+	Equal
+	// Narrower patterns match a subset of the paths of the other pattern.
+	Narrower
+	// Wider patterns match a superset of the paths of the other pattern.
+	Wider
+	// Overlapping patterns share some paths, but neither contains the other.
+	Overlapping
+)
+
+// examplePart fills parameters in example paths.
+const examplePart = "x"
+
+// Compare relates two canonical patterns and returns a request path both
+// match, unless they are disjoint. Parameters match a single non-empty
+// segment, catch-alls the rest of the path.
+func Compare(a, b string) (Relation, string) {
+	pa, err := Parse(a, Gin)
+	if err != nil {
+		return Disjoint, ""
+	}
+	pb, err := Parse(b, Gin)
+	if err != nil {
+		return Disjoint, ""
+	}
+
+	example, ok := intersect(pa, pb, 0, 0, nil)
+	if !ok {
+		return Disjoint, ""
+	}
+
+	aInB, bInA := subset(pa, pb, 0, 0), subset(pb, pa, 0, 0)
+	switch {
+	case aInB && bInA:
+		return Equal, example
+	case aInB:
+		return Narrower, example
+	case bInA:
+		return Wider, example
+	default:
+		return Overlapping, example
+	}
+}
+
+// Match reports whether the request path matches the canonical pattern.
+func Match(pattern, path string) bool {
+	p, err := Parse(pattern, Gin)
+	if err != nil {
+		return false
+	}
+	return subset(requestPath(path), p, 0, 0)
+}
+
+// Precedes reports whether routers pick pattern a over pattern b for a request
+// both match: at the first differing segment static segments win over
+// parameters, which win over catch-alls.
+func Precedes(a, b string) bool {
+	pa, err := Parse(a, Gin)
+	if err != nil {
+		return false
+	}
+	pb, err := Parse(b, Gin)
+	if err != nil {
+		return true
+	}
+
+	for i := 0; i < len(pa.Segments) && i < len(pb.Segments); i++ {
+		if ka, kb := pa.Segments[i].Kind, pb.Segments[i].Kind; ka != kb {
+			return ka < kb
+		}
+	}
+	return len(pa.Segments) > len(pb.Segments)
+}
+
+// requestPath parses a request path, its segments are all static.
+func requestPath(path string) *Pattern {
+	path, _, _ = strings.Cut(path, "?")
+
+	p := &Pattern{TrailingSlash: strings.HasSuffix(path, "/") && path != "/"}
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			p.Segments = append(p.Segments, Segment{Kind: Static, Value: segment})
+		}
+	}
+	return p
+}
+
+// subset reports whether every path matched by a from segment i on is
+// matched by b from segment j on.
+func subset(a, b *Pattern, i, j int) bool {
+	for ; ; i, j = i+1, j+1 {
+		aEnd, bEnd := i == len(a.Segments), j == len(b.Segments)
+
+		switch {
+		case !bEnd && b.Segments[j].Kind == CatchAll:
+			return !aEnd || a.TrailingSlash
+		case aEnd && bEnd:
+			return a.TrailingSlash == b.TrailingSlash
+		case aEnd || bEnd:
+			return false
+		}
+
+		sa, sb := a.Segments[i], b.Segments[j]
+		switch {
+		case sa.Kind == CatchAll:
+			return false
+		case sb.Kind == Param:
+			continue
+		case sa.Kind == Param || sa.Value != sb.Value:
+			return false
+		}
+	}
+}
+
+// intersect returns a path matched by both patterns from the given segments on.
+func intersect(a, b *Pattern, i, j int, path []string) (string, bool) {
+	for ; ; i, j = i+1, j+1 {
+		aEnd, bEnd := i == len(a.Segments), j == len(b.Segments)
+
+		if !aEnd && a.Segments[i].Kind == CatchAll {
+			return catchAllExample(b, j, path)
+		}
+		if !bEnd && b.Segments[j].Kind == CatchAll {
+			return catchAllExample(a, i, path)
+		}
+
+		switch {
+		case aEnd && bEnd:
+			if a.TrailingSlash != b.TrailingSlash {
+				return "", false
+			}
+			return joinExample(path, a.TrailingSlash), true
+		case aEnd || bEnd:
+			return "", false
+		}
+
+		sa, sb := a.Segments[i], b.Segments[j]
+		switch {
+		case sa.Kind == Static && sb.Kind == Static:
+			if sa.Value != sb.Value {
+				return "", false
+			}
+			path = append(path, sa.Value)
+		case sa.Kind == Static:
+			path = append(path, sa.Value)
+		case sb.Kind == Static:
+			path = append(path, sb.Value)
+		default:
+			path = append(path, examplePart)
+		}
+	}
+}
+
+// catchAllExample completes the path with the rest of p, which a catch-all of
+// the other pattern matches.
+func catchAllExample(p *Pattern, i int, path []string) (string, bool) {
+	if i == len(p.Segments) {
+		if !p.TrailingSlash {
+			return "", false
+		}
+		return joinExample(path, true), true
+	}
+
+	for _, segment := range p.Segments[i:] {
+		if segment.Kind == Static {
+			path = append(path, segment.Value)
+		} else {
+			path = append(path, examplePart)
+		}
+	}
+	return joinExample(path, p.TrailingSlash), true
+}
+
+func joinExample(path []string, trailingSlash bool) string {
+	res := "/" + strings.Join(path, "/")
+	if trailingSlash && len(path) > 0 {
+		res += "/"
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+package routepath
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		relation Relation
+		example  string
+	}{
+		{"/users/:id", "/users/:userID", Equal, "/users/x"},
+		{"/users/me", "/users/:id", Narrower, "/users/me"},
+		{"/users/:id", "/users/me", Wider, "/users/me"},
+		{"/users/me", "/users/me", Equal, "/users/me"},
+		{"/users/me", "/users/you", Disjoint, ""},
+		{"/users/:id", "/users/:id/posts", Disjoint, ""},
+		{"/a/:x", "/:y/b", Overlapping, "/a/b"},
+		{"/files/*path", "/files/a/b", Wider, "/files/a/b"},
+		{"/files/:name", "/files/*path", Narrower, "/files/x"},
+		{"/files/*path", "/files/*rest", Equal, "/files/x"},
+		{"/files/*path", "/*path", Narrower, "/files/x"},
+		{"/files/*path", "/files/", Wider, "/files/"},
+		{"/files/*path", "/files", Disjoint, ""},
+		{"/users", "/users/", Disjoint, ""},
+		{"/users/", "/users/", Equal, "/users/"},
+		{"/users/:id/", "/users/me/", Wider, "/users/me/"},
+	}
+
+	for _, tt := range tests {
+		relation, example := Compare(tt.a, tt.b)
+		if relation != tt.relation || example != tt.example {
+			t.Errorf("Compare(%q, %q) = %v, %q, want %v, %q", tt.a, tt.b, relation, example, tt.relation, tt.example)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/users/:id", "/users/42", true},
+		{"/users/:id", "/users/42?expand=posts", true},
+		{"/users/:id", "/users", false},
+		{"/users/:id", "/users/42/", false},
+		{"/users/:id", "/users/42/posts", false},
+		{"/users/me", "/users/42", false},
+		{"/files/*path", "/files/a/b", true},
+		{"/files/*path", "/files/", true},
+		{"/files/*path", "/files", false},
+		{"/users/", "/users/", true},
+		{"/users", "/users/", false},
+		{"/users/", "/users", false},
+		{"/", "/", true},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPrecedes(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/users/me", "/users/:id", true},
+		{"/users/:id", "/users/me", false},
+		{"/users/:id", "/users/*path", true},
+		{"/users/*path", "/users/:id", false},
+		{"/users/me", "/users/*path", true},
+		{"/a/:x/c", "/a/:y", true},
+		{"/a/:y", "/a/:x/c", false},
+		{"/users/:id", "/users/:userID", false},
+	}
+
+	for _, tt := range tests {
+		if got := Precedes(tt.a, tt.b); got != tt.want {
+			t.Errorf("Precedes(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
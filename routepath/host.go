@@ -0,0 +1,94 @@
+package routepath
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NormalizeHost lowercases the host pattern and drops a port and trailing
+// dot. "*" is only allowed as the leftmost label, as in "*.example.com";
+// slashes and spaces are not allowed at all.
+func NormalizeHost(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") || strings.ContainsAny(host, "/ \t") {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	return host, nil
+}
+
+// MatchHost reports whether the host of a request matches the host pattern of
+// a route. An empty pattern matches any host, "*.example.com" matches
+// subdomains of example.com but not example.com itself.
+func MatchHost(pattern, host string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return false
+	}
+
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+// CompareHosts relates the sets of hosts matched by two host patterns.
+func CompareHosts(a, b string) Relation {
+	switch {
+	case a == b:
+		return Equal
+	case a == "":
+		return Wider
+	case b == "":
+		return Narrower
+	case strings.HasPrefix(b, "*") && MatchHost(b, a):
+		return Narrower
+	case strings.HasPrefix(a, "*") && MatchHost(a, b):
+		return Wider
+	default:
+		return Disjoint
+	}
+}
+
+// HostRank orders host patterns by precedence: exact hosts before wildcards
+// before routes without a host.
+func HostRank(pattern string) int {
+	switch {
+	case pattern == "":
+		return 2
+	case strings.HasPrefix(pattern, "*"):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Combine relates patterns made of two dimensions, e.g. host and path, given
+// how each dimension relates.
+func Combine(a, b Relation) Relation {
+	if a == Disjoint || b == Disjoint {
+		return Disjoint
+	}
+
+	aInB := (a == Equal || a == Narrower) && (b == Equal || b == Narrower)
+	bInA := (a == Equal || a == Wider) && (b == Equal || b == Wider)
+	switch {
+	case aInB && bInA:
+		return Equal
+	case aInB:
+		return Narrower
+	case bInA:
+		return Wider
+	default:
+		return Overlapping
+	}
+}
@@ -0,0 +1,108 @@
+package routepath
+
+import "testing"
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host, want string
+		invalid    bool
+	}{
+		{host: "Example.COM", want: "example.com"},
+		{host: "example.com:8080", want: "example.com"},
+		{host: "example.com.", want: "example.com"},
+		{host: " *.example.com ", want: "*.example.com"},
+		{host: "", want: ""},
+		{host: "api.*.example.com", invalid: true},
+		{host: "*example.com*", invalid: true},
+		{host: "example.com/api", invalid: true},
+		{host: "example .com", invalid: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeHost(tt.host)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("NormalizeHost(%q) = %q, want an error", tt.host, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeHost(%q) = %q, %v, want %q", tt.host, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"", "example.com", true},
+		{"", "", true},
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com:443", true},
+		{"example.com", "api.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchHost(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestCompareHosts(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want Relation
+	}{
+		{"example.com", "example.com", Equal},
+		{"", "", Equal},
+		{"", "example.com", Wider},
+		{"example.com", "", Narrower},
+		{"", "*.example.com", Wider},
+		{"api.example.com", "*.example.com", Narrower},
+		{"*.example.com", "api.example.com", Wider},
+		{"example.com", "*.example.com", Disjoint},
+		{"*.a.example.com", "*.example.com", Narrower},
+		{"example.com", "example.org", Disjoint},
+	}
+
+	for _, tt := range tests {
+		if got := CompareHosts(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareHosts(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestHostRank(t *testing.T) {
+	if !(HostRank("example.com") < HostRank("*.example.com") && HostRank("*.example.com") < HostRank("")) {
+		t.Errorf("exact hosts must rank before wildcards, wildcards before no host")
+	}
+}
+
+func TestCombine(t *testing.T) {
+	tests := []struct {
+		host, path Relation
+		want       Relation
+	}{
+		{Equal, Equal, Equal},
+		{Equal, Narrower, Narrower},
+		{Wider, Equal, Wider},
+		{Narrower, Narrower, Narrower},
+		{Wider, Narrower, Overlapping},
+		{Overlapping, Equal, Overlapping},
+		{Disjoint, Equal, Disjoint},
+		{Wider, Disjoint, Disjoint},
+	}
+
+	for _, tt := range tests {
+		if got := Combine(tt.host, tt.path); got != tt.want {
+			t.Errorf("Combine(%v, %v) = %v, want %v", tt.host, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package routepath parses route patterns written for different HTTP routers
+// into the canonical form stored in the routes table, which is the Gin syntax:
+// "/users/:id" for parameters and "/files/*path" for catch-alls.
+package routepath
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Syntax names the router a pattern was written for.
+type Syntax string
+
+const (
+	// Auto accepts the union of the syntaxes below, which is unambiguous for
+	// all but static segments starting with ":" or "*".
+	Auto     Syntax = ""
+	Gin      Syntax = "gin"
+	Echo     Syntax = "echo"
+	Chi      Syntax = "chi"
+	Gorilla  Syntax = "gorilla"
+	ServeMux Syntax = "servemux"
+	OpenAPI  Syntax = "openapi"
+)
+
+// catchAllName names catch-alls that are anonymous in the original syntax.
+const catchAllName = "path"
+
+type Kind int
+
+const (
+	Static Kind = iota
+	Param
+	CatchAll
+)
+
+type Segment struct {
+	Kind  Kind
+	Value string
+}
+
+// Pattern is a parsed route pattern. Method and Host are only set for
+// net/http ServeMux patterns such as "GET example.com/items/{id}", the host
+// only when the syntax is given explicitly.
+type Pattern struct {
+	Method   string
+	Host     string
+	Segments []Segment
+
+	// TrailingSlash is kept, routers treat "/users" and "/users/" as different
+	// routes.
+	TrailingSlash bool
+}
+
+func ParseSyntax(s string) (Syntax, error) {
+	switch syntax := Syntax(strings.ToLower(s)); syntax {
+	case Auto, Gin, Echo, Chi, Gorilla, ServeMux, OpenAPI:
+		return syntax, nil
+	default:
+		return "", fmt.Errorf("unknown path syntax %q", s)
+	}
+}
+
+// Normalize returns the canonical form of the path.
+func Normalize(path string, syntax Syntax) (string, error) {
+	p, err := Parse(path, syntax)
+	if err != nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+// Parse parses the pattern written in the given syntax.
+func Parse(pattern string, syntax Syntax) (*Pattern, error) {
+	p := &Pattern{}
+	path := strings.TrimSpace(pattern)
+
+	if syntax == Auto || syntax == ServeMux {
+		if method, rest, ok := strings.Cut(path, " "); ok {
+			p.Method = strings.ToUpper(method)
+			path = strings.TrimLeft(rest, " \t")
+		}
+		if syntax == ServeMux && path != "" && !strings.HasPrefix(path, "/") {
+			host, rest, _ := strings.Cut(path, "/")
+			p.Host = strings.ToLower(host)
+			path = "/" + rest
+		}
+	}
+
+	segments, err := split(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %w", pattern, err)
+	}
+
+	for i, raw := range segments {
+		last := i == len(segments)-1
+
+		// Repeated slashes are dropped, a trailing one is kept.
+		if raw == "" {
+			if last && len(p.Segments) > 0 {
+				p.TrailingSlash = true
+			}
+			continue
+		}
+		if raw == "{$}" && last && (syntax == Auto || syntax == ServeMux) {
+			p.TrailingSlash = true
+			continue
+		}
+
+		segment, err := parseSegment(raw, syntax)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", pattern, err)
+		}
+		if segment.Kind == CatchAll && !last {
+			return nil, fmt.Errorf("invalid path %q: catch-all must be the last segment", pattern)
+		}
+		p.Segments = append(p.Segments, segment)
+	}
+
+	return p, nil
+}
+
+// String returns the canonical form without method and host.
+func (p *Pattern) String() string {
+	var b strings.Builder
+	for _, segment := range p.Segments {
+		b.WriteByte('/')
+		switch segment.Kind {
+		case Param:
+			b.WriteByte(':')
+		case CatchAll:
+			b.WriteByte('*')
+		}
+		b.WriteString(segment.Value)
+	}
+	if b.Len() == 0 || p.TrailingSlash {
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+// Key identifies the routes a pattern matches: parameter names are left out
+// so that "/users/{id}" and "/users/:userID" get the same key.
+func Key(path string) string {
+	p, err := Parse(path, Gin)
+	if err != nil {
+		return path
+	}
+
+	for i, segment := range p.Segments {
+		if segment.Kind != Static {
+			p.Segments[i].Value = ""
+		}
+	}
+	return p.String()
+}
+
+// split splits the path on slashes outside of braces, regular expressions
+// of chi and gorilla/mux parameters may contain slashes.
+func split(path string) ([]string, error) {
+	var segments []string
+	depth, start := 0, 0
+
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, errors.New("unbalanced braces")
+			}
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced braces")
+	}
+
+	return append(segments, path[start:]), nil
+}
+
+func parseSegment(raw string, syntax Syntax) (Segment, error) {
+	colon := syntax == Auto || syntax == Gin || syntax == Echo
+	braces := syntax != Gin && syntax != Echo
+	star := syntax == Auto || syntax == Gin || syntax == Echo || syntax == Chi
+
+	switch {
+	case colon && strings.HasPrefix(raw, ":") && len(raw) > 1:
+		return Segment{Kind: Param, Value: raw[1:]}, nil
+
+	case star && strings.HasPrefix(raw, "*"):
+		name := raw[1:]
+		if name == "" {
+			name = catchAllName
+		}
+		return Segment{Kind: CatchAll, Value: name}, nil
+
+	case braces && strings.HasPrefix(raw, "{") && strings.HasSuffix(raw, "}"):
+		return parseBraces(raw[1:len(raw)-1], syntax)
+
+	case braces && strings.ContainsAny(raw, "{}"):
+		return Segment{}, fmt.Errorf("parameter %q must span a whole segment", raw)
+	}
+
+	return Segment{Kind: Static, Value: raw}, nil
+}
+
+// parseBraces parses "{id}", "{id:[0-9]+}" (chi, gorilla/mux) and "{path...}"
+// (net/http). Regular expressions are dropped, a gorilla/mux parameter
+// matching anything is a catch-all.
+func parseBraces(inner string, syntax Syntax) (Segment, error) {
+	if name, ok := strings.CutSuffix(inner, "..."); ok && (syntax == Auto || syntax == ServeMux) {
+		if !validName(name) {
+			return Segment{}, fmt.Errorf("invalid parameter name %q", name)
+		}
+		return Segment{Kind: CatchAll, Value: name}, nil
+	}
+
+	name, expr, hasExpr := strings.Cut(inner, ":")
+	if hasExpr && (syntax == ServeMux || syntax == OpenAPI) {
+		return Segment{}, fmt.Errorf("invalid parameter name %q", inner)
+	}
+	if !validName(name) {
+		return Segment{}, fmt.Errorf("invalid parameter name %q", name)
+	}
+
+	if hasExpr && (expr == ".*" || expr == ".+") {
+		return Segment{Kind: CatchAll, Value: name}, nil
+	}
+	return Segment{Kind: Param, Value: name}, nil
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "{}/:*")
+}
@@ -0,0 +1,105 @@
+package routepath
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		path   string
+		syntax Syntax
+		want   string
+	}{
+		{"/users/:id", Gin, "/users/:id"},
+		{"/users/:id", Echo, "/users/:id"},
+		{"/users/{id}", Chi, "/users/:id"},
+		{"/users/{id:[0-9]+}", Gorilla, "/users/:id"},
+		{"/users/{id}", OpenAPI, "/users/:id"},
+		{"/users/{id}", Gin, "/users/{id}"},
+		{"/files/*", Chi, "/files/*path"},
+		{"/files/*filepath", Gin, "/files/*filepath"},
+		{"/files/{rest:.*}", Gorilla, "/files/*rest"},
+		{"/files/{path...}", ServeMux, "/files/*path"},
+		{"/items/{$}", ServeMux, "/items/"},
+		{"GET /items/{id}", Auto, "/items/:id"},
+		{"/users/", Gin, "/users/"},
+		{"//users//posts", Gin, "/users/posts"},
+		{"/", Gin, "/"},
+		{"", Gin, "/"},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.path, tt.syntax)
+		if err != nil {
+			t.Errorf("Normalize(%q, %q) failed: %v", tt.path, tt.syntax, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q, %q) = %q, want %q", tt.path, tt.syntax, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		path   string
+		syntax Syntax
+	}{
+		{"/files/*path/more", Gin},
+		{"/users/{id", Chi},
+		{"/users/id}", Chi},
+		{"/users/a{id}", Chi},
+		{"/users/{}", Chi},
+		{"/users/{id:[0-9]+}", ServeMux},
+		{"/files/{path...}/more", ServeMux},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.path, tt.syntax); err == nil {
+			t.Errorf("Parse(%q, %q) succeeded, want an error", tt.path, tt.syntax)
+		}
+	}
+}
+
+func TestParseServeMux(t *testing.T) {
+	tests := []struct {
+		path   string
+		syntax Syntax
+		method string
+		host   string
+		want   string
+	}{
+		{"GET /items/{id}", ServeMux, "GET", "", "/items/:id"},
+		{"post Example.com/items", ServeMux, "POST", "example.com", "/items"},
+		{"example.com/items/", ServeMux, "", "example.com", "/items/"},
+		{"GET example.com/items", Auto, "GET", "", "/example.com/items"},
+	}
+
+	for _, tt := range tests {
+		p, err := Parse(tt.path, tt.syntax)
+		if err != nil {
+			t.Errorf("Parse(%q, %q) failed: %v", tt.path, tt.syntax, err)
+			continue
+		}
+		if p.Method != tt.method || p.Host != tt.host || p.String() != tt.want {
+			t.Errorf("Parse(%q, %q) = %q %q %q, want %q %q %q", tt.path, tt.syntax, p.Method, p.Host, p.String(), tt.method, tt.host, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"/users/:id", "/users/:userID", true},
+		{"/files/*path", "/files/*rest", true},
+		{"/users/:id", "/users/me", false},
+		{"/users/:id", "/users/*id", false},
+		{"/users", "/users/", false},
+	}
+
+	for _, tt := range tests {
+		if same := Key(tt.a) == Key(tt.b); same != tt.same {
+			t.Errorf("Key(%q) == Key(%q) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+// Statuses of access requests. Approved requests become expired when their
+// grant is revoked at its expiry.
+const (
+	AccessPending  = "pending"
+	AccessApproved = "approved"
+	AccessRejected = "rejected"
+	AccessExpired  = "expired"
+)
+
+const (
+	AuditReject = "reject"
+
+	EntityAccessRequest = "access_request"
+	EntityApprovers     = "approvers"
+)
+
+// approverRolePrefix marks approvers that are roles of the caller's JWT
+// rather than subjects.
+const approverRolePrefix = "role:"
+
+var (
+	// ErrAccessRequestStatus is returned when deciding a request that is no
+	// longer pending.
+	ErrAccessRequestStatus = errors.New("access request is not pending")
+
+	// ErrAlreadyGranted is returned when requesting or approving access the
+	// requester already has.
+	ErrAlreadyGranted = errors.New("access is already granted")
+
+	// ErrNotApprover is returned when the caller matches none of the
+	// approvers of the role.
+	ErrNotApprover = errors.New("not an approver of the role")
+
+	// ErrNotAdmin is returned when the caller matches none of the admins.
+	ErrNotAdmin = errors.New("only admins may do this")
+)
+
+// AddAccessRequest files a request of the caller for the role or, with a
+// route, for the route to be bound to the role.
+func (s *rbac) AddAccessRequest(req *model.AccessRequest) error {
+	if s.actor.Name == AnonymousActor || s.actor.Name == SystemActor {
+		return fmt.Errorf("%w: requests need the identity of the caller", ErrInvalidChange)
+	}
+	if req.Reason = strings.TrimSpace(req.Reason); req.Reason == "" {
+		return fmt.Errorf("%w: missing reason", ErrInvalidChange)
+	}
+	if _, err := parseGrantDuration(req.Duration); err != nil {
+		return err
+	}
+
+	role, err := s.roles.FindByID(req.RoleID)
+	if err != nil {
+		return fmt.Errorf("%w: role %s does not exist", ErrInvalidChange, req.RoleID)
+	}
+	req.Role = role.Name
+	req.Requester = s.actor.Name
+
+	if req.RouteID != nil {
+		exists, err := s.routes.ExistsByID(*req.RouteID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: route %s does not exist", ErrInvalidChange, *req.RouteID)
+		}
+	} else if slices.Contains(s.actor.Roles, role.Name) {
+		return ErrAlreadyGranted
+	}
+
+	if err := s.checkNotGranted(req); err != nil {
+		return err
+	}
+
+	req.ID = uuid.New()
+	req.Status = AccessPending
+	req.DecidedBy, req.DecidedAt, req.Comment, req.ExpiresAt = "", nil, "", nil
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.accessRequests.Add(req); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityAccessRequest, req.ID.String(), nil, req)
+	})
+}
+
+// ApproveAccessRequest grants the requested access through AddAssignment or
+// AddRbac, in the transaction deciding the request. A duration replaces the
+// one requested.
+func (s *rbac) ApproveAccessRequest(id uuid.UUID, comment, duration string) (*model.AccessRequest, error) {
+	var req *model.AccessRequest
+	err := s.atomic(func(s *rbac) error {
+		var err error
+		if req, err = s.pendingAccessRequest(id); err != nil {
+			return err
+		}
+
+		if duration != "" {
+			req.Duration = duration
+		}
+		d, err := parseGrantDuration(req.Duration)
+		if err != nil {
+			return err
+		}
+		if err := s.checkNotGranted(req); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		req.Status, req.DecidedBy, req.DecidedAt, req.Comment = AccessApproved, s.actor.Name, &now, comment
+		if d > 0 {
+			expiresAt := now.Add(d)
+			req.ExpiresAt = &expiresAt
+		}
+		if err := s.decideAccessRequest(req); err != nil {
+			return err
+		}
+
+		if err := s.grantAccess(req); err != nil {
+			return err
+		}
+
+		return s.record(AuditApprove, EntityAccessRequest, req.ID.String(), nil, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ExpireAccessGrants revokes the bindings granted by approved requests that
+// expired and marks the requests expired. Assigned roles are revoked by
+// ExpireAssignments.
+func (s *rbac) ExpireAccessGrants() ([]*model.AccessRequest, error) {
+	expired, err := s.accessRequests.FindExpired(AccessApproved)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*model.AccessRequest
+	for _, req := range expired {
+		ok, err := s.expireAccessGrant(req)
+		if err != nil {
+			return res, err
+		}
+		if ok {
+			res = append(res, req)
+		}
+	}
+
+	return res, nil
+}
+
+// expireAccessGrant revokes the binding of the request, unless it no longer
+// owns it, and marks the request expired in one transaction, false if the
+// request was decided concurrently.
+func (s *rbac) expireAccessGrant(req *model.AccessRequest) (bool, error) {
+	var ok bool
+	err := s.atomic(func(s *rbac) error {
+		req.Status = AccessExpired
+		var err error
+		if ok, err = s.accessRequests.Decide(req, AccessApproved); err != nil || !ok {
+			return err
+		}
+
+		if req.RouteID != nil && req.GrantOwned {
+			if err := s.DeleteRbac(&model.Rbac{RouteID: *req.RouteID, RoleID: req.RoleID}); err != nil {
+				return err
+			}
+		}
+
+		return s.record(AuditExpire, EntityAccessRequest, req.ID.String(), nil, req)
+	})
+	return ok, err
+}
+
+// disownRemovedGrants makes requests give up bindings that a change in the
+// transaction removed, so they never revoke one an admin adds again.
+func (s *rbac) disownRemovedGrants() error {
+	if len(*s.policyChanges) == 0 {
+		return nil
+	}
+	return s.accessRequests.DisownRemovedGrants()
+}
+
+func (s *rbac) FindAccessRequest(id uuid.UUID) (*model.AccessRequest, error) {
+	return s.accessRequests.FindByID(id)
+}
+
+func (s *rbac) FindAccessRequests(filter model.AccessRequestFilter) ([]*model.AccessRequest, error) {
+	return s.accessRequests.Find(filter)
+}
+
+func (s *rbac) FindApprovers(roleID uuid.UUID) ([]string, error) {
+	return s.accessRequests.FindApprovers(roleID)
+}
+
+func (s *rbac) RejectAccessRequest(id uuid.UUID, comment string) (*model.AccessRequest, error) {
+	req, err := s.pendingAccessRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	req.Status, req.DecidedBy, req.DecidedAt, req.Comment = AccessRejected, s.actor.Name, &now, comment
+	err = s.atomic(func(s *rbac) error {
+		if err := s.decideAccessRequest(req); err != nil {
+			return err
+		}
+
+		return s.record(AuditReject, EntityAccessRequest, req.ID.String(), nil, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// SetApprovers replaces who may decide requests for the role: subjects, or
+// "role:<name>" for callers with the role in their JWT. Without approvers
+// only admins may decide. Only admins set them.
+func (s *rbac) SetApprovers(roleID uuid.UUID, approvers []string) error {
+	if err := s.checkAdmin(); err != nil {
+		return err
+	}
+
+	if _, err := s.roles.FindByID(roleID); err != nil {
+		return fmt.Errorf("%w: role %s does not exist", ErrInvalidChange, roleID)
+	}
+
+	var cleaned []string
+	for _, approver := range approvers {
+		if approver = strings.TrimSpace(approver); approver != "" && approver != approverRolePrefix {
+			cleaned = append(cleaned, approver)
+		}
+	}
+	slices.Sort(cleaned)
+	cleaned = slices.Compact(cleaned)
+
+	return s.atomic(func(s *rbac) error {
+		before, _ := s.accessRequests.FindApprovers(roleID)
+
+		if err := s.accessRequests.SetApprovers(roleID, cleaned); err != nil {
+			return err
+		}
+
+		return s.record(AuditUpdate, EntityApprovers, roleID.String(), before, cleaned)
+	})
+}
+
+// pendingAccessRequest finds the request if it is pending and the caller
+// may decide it: an approver of the role or, if it has none, an admin.
+func (s *rbac) pendingAccessRequest(id uuid.UUID) (*model.AccessRequest, error) {
+	req, err := s.accessRequests.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Status != AccessPending {
+		return nil, fmt.Errorf("%w: it is %s", ErrAccessRequestStatus, req.Status)
+	}
+
+	if s.actor.Name == req.Requester || s.actor.Name == AnonymousActor || s.actor.Name == SystemActor {
+		return nil, ErrSelfApproval
+	}
+
+	approvers, err := s.accessRequests.FindApprovers(req.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if len(approvers) == 0 {
+		if err := s.checkAdmin(); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+	for _, approver := range approvers {
+		if s.actsAs(approver) {
+			return req, nil
+		}
+	}
+	return nil, ErrNotApprover
+}
+
+// actsAs tells whether the principal, a subject or a "role:" prefixed role,
+// is the caller or one of its roles.
+func (s *rbac) actsAs(principal string) bool {
+	if principal == s.actor.Name {
+		return true
+	}
+	role, ok := strings.CutPrefix(principal, approverRolePrefix)
+	return ok && slices.Contains(s.actor.Roles, role)
+}
+
+// checkAdmin refuses callers that are none of the configured admins.
+func (s *rbac) checkAdmin() error {
+	for _, admin := range s.admins {
+		if s.actsAs(admin) {
+			return nil
+		}
+	}
+	return ErrNotAdmin
+}
+
+func (s *rbac) decideAccessRequest(req *model.AccessRequest) error {
+	ok, err := s.accessRequests.Decide(req, AccessPending)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: it was decided concurrently", ErrAccessRequestStatus)
+	}
+	return nil
+}
+
+// checkNotGranted refuses requests for access the requester already has, so
+// revoking the grant at its expiry never takes away access granted
+// otherwise.
+func (s *rbac) checkNotGranted(req *model.AccessRequest) error {
+	if req.RouteID != nil {
+		bound, err := s.roles.FindByRoute(*req.RouteID)
+		if err != nil {
+			return err
+		}
+		for _, role := range bound {
+			if role.ID == req.RoleID {
+				return ErrAlreadyGranted
+			}
+		}
+		return nil
+	}
+
+	assigned, err := s.assignments.FindRoles(req.Requester)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(assigned, req.Role) {
+		return ErrAlreadyGranted
+	}
+	return nil
+}
+
+func (s *rbac) grantAccess(req *model.AccessRequest) error {
+	if req.RouteID != nil {
+		return s.AddRbac(&model.Rbac{RouteID: *req.RouteID, RoleID: req.RoleID})
+	}
+
+	return s.addAssignment(&model.RoleAssignment{
+		Subject:   req.Requester,
+		RoleID:    req.RoleID,
+		Reason:    req.Reason,
+		ExpiresAt: req.ExpiresAt,
+	})
+}
+
+// parseGrantDuration parses the duration of a grant, 0 if there is none.
+func parseGrantDuration(duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: invalid duration %q", ErrInvalidChange, duration)
+	}
+	return d, nil
+}
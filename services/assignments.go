@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	AuditExpire = "expire"
+
+	EntityAssignment = "assignment"
+)
+
+// AddAssignment assigns the role to the subject, replacing an earlier
+// assignment of the same role. Only admins assign roles directly.
+func (s *rbac) AddAssignment(a *model.RoleAssignment) error {
+	if err := s.checkAdmin(); err != nil {
+		return err
+	}
+	return s.addAssignment(a)
+}
+
+func (s *rbac) DeleteAssignment(subject string, roleID uuid.UUID) error {
+	if err := s.checkAdmin(); err != nil {
+		return err
+	}
+	return s.deleteAssignment(subject, roleID)
+}
+
+// addAssignment assigns the role on behalf of approved requests and
+// break-glass access as well as admins.
+func (s *rbac) addAssignment(a *model.RoleAssignment) error {
+	if a.Subject == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidChange)
+	}
+	if a.ExpiresAt != nil && !a.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at is in the past", ErrInvalidChange)
+	}
+
+	role, err := s.roles.FindByID(a.RoleID)
+	if err != nil {
+		return fmt.Errorf("%w: role %s does not exist", ErrInvalidChange, a.RoleID)
+	}
+	a.Role = role.Name
+	a.GrantedBy = s.actor.Name
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.assignments.Add(a); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityAssignment, assignmentID(a.Subject, a.RoleID), nil, a)
+	})
+}
+
+func (s *rbac) deleteAssignment(subject string, roleID uuid.UUID) error {
+	return s.atomic(func(s *rbac) error {
+		if err := s.assignments.Delete(subject, roleID); err != nil {
+			return err
+		}
+
+		return s.record(AuditDelete, EntityAssignment, assignmentID(subject, roleID), &model.RoleAssignment{Subject: subject, RoleID: roleID}, nil)
+	})
+}
+
+// ExpireAssignments deletes the assignments that expired.
+func (s *rbac) ExpireAssignments() ([]*model.RoleAssignment, error) {
+	expired, err := s.assignments.FindExpired()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*model.RoleAssignment
+	for _, a := range expired {
+		var ok bool
+		err := s.atomic(func(s *rbac) error {
+			var err error
+			if ok, err = s.assignments.Expire(a.Subject, a.RoleID); err != nil || !ok {
+				return err
+			}
+
+			return s.record(AuditExpire, EntityAssignment, assignmentID(a.Subject, a.RoleID), a, nil)
+		})
+		if err != nil {
+			return res, err
+		}
+		if ok {
+			res = append(res, a)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *rbac) FindAssignments(subject string) ([]*model.RoleAssignment, error) {
+	return s.assignments.Find(subject)
+}
+
+// subjectRoles adds the roles assigned to the subject to the roles of its
+// token.
+func (s *rbac) subjectRoles(subject string, roles []string) ([]string, error) {
+	if subject == "" {
+		return roles, nil
+	}
+
+	assigned, err := s.assignments.FindRoles(subject)
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(roles), assigned...), nil
+}
+
+// assignmentID identifies a role assignment in the audit log.
+func assignmentID(subject string, roleID uuid.UUID) string {
+	return subject + ":" + roleID.String()
+}
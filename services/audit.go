@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+// SystemActor makes the changes of background jobs and startup.
+const SystemActor = "system"
+
+// AnonymousActor makes the changes of callers without identity.
+const AnonymousActor = "anonymous"
+
+const (
+	AuditCreate     = "create"
+	AuditUpdate     = "update"
+	AuditDelete     = "delete"
+	AuditRegister   = "register"
+	AuditDeactivate = "deactivate"
+	AuditRename     = "rename"
+	AuditRetire     = "retire"
+	AuditRollback   = "rollback"
+
+	EntityPermission = "permission"
+	EntityPolicy     = "policy"
+	EntityRbac       = "rbac"
+	EntityResource   = "resource"
+	EntityRole       = "role"
+	EntityRoute      = "route"
+	EntityRule       = "rule"
+	EntityService    = "service"
+)
+
+// defaultAuditLimit caps audit queries without a limit.
+const defaultAuditLimit = 100
+
+// As returns the service making its changes on behalf of the actor.
+func (s *rbac) As(actor model.Actor) Rbac {
+	scoped := *s
+	scoped.actor = actor
+	return &scoped
+}
+
+func (s *rbac) FindAudit(filter model.AuditFilter) ([]*model.AuditEntry, error) {
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = defaultAuditLimit
+	}
+	return s.audit.Find(filter)
+}
+
+// record appends a change to the audit log in the transaction of the change,
+// which fails if the entry cannot be written. Changes of roles, routes and
+// bindings are noted for the revision stored at the end of the transaction.
+func (s *rbac) record(action, entity, entityID string, before, after any) error {
+	entry := &model.AuditEntry{
+		Actor:     s.actor.Name,
+		IP:        s.actor.IP,
+		RequestID: s.actor.RequestID,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		Before:    auditJSON(before),
+		After:     auditJSON(after),
+	}
+
+	if err := s.audit.Add(entry, s.sealAudit); err != nil {
+		log.Printf("failed to record %s of %s %s by %s: %v", action, entity, entityID, entry.Actor, err)
+		return err
+	}
+
+	if policyEntities[entity] && s.policyChanges != nil {
+		*s.policyChanges = append(*s.policyChanges, action+" "+entity+" "+entityID)
+	}
+	return nil
+}
+
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+// auditChainPage is the number of entries read at a time when verifying.
+const auditChainPage = 500
+
+// auditContent is what the hash of an audit entry covers. Before and After
+// are canonical JSON, Postgres stores them as jsonb and does not keep the
+// formatting they were written with.
+type auditContent struct {
+	ID        int64           `json:"id"`
+	PrevHash  string          `json:"prev_hash"`
+	Actor     string          `json:"actor"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"request_id"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt string          `json:"created_at"`
+}
+
+// sealAudit hashes the entry and, with a signing key configured, signs the
+// hash.
+func (s *rbac) sealAudit(entry *model.AuditEntry) error {
+	hash, err := auditHash(entry)
+	if err != nil {
+		return err
+	}
+
+	entry.Hash = hex.EncodeToString(hash)
+	entry.Signature = ""
+	if s.auditKey != nil {
+		entry.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.auditKey, hash))
+	}
+	return nil
+}
+
+// VerifyAudit walks the audit chain, checking signatures with the public
+// part of the signing key if one is configured.
+func (s *rbac) VerifyAudit() (*model.AuditVerification, error) {
+	var public ed25519.PublicKey
+	if s.auditKey != nil {
+		public = s.auditKey.Public().(ed25519.PublicKey)
+	}
+	return VerifyAuditChain(s.audit, public)
+}
+
+// VerifyAuditChain walks the audit chain from the first entry and reports
+// the first entry whose hash does not match its content, whose previous hash
+// does not match the entry before it or, given a public key, whose signature
+// does not verify. Entries written before the chain was introduced are
+// counted as unsealed, once the chain starts every entry must be sealed, and
+// once an entry is signed every later one must be. Given a public key every
+// sealed entry must be signed, so stripping signatures breaks the chain.
+func VerifyAuditChain(repo AuditRepo, public ed25519.PublicKey) (*model.AuditVerification, error) {
+	res := &model.AuditVerification{Valid: true}
+	prev, sealed, signed := "", false, false
+
+	var afterID int64
+	for {
+		entries, err := repo.FindChain(afterID, auditChainPage)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			res.Entries++
+			if reason := verifyAuditEntry(entry, prev, sealed, signed, public); reason != "" {
+				res.Valid, res.BrokenID, res.Reason = false, entry.ID, reason
+				return res, nil
+			}
+
+			if entry.Hash == "" {
+				res.Unsealed++
+			} else {
+				sealed = true
+			}
+			if entry.Signature != "" {
+				signed = true
+				if public != nil {
+					res.Signed++
+				}
+			}
+			prev = entry.Hash
+			afterID = entry.ID
+		}
+
+		if len(entries) < auditChainPage {
+			break
+		}
+	}
+
+	res.Head = prev
+	return res, nil
+}
+
+func verifyAuditEntry(entry *model.AuditEntry, prev string, sealed, signed bool, public ed25519.PublicKey) string {
+	if entry.Hash == "" {
+		if sealed {
+			return "entry is not sealed"
+		}
+		return ""
+	}
+
+	if entry.PrevHash != prev {
+		return "previous hash does not match the entry before"
+	}
+
+	hash, err := auditHash(entry)
+	if err != nil {
+		return err.Error()
+	}
+	if hex.EncodeToString(hash) != entry.Hash {
+		return "hash does not match the entry"
+	}
+
+	if entry.Signature == "" {
+		if signed || public != nil {
+			return "entry is not signed"
+		}
+		return ""
+	}
+	if public == nil {
+		return ""
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(entry.Signature)
+	if err != nil || !ed25519.Verify(public, hash, sig) {
+		return "signature does not verify"
+	}
+	return ""
+}
+
+func auditHash(entry *model.AuditEntry) ([]byte, error) {
+	before, err := canonicalJSON(entry.Before)
+	if err != nil {
+		return nil, fmt.Errorf("invalid before of audit entry %d: %w", entry.ID, err)
+	}
+	after, err := canonicalJSON(entry.After)
+	if err != nil {
+		return nil, fmt.Errorf("invalid after of audit entry %d: %w", entry.ID, err)
+	}
+
+	content, err := json.Marshal(auditContent{
+		ID:        entry.ID,
+		PrevHash:  entry.PrevHash,
+		Actor:     entry.Actor,
+		IP:        entry.IP,
+		RequestID: entry.RequestID,
+		Action:    entry.Action,
+		Entity:    entry.Entity,
+		EntityID:  entry.EntityID,
+		Before:    before,
+		After:     after,
+		CreatedAt: entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	return sum[:], nil
+}
+
+// canonicalJSON re-encodes JSON with sorted keys and without whitespace,
+// numbers are kept as written.
+func canonicalJSON(data json.RawMessage) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+// fakeAudit chains entries in memory the way the audit repository does.
+type fakeAudit struct {
+	entries []*model.AuditEntry
+}
+
+func (r *fakeAudit) Add(entry *model.AuditEntry, seal func(*model.AuditEntry) error) error {
+	entry.ID = int64(len(r.entries) + 1)
+	entry.CreatedAt = time.Date(2026, 1, 1, 0, 0, len(r.entries), 0, time.UTC)
+	if n := len(r.entries); n > 0 {
+		entry.PrevHash = r.entries[n-1].Hash
+	}
+	if err := seal(entry); err != nil {
+		return err
+	}
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *fakeAudit) Find(model.AuditFilter) ([]*model.AuditEntry, error) {
+	return r.entries, nil
+}
+
+func (r *fakeAudit) FindChain(afterID int64, limit int) ([]*model.AuditEntry, error) {
+	var res []*model.AuditEntry
+	for _, entry := range r.entries {
+		if entry.ID > afterID && len(res) < limit {
+			res = append(res, entry)
+		}
+	}
+	return res, nil
+}
+
+func testAuditKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+// newAuditChain seals n entries, signed when a key is given.
+func newAuditChain(t *testing.T, key ed25519.PrivateKey, n int) *fakeAudit {
+	t.Helper()
+
+	repo := &fakeAudit{}
+	s := &rbac{auditKey: key}
+	for i := 0; i < n; i++ {
+		entry := &model.AuditEntry{
+			Actor:    "alice",
+			Action:   AuditCreate,
+			Entity:   EntityRole,
+			EntityID: strconv.Itoa(i),
+			After:    json.RawMessage(`{"name": "role-` + strconv.Itoa(i) + `", "id": 1.50}`),
+		}
+		if err := repo.Add(entry, s.sealAudit); err != nil {
+			t.Fatalf("failed to seal entry %d: %v", i, err)
+		}
+	}
+	return repo
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"b": 1, "a": {"d": [1, 2], "c": null}}`, `{"a":{"c":null,"d":[1,2]},"b":1}`},
+		{"{\n  \"name\": \"admin\"\n}", `{"name":"admin"}`},
+		{`{"price": 1.50, "big": 12345678901234567890}`, `{"big":12345678901234567890,"price":1.50}`},
+		{`[3, "x", true]`, `[3,"x",true]`},
+		{``, ``},
+	}
+
+	for _, tt := range tests {
+		got, err := canonicalJSON(json.RawMessage(tt.data))
+		if err != nil {
+			t.Errorf("canonicalJSON(%q) failed: %v", tt.data, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("canonicalJSON(%q) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+
+	if _, err := canonicalJSON(json.RawMessage(`{"name":`)); err == nil {
+		t.Errorf("canonicalJSON of invalid JSON succeeded, want an error")
+	}
+}
+
+func TestAuditHashIgnoresFormatting(t *testing.T) {
+	created := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := &model.AuditEntry{ID: 1, Actor: "alice", After: json.RawMessage(`{"b": 2, "a": 1}`), CreatedAt: created}
+	b := &model.AuditEntry{ID: 1, Actor: "alice", After: json.RawMessage(`{"a":1,"b":2}`), CreatedAt: created.In(time.FixedZone("CET", 3600))}
+
+	hashA, err := auditHash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, err := auditHash(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hashA, hashB) {
+		t.Errorf("hashes of the same entry differ in formatting")
+	}
+
+	b.Actor = "mallory"
+	if hashB, _ = auditHash(b); bytes.Equal(hashA, hashB) {
+		t.Errorf("hashes of different entries are equal")
+	}
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	key := testAuditKey(1)
+	public := key.Public().(ed25519.PublicKey)
+	other := testAuditKey(2)
+
+	tests := []struct {
+		name     string
+		key      ed25519.PrivateKey
+		public   ed25519.PublicKey
+		tamper   func(*fakeAudit)
+		brokenID int64
+		reason   string
+	}{
+		{name: "unsigned chain"},
+		{name: "signed chain", key: key, public: public},
+		{name: "signed chain without key", key: key},
+		{
+			name:     "changed entry",
+			key:      key,
+			public:   public,
+			tamper:   func(r *fakeAudit) { r.entries[1].Actor = "mallory" },
+			brokenID: 2,
+			reason:   "hash does not match the entry",
+		},
+		{
+			name: "changed entry rehashed",
+			tamper: func(r *fakeAudit) {
+				r.entries[1].Actor = "mallory"
+				(&rbac{}).sealAudit(r.entries[1])
+			},
+			brokenID: 3,
+			reason:   "previous hash does not match the entry before",
+		},
+		{
+			name:     "deleted entry",
+			tamper:   func(r *fakeAudit) { r.entries = append(r.entries[:1], r.entries[2:]...) },
+			brokenID: 3,
+			reason:   "previous hash does not match the entry before",
+		},
+		{
+			name:     "stripped signature",
+			key:      key,
+			public:   public,
+			tamper:   func(r *fakeAudit) { r.entries[1].Signature = "" },
+			brokenID: 2,
+			reason:   "entry is not signed",
+		},
+		{
+			name:   "stripped signatures",
+			key:    key,
+			public: public,
+			tamper: func(r *fakeAudit) {
+				for _, entry := range r.entries {
+					entry.Signature = ""
+				}
+			},
+			brokenID: 1,
+			reason:   "entry is not signed",
+		},
+		{
+			name:     "stripped signature without key",
+			key:      key,
+			tamper:   func(r *fakeAudit) { r.entries[2].Signature = "" },
+			brokenID: 3,
+			reason:   "entry is not signed",
+		},
+		{
+			name:   "forged signature",
+			key:    key,
+			public: public,
+			tamper: func(r *fakeAudit) {
+				(&rbac{auditKey: other}).sealAudit(r.entries[1])
+			},
+			brokenID: 2,
+			reason:   "signature does not verify",
+		},
+		{
+			name:     "unsealed entry",
+			tamper:   func(r *fakeAudit) { r.entries[2].Hash = "" },
+			brokenID: 3,
+			reason:   "entry is not sealed",
+		},
+	}
+
+	for _, tt := range tests {
+		repo := newAuditChain(t, tt.key, 3)
+		if tt.tamper != nil {
+			tt.tamper(repo)
+		}
+
+		res, err := VerifyAuditChain(repo, tt.public)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.Valid != (tt.brokenID == 0) || res.BrokenID != tt.brokenID || res.Reason != tt.reason {
+			t.Errorf("%s: got valid %v, broken %d %q, want broken %d %q", tt.name, res.Valid, res.BrokenID, res.Reason, tt.brokenID, tt.reason)
+		}
+	}
+}
+
+func TestVerifyAuditChainCounts(t *testing.T) {
+	key := testAuditKey(1)
+
+	// Entries written before the chain, then more sealed ones than fit on a
+	// page.
+	repo := &fakeAudit{}
+	unsealed := func(*model.AuditEntry) error { return nil }
+	seal := (&rbac{auditKey: key}).sealAudit
+	for i := 0; i < auditChainPage+2; i++ {
+		entry := &model.AuditEntry{Actor: "alice", Action: AuditCreate, Entity: EntityRole, EntityID: strconv.Itoa(i)}
+		if i < 2 {
+			repo.Add(entry, unsealed)
+		} else {
+			repo.Add(entry, seal)
+		}
+	}
+
+	res, err := VerifyAuditChain(repo, key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := model.AuditVerification{
+		Valid:    true,
+		Entries:  auditChainPage + 2,
+		Unsealed: 2,
+		Signed:   auditChainPage,
+		Head:     repo.entries[len(repo.entries)-1].Hash,
+	}
+	if *res != want {
+		t.Errorf("got %+v, want %+v", *res, want)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
+	"github.com/google/uuid"
+)
+
+// Authorize decides whether any of the roles, or of the roles assigned to the
+// subject, is bound to the route the request matches and logs the decision.
+// Routes on an exact host take precedence over wildcard hosts and routes
+// without a host, then the most specific path wins.
+func (s *rbac) Authorize(req model.AuthorizeRequest) (*model.Decision, error) {
+	if req.Method == "" || req.Host == "" || req.Path == "" {
+		return nil, fmt.Errorf("%w: method, host and path are required", ErrInvalidRoute)
+	}
+
+	start := time.Now()
+	roles, err := s.subjectRoles(req.Subject, req.Roles)
+	if err != nil {
+		return nil, err
+	}
+	req.Roles = roles
+
+	decision, err := s.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logDecision(req, decision, time.Since(start))
+	return decision, nil
+}
+
+func (s *rbac) authorize(req model.AuthorizeRequest) (*model.Decision, error) {
+	route, err := s.matchRoute(req)
+	if err != nil {
+		return nil, err
+	}
+
+	decision := &model.Decision{Route: route, Roles: []string{}, RoleIDs: []uuid.UUID{}}
+	if route == nil {
+		decision.Reason = "no active route matches the request"
+		return decision, nil
+	}
+
+	bound, err := s.roles.FindByRoute(route.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[string]bool)
+	for _, role := range req.Roles {
+		requested[role] = true
+	}
+	for _, role := range bound {
+		if requested[role.Name] {
+			decision.Roles = append(decision.Roles, role.Name)
+			decision.RoleIDs = append(decision.RoleIDs, role.ID)
+		}
+	}
+	decision.Allowed = len(decision.Roles) > 0
+
+	if decision.Allowed {
+		decision.Reason = "route is bound to " + strings.Join(decision.Roles, ", ")
+	} else {
+		decision.Reason = "no role of the request is bound to the route"
+	}
+	return decision, nil
+}
+
+// matchRoute returns the active route the request matches, nil if none does.
+func (s *rbac) matchRoute(req model.AuthorizeRequest) (*model.Route, error) {
+	var routes []*model.Route
+	var err error
+	if req.Service != "" {
+		routes, err = s.routes.FindByService(req.Service)
+	} else {
+		routes, err = s.routes.Find()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.Route
+	for _, route := range routes {
+		if !route.Active || !strings.EqualFold(route.Method, req.Method) {
+			continue
+		}
+		if !routepath.MatchHost(route.Host, req.Host) || !routepath.Match(route.Path, req.Path) {
+			continue
+		}
+
+		if best == nil || precedes(route, best) {
+			best = route
+		}
+	}
+
+	return best, nil
+}
+
+func precedes(a, b *model.Route) bool {
+	if ra, rb := routepath.HostRank(a.Host), routepath.HostRank(b.Host); ra != rb {
+		return ra < rb
+	}
+	return routepath.Precedes(a.Path, b.Path)
+}
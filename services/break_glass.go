@@ -0,0 +1,309 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	AuditBreakGlass = "break_glass"
+	AuditEnd        = "end"
+
+	EntityBreakGlass = "break_glass"
+)
+
+// Events sent to hooks.
+const (
+	EventBreakGlassStarted = "break_glass.started"
+	EventBreakGlassEnded   = "break_glass.ended"
+	EventBreakGlassExpired = "break_glass.expired"
+)
+
+// minJustification is the shortest justification accepted for break-glass
+// access.
+const minJustification = 10
+
+// reportLimit caps the changes and decisions of an incident report.
+const reportLimit = 1000
+
+// BreakGlassConfig sets the role break-glass access grants, for how long and
+// who may start it: subjects, or "role:<name>" for callers with the role in
+// their JWT. Without a role break-glass access is disabled, without eligible
+// callers nobody may start it.
+type BreakGlassConfig struct {
+	Role     string
+	Duration time.Duration
+	Eligible []string
+}
+
+var (
+	// ErrBreakGlassDisabled is returned when no break-glass role is
+	// configured.
+	ErrBreakGlassDisabled = errors.New("break-glass access is not configured")
+
+	// ErrBreakGlassActive is returned when the caller has active break-glass
+	// access already.
+	ErrBreakGlassActive = errors.New("break-glass access is already active")
+
+	// ErrBreakGlassEnded is returned when ending access that ended already.
+	ErrBreakGlassEnded = errors.New("break-glass access ended already")
+
+	// ErrNotEligible is returned when the caller may not start break-glass
+	// access.
+	ErrNotEligible = errors.New("not eligible for break-glass access")
+)
+
+// StartBreakGlass assigns the break-glass role to an eligible caller for the
+// configured duration without approval. The access is audited, logged and
+// sent to the hooks.
+func (s *rbac) StartBreakGlass(justification string) (*model.BreakGlass, error) {
+	if s.breakGlassCfg.Role == "" {
+		return nil, ErrBreakGlassDisabled
+	}
+	if s.actor.Name == AnonymousActor || s.actor.Name == SystemActor {
+		return nil, fmt.Errorf("%w: break-glass access needs the identity of the caller", ErrInvalidChange)
+	}
+	if !slices.ContainsFunc(s.breakGlassCfg.Eligible, s.actsAs) {
+		return nil, ErrNotEligible
+	}
+	if justification = strings.TrimSpace(justification); len(justification) < minJustification {
+		return nil, fmt.Errorf("%w: justify break-glass access in at least %d characters", ErrInvalidChange, minJustification)
+	}
+
+	role, err := s.breakGlassRole()
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(s.actor.Roles, role.Name) {
+		return nil, ErrAlreadyGranted
+	}
+
+	var active, b *model.BreakGlass
+	err = s.atomic(func(s *rbac) error {
+		var err error
+		if active, err = s.breakGlass.FindActive(s.actor.Name); err != nil {
+			return err
+		}
+		if active != nil {
+			if time.Now().Before(active.ExpiresAt) {
+				return ErrBreakGlassActive
+			}
+			if err := s.endBreakGlass(active, active.ExpiresAt, AuditExpire); err != nil {
+				return err
+			}
+		}
+
+		assigned, err := s.assignments.FindRoles(s.actor.Name)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(assigned, role.Name) {
+			return ErrAlreadyGranted
+		}
+
+		now := time.Now().UTC()
+		b = &model.BreakGlass{
+			ID:            uuid.New(),
+			Actor:         s.actor.Name,
+			RoleID:        role.ID,
+			Role:          role.Name,
+			Justification: justification,
+			StartedAt:     now,
+			ExpiresAt:     now.Add(s.breakGlassCfg.Duration),
+		}
+		ok, err := s.breakGlass.Add(b)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrBreakGlassActive
+		}
+
+		err = s.addAssignment(&model.RoleAssignment{
+			Subject:   b.Actor,
+			RoleID:    b.RoleID,
+			Reason:    "break-glass: " + justification,
+			ExpiresAt: &b.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.record(AuditBreakGlass, EntityBreakGlass, b.ID.String(), nil, b)
+	})
+	if errors.Is(err, ErrBreakGlassActive) {
+		if active == nil {
+			// Started concurrently.
+			active, _ = s.breakGlass.FindActive(s.actor.Name)
+		}
+		return active, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if active != nil {
+		s.announceEnd(active, AuditExpire, EventBreakGlassExpired)
+	}
+	log.Printf("BREAK-GLASS: %s was granted role %s until %s: %s", b.Actor, b.Role, b.ExpiresAt.Format(time.RFC3339), b.Justification)
+	s.notify(EventBreakGlassStarted, b, fmt.Sprintf("Break-glass: %s was granted role %s until %s. Justification: %s",
+		b.Actor, b.Role, b.ExpiresAt.Format(time.RFC3339), b.Justification))
+	return b, nil
+}
+
+// EndBreakGlass revokes break-glass access before it expires. Only its
+// holder or an admin ends it.
+func (s *rbac) EndBreakGlass(id uuid.UUID) (*model.BreakGlass, error) {
+	b, err := s.breakGlass.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Actor != s.actor.Name {
+		if err := s.checkAdmin(); err != nil {
+			return nil, err
+		}
+	}
+	if b.EndedAt != nil {
+		return nil, ErrBreakGlassEnded
+	}
+
+	err = s.atomic(func(s *rbac) error {
+		return s.endBreakGlass(b, time.Now().UTC(), AuditEnd)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.announceEnd(b, AuditEnd, EventBreakGlassEnded)
+	return b, nil
+}
+
+// ExpireBreakGlass ends the break-glass accesses past their expiry. Their
+// assignments are revoked by ExpireAssignments.
+func (s *rbac) ExpireBreakGlass() ([]*model.BreakGlass, error) {
+	expired, err := s.breakGlass.FindExpired()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*model.BreakGlass
+	for _, b := range expired {
+		err := s.atomic(func(s *rbac) error {
+			return s.endBreakGlass(b, b.ExpiresAt, AuditExpire)
+		})
+		if err != nil {
+			return res, err
+		}
+
+		s.announceEnd(b, AuditExpire, EventBreakGlassExpired)
+		res = append(res, b)
+	}
+
+	return res, nil
+}
+
+func (s *rbac) FindBreakGlass(id uuid.UUID) (*model.BreakGlass, error) {
+	return s.breakGlass.FindByID(id)
+}
+
+func (s *rbac) FindBreakGlasses(active bool) ([]*model.BreakGlass, error) {
+	return s.breakGlass.Find(active)
+}
+
+// FindBreakGlassReport lists the changes the actor made and the decisions
+// logged for the actor while the access was active, newest first. Decisions
+// of callers holding the break-glass role are never sampled out or dropped,
+// but count only if logged with the actor as subject.
+func (s *rbac) FindBreakGlassReport(id uuid.UUID) (*model.BreakGlassReport, error) {
+	b, err := s.breakGlass.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now().UTC()
+	if b.EndedAt != nil {
+		to = *b.EndedAt
+	}
+	// Entries at the very end of the window still belong to it.
+	to = to.Add(time.Microsecond)
+
+	report := &model.BreakGlassReport{BreakGlass: b}
+
+	report.Changes, err = s.audit.Find(model.AuditFilter{Actor: b.Actor, From: b.StartedAt, To: to, Limit: reportLimit})
+	if err != nil {
+		return nil, err
+	}
+	if report.Changes == nil {
+		report.Changes = []*model.AuditEntry{}
+	}
+
+	report.Decisions, err = s.decisions.Find(model.DecisionFilter{Subject: b.Actor, From: b.StartedAt, To: to, Limit: reportLimit})
+	if err != nil {
+		return nil, err
+	}
+	if report.Decisions == nil {
+		report.Decisions = []*model.DecisionLog{}
+	}
+
+	return report, nil
+}
+
+func (s *rbac) breakGlassRole() (*model.Role, error) {
+	roles, err := s.roles.Find()
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role.Name == s.breakGlassCfg.Role {
+			return role, nil
+		}
+	}
+	return nil, fmt.Errorf("break-glass role %s does not exist", s.breakGlassCfg.Role)
+}
+
+// endBreakGlass ends the access, revoking its assignment unless it expired.
+// It runs in a transaction, announceEnd reports the end once committed.
+func (s *rbac) endBreakGlass(b *model.BreakGlass, at time.Time, action string) error {
+	by := s.actor.Name
+	if action == AuditExpire {
+		by = SystemActor
+	}
+
+	ok, err := s.breakGlass.End(b.ID, at, by)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBreakGlassEnded
+	}
+	b.EndedAt, b.EndedBy = &at, by
+
+	if action != AuditExpire {
+		if err := s.deleteAssignment(b.Actor, b.RoleID); err != nil {
+			return err
+		}
+	}
+
+	return s.record(action, EntityBreakGlass, b.ID.String(), nil, b)
+}
+
+// announceEnd reports the end of the access like its start.
+func (s *rbac) announceEnd(b *model.BreakGlass, action, event string) {
+	log.Printf("BREAK-GLASS: access of %s to role %s ended by %s", b.Actor, b.Role, b.EndedBy)
+	s.notify(event, b, fmt.Sprintf("Break-glass access of %s to role %s ended (%s by %s).", b.Actor, b.Role, action, b.EndedBy))
+}
+
+func (s *rbac) notify(event string, data any, message string) {
+	if s.notifier == nil {
+		return
+	}
+	s.notifier.Notify(&model.Event{Type: event, Actor: s.actor.Name, Message: message, Data: data})
+}
@@ -0,0 +1,598 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
+	"github.com/google/uuid"
+)
+
+// Statuses of change sets. Drafts can be edited, which takes back an
+// approval; approved change sets can be published. Published and discarded
+// change sets are final.
+const (
+	ChangeSetDraft     = "draft"
+	ChangeSetApproved  = "approved"
+	ChangeSetPublished = "published"
+	ChangeSetDiscarded = "discarded"
+)
+
+const (
+	AuditApprove = "approve"
+	AuditDiscard = "discard"
+	AuditPublish = "publish"
+
+	EntityChangeSet = "change_set"
+)
+
+var (
+	// ErrInvalidChange is returned for operations that cannot be staged.
+	ErrInvalidChange = errors.New("invalid change")
+
+	// ErrChangeSetStatus is returned when the status of the change set does
+	// not allow the action.
+	ErrChangeSetStatus = errors.New("invalid change set status")
+
+	// ErrChangeSetChanged is returned when the change set was changed by
+	// someone else since it was read.
+	ErrChangeSetChanged = errors.New("change set was changed concurrently, reload it and try again")
+
+	// ErrChangeSetConflict is returned when the live policy drifted from what
+	// the operations were staged against.
+	ErrChangeSetConflict = errors.New("live policy changed in conflicting ways")
+
+	// ErrSelfApproval is returned when a contributor of a change set, the
+	// requester of an access request or a caller without identity approves
+	// or rejects it.
+	ErrSelfApproval = errors.New("approvals must come from a user other than the author")
+)
+
+func (s *rbac) AddChangeSet(cs *model.ChangeSet) error {
+	if cs.Title == "" {
+		return fmt.Errorf("%w: missing title", ErrInvalidChange)
+	}
+
+	cs.ID = uuid.New()
+	cs.Status = ChangeSetDraft
+	cs.Author = s.actor.Name
+	cs.Contributors = []string{s.actor.Name}
+	cs.Operations = []model.ChangeOperation{}
+	cs.ApprovedBy, cs.ApprovedAt = "", nil
+	cs.PublishedBy, cs.PublishedAt, cs.Revision = "", nil, 0
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.changeSets.Add(cs); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityChangeSet, cs.ID.String(), nil, cs)
+	})
+}
+
+// AddChangeOperations stages the operations in the change set, returning it
+// to draft if it was approved.
+func (s *rbac) AddChangeOperations(id uuid.UUID, ops []model.ChangeOperation) (*model.ChangeSet, error) {
+	cs, err := s.editableChangeSet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ops {
+		if err := s.stageChange(cs, &ops[i]); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		cs.Operations = append(cs.Operations, ops[i])
+	}
+
+	return cs, s.updateChangeSet(cs, ChangeSetDraft)
+}
+
+// DeleteChangeOperation removes the operation at the index from the change
+// set, returning it to draft if it was approved.
+func (s *rbac) DeleteChangeOperation(id uuid.UUID, index int) (*model.ChangeSet, error) {
+	cs, err := s.editableChangeSet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(cs.Operations) {
+		return nil, fmt.Errorf("%w: no operation %d", ErrInvalidChange, index)
+	}
+	cs.Operations = append(cs.Operations[:index], cs.Operations[index+1:]...)
+
+	return cs, s.updateChangeSet(cs, ChangeSetDraft)
+}
+
+func (s *rbac) ApproveChangeSet(id uuid.UUID) (*model.ChangeSet, error) {
+	cs, err := s.changeSets.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs.Status != ChangeSetDraft {
+		return nil, fmt.Errorf("%w: %s, only drafts can be approved", ErrChangeSetStatus, cs.Status)
+	}
+	if len(cs.Operations) == 0 {
+		return nil, fmt.Errorf("%w: the change set has no operations", ErrInvalidChange)
+	}
+	if s.actor.Name == AnonymousActor || s.actor.Name == SystemActor {
+		return nil, ErrSelfApproval
+	}
+	if s.actor.Name == cs.Author || slices.Contains(cs.Contributors, s.actor.Name) {
+		return nil, fmt.Errorf("%w: %s contributed to the change set", ErrSelfApproval, s.actor.Name)
+	}
+
+	now := time.Now().UTC()
+	cs.ApprovedBy, cs.ApprovedAt = s.actor.Name, &now
+	err = s.atomic(func(s *rbac) error {
+		if err := s.updateChangeSet(cs, ChangeSetApproved); err != nil {
+			return err
+		}
+
+		return s.record(AuditApprove, EntityChangeSet, cs.ID.String(), nil, cs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (s *rbac) DiscardChangeSet(id uuid.UUID) (*model.ChangeSet, error) {
+	cs, err := s.editableChangeSet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.atomic(func(s *rbac) error {
+		if err := s.updateChangeSet(cs, ChangeSetDiscarded); err != nil {
+			return err
+		}
+
+		return s.record(AuditDiscard, EntityChangeSet, cs.ID.String(), nil, cs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (s *rbac) FindChangeSet(id uuid.UUID) (*model.ChangeSet, error) {
+	return s.changeSets.FindByID(id)
+}
+
+func (s *rbac) FindChangeSets(status string) ([]*model.ChangeSet, error) {
+	return s.changeSets.Find(status)
+}
+
+// PreviewChangeSet diffs the live policy against the policy publishing the
+// change set would result in, and lists the operations that conflict with
+// the live policy.
+func (s *rbac) PreviewChangeSet(id uuid.UUID) (*model.ChangeSetPreview, error) {
+	cs, err := s.changeSets.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := s.revisions.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	result, conflicts := applyChanges(live, cs.Operations)
+	return &model.ChangeSetPreview{Diff: diffSnapshots(live, result), Conflicts: conflicts}, nil
+}
+
+// PublishChangeSet applies all operations of the approved change set in one
+// transaction. If the live policy drifted in a way that conflicts with them
+// nothing is applied and the conflicts are returned with
+// ErrChangeSetConflict.
+func (s *rbac) PublishChangeSet(id uuid.UUID) (*model.ChangeSet, []model.ChangeConflict, error) {
+	cs, err := s.changeSets.FindByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cs.Status != ChangeSetApproved {
+		return nil, nil, fmt.Errorf("%w: %s, only approved change sets can be published", ErrChangeSetStatus, cs.Status)
+	}
+
+	var conflicts []model.ChangeConflict
+	cs.Status, cs.PublishedBy = ChangeSetPublished, s.actor.Name
+	err = s.atomic(func(s *rbac) error {
+		ok, err := s.changeSets.Publish(cs, func(live *model.PolicySnapshot) error {
+			if _, conflicts = applyChanges(live, cs.Operations); len(conflicts) > 0 {
+				return ErrChangeSetConflict
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrChangeSetChanged
+		}
+
+		for _, op := range cs.Operations {
+			if err := s.recordChange(op); err != nil {
+				return err
+			}
+		}
+		return s.record(AuditPublish, EntityChangeSet, cs.ID.String(), nil, cs)
+	})
+	if err != nil {
+		return nil, conflicts, err
+	}
+	return cs, nil, nil
+}
+
+// editableChangeSet finds the change set if it is a draft or approved.
+func (s *rbac) editableChangeSet(id uuid.UUID) (*model.ChangeSet, error) {
+	cs, err := s.changeSets.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs.Status != ChangeSetDraft && cs.Status != ChangeSetApproved {
+		return nil, fmt.Errorf("%w: the change set is %s", ErrChangeSetStatus, cs.Status)
+	}
+	return cs, nil
+}
+
+// updateChangeSet saves the change set with the status. Returning to draft
+// means the operations were edited: the approval is taken back and the
+// caller becomes a contributor, who cannot approve the change set.
+func (s *rbac) updateChangeSet(cs *model.ChangeSet, status string) error {
+	if status == ChangeSetDraft {
+		cs.ApprovedBy, cs.ApprovedAt = "", nil
+		if !slices.Contains(cs.Contributors, s.actor.Name) {
+			cs.Contributors = append(cs.Contributors, s.actor.Name)
+		}
+	}
+	cs.Status = status
+
+	ok, err := s.changeSets.Update(cs)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrChangeSetChanged
+	}
+	return nil
+}
+
+// stageChange validates the operation and sets the live role or route it
+// is staged against. Roles and routes added earlier in the change set have
+// no live counterpart.
+func (s *rbac) stageChange(cs *model.ChangeSet, op *model.ChangeOperation) error {
+	op.BaseRole, op.BaseRoute = nil, nil
+
+	n := 0
+	for _, set := range []bool{op.Role != nil, op.Route != nil, op.Rbac != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("%w: an operation changes exactly one of role, route or rbac", ErrInvalidChange)
+	}
+
+	switch {
+	case op.Role != nil:
+		return s.stageRoleChange(cs, op)
+	case op.Route != nil:
+		return s.stageRouteChange(cs, op)
+	default:
+		return s.stageRbacChange(cs, op)
+	}
+}
+
+func (s *rbac) stageRoleChange(cs *model.ChangeSet, op *model.ChangeOperation) error {
+	if op.Op == model.ChangeAdd {
+		if op.Role.ID == uuid.Nil {
+			op.Role.ID = uuid.New()
+		}
+		if op.Role.Name == "" {
+			return fmt.Errorf("%w: missing role name", ErrInvalidChange)
+		}
+		return nil
+	}
+
+	if op.Op != model.ChangeUpdate && op.Op != model.ChangeDelete {
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidChange, op.Op)
+	}
+	if op.Op == model.ChangeUpdate && op.Role.Name == "" {
+		return fmt.Errorf("%w: missing role name", ErrInvalidChange)
+	}
+	if stagedRole(cs, op.Role.ID) {
+		return nil
+	}
+
+	live, err := s.roles.FindByID(op.Role.ID)
+	if err != nil {
+		return fmt.Errorf("%w: role %s does not exist", ErrInvalidChange, op.Role.ID)
+	}
+	op.BaseRole = live
+	if op.Op == model.ChangeDelete {
+		op.Role = live
+	}
+	return nil
+}
+
+func (s *rbac) stageRouteChange(cs *model.ChangeSet, op *model.ChangeOperation) error {
+	if op.Op != model.ChangeAdd && op.Op != model.ChangeUpdate && op.Op != model.ChangeDelete {
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidChange, op.Op)
+	}
+
+	if op.Op == model.ChangeAdd && op.Route.ID == uuid.Nil {
+		op.Route.ID = uuid.New()
+	}
+	if op.Op != model.ChangeDelete {
+		op.Route.Replaces, op.Route.Versions, op.Route.Metadata = "", nil, nil
+		if err := normalizeRoute(op.Route, routepath.Auto); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidChange, err)
+		}
+	}
+	if op.Op == model.ChangeAdd || stagedRoute(cs, op.Route.ID) {
+		return nil
+	}
+
+	live, err := s.routes.FindByID(op.Route.ID)
+	if err != nil {
+		return fmt.Errorf("%w: route %s does not exist", ErrInvalidChange, op.Route.ID)
+	}
+	op.BaseRoute = live
+	if op.Op == model.ChangeDelete {
+		op.Route = live
+	}
+	return nil
+}
+
+func (s *rbac) stageRbacChange(cs *model.ChangeSet, op *model.ChangeOperation) error {
+	if op.Op != model.ChangeAdd && op.Op != model.ChangeDelete {
+		return fmt.Errorf("%w: bindings can only be added or deleted", ErrInvalidChange)
+	}
+	if op.Rbac.RouteID == uuid.Nil || op.Rbac.RoleID == uuid.Nil {
+		return fmt.Errorf("%w: missing route_id or role_id", ErrInvalidChange)
+	}
+	op.Rbac.RuleID = nil
+
+	if op.Op == model.ChangeDelete {
+		return nil
+	}
+
+	if !stagedRoute(cs, op.Rbac.RouteID) {
+		exists, err := s.routes.ExistsByID(op.Rbac.RouteID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: route %s does not exist", ErrInvalidChange, op.Rbac.RouteID)
+		}
+	}
+
+	if !stagedRole(cs, op.Rbac.RoleID) {
+		exists, err := s.roles.ExistsByID(op.Rbac.RoleID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: role %s does not exist", ErrInvalidChange, op.Rbac.RoleID)
+		}
+	}
+	return nil
+}
+
+// recordChange audits a published operation like the direct change would
+// be.
+func (s *rbac) recordChange(op model.ChangeOperation) error {
+	action := map[string]string{
+		model.ChangeAdd:    AuditCreate,
+		model.ChangeUpdate: AuditUpdate,
+		model.ChangeDelete: AuditDelete,
+	}[op.Op]
+
+	switch {
+	case op.Role != nil && op.Op == model.ChangeAdd:
+		return s.record(action, EntityRole, op.Role.ID.String(), nil, op.Role)
+	case op.Role != nil && op.Op == model.ChangeDelete:
+		return s.record(action, EntityRole, op.Role.ID.String(), op.Role, nil)
+	case op.Role != nil:
+		return s.record(action, EntityRole, op.Role.ID.String(), op.BaseRole, op.Role)
+	case op.Route != nil && op.Op == model.ChangeAdd:
+		return s.record(action, EntityRoute, op.Route.ID.String(), nil, op.Route)
+	case op.Route != nil && op.Op == model.ChangeDelete:
+		return s.record(action, EntityRoute, op.Route.ID.String(), op.Route, nil)
+	case op.Route != nil:
+		return s.record(action, EntityRoute, op.Route.ID.String(), op.BaseRoute, op.Route)
+	case op.Op == model.ChangeAdd:
+		return s.record(action, EntityRbac, rbacID(op.Rbac), nil, op.Rbac)
+	default:
+		return s.record(action, EntityRbac, rbacID(op.Rbac), op.Rbac, nil)
+	}
+}
+
+func stagedRole(cs *model.ChangeSet, id uuid.UUID) bool {
+	for _, op := range cs.Operations {
+		if op.Op == model.ChangeAdd && op.Role != nil && op.Role.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func stagedRoute(cs *model.ChangeSet, id uuid.UUID) bool {
+	for _, op := range cs.Operations {
+		if op.Op == model.ChangeAdd && op.Route != nil && op.Route.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// applyChanges applies the operations to a copy of the live policy. An
+// operation conflicts when the role or route it was staged against changed
+// or is gone, when it would duplicate a role name or route, or when it binds
+// a role or route that does not exist. Conflicting operations are skipped.
+func applyChanges(live *model.PolicySnapshot, ops []model.ChangeOperation) (*model.PolicySnapshot, []model.ChangeConflict) {
+	liveRoles := make(map[uuid.UUID]model.Role)
+	roles := make(map[uuid.UUID]model.Role)
+	for _, role := range live.Roles {
+		liveRoles[role.ID] = role
+		roles[role.ID] = role
+	}
+
+	liveRoutes := make(map[uuid.UUID]model.Route)
+	routes := make(map[uuid.UUID]model.Route)
+	for _, route := range live.Routes {
+		liveRoutes[route.ID] = route
+		routes[route.ID] = route
+	}
+
+	bindings := make(map[string]model.Rbac)
+	for _, binding := range live.Rbac {
+		bindings[rbacID(&binding)] = binding
+	}
+
+	conflicts := []model.ChangeConflict{}
+	conflict := func(i int, format string, args ...any) {
+		conflicts = append(conflicts, model.ChangeConflict{Operation: i, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	for i, op := range ops {
+		switch {
+		case op.Role != nil:
+			role := *op.Role
+			if base := op.BaseRole; base != nil {
+				if current, ok := liveRoles[base.ID]; !ok {
+					conflict(i, "role %s was deleted", base.Name)
+					continue
+				} else if current != *base {
+					conflict(i, "role %s was renamed to %s", base.Name, current.Name)
+					continue
+				}
+			}
+
+			_, exists := roles[role.ID]
+			switch {
+			case op.Op == model.ChangeDelete:
+				delete(roles, role.ID)
+				for key, binding := range bindings {
+					if binding.RoleID == role.ID {
+						delete(bindings, key)
+					}
+				}
+			case op.Op == model.ChangeAdd && exists:
+				conflict(i, "role %s already exists", role.ID)
+			case op.Op == model.ChangeUpdate && !exists:
+				conflict(i, "role %s does not exist", role.ID)
+			case roleNameTaken(roles, role):
+				conflict(i, "role name %s is taken", role.Name)
+			default:
+				roles[role.ID] = role
+			}
+
+		case op.Route != nil:
+			route := *op.Route
+			if base := op.BaseRoute; base != nil {
+				if current, ok := liveRoutes[base.ID]; !ok {
+					conflict(i, "route %s %s was deleted", base.Method, base.Path)
+					continue
+				} else if routeChanged(current, *base) {
+					conflict(i, "route %s %s was changed", base.Method, base.Path)
+					continue
+				}
+			}
+
+			_, exists := routes[route.ID]
+			switch {
+			case op.Op == model.ChangeDelete:
+				delete(routes, route.ID)
+				for key, binding := range bindings {
+					if binding.RouteID == route.ID {
+						delete(bindings, key)
+					}
+				}
+			case op.Op == model.ChangeAdd && exists:
+				conflict(i, "route %s already exists", route.ID)
+			case op.Op == model.ChangeUpdate && !exists:
+				conflict(i, "route %s does not exist", route.ID)
+			case routeTaken(routes, route):
+				conflict(i, "route %s %s%s of %s already exists", route.Method, route.Host, route.Path, route.Service)
+			default:
+				if base, ok := routes[route.ID]; ok {
+					route.Metadata = base.Metadata
+				}
+				routes[route.ID] = route
+			}
+
+		case op.Rbac != nil:
+			binding := model.Rbac{RouteID: op.Rbac.RouteID, RoleID: op.Rbac.RoleID}
+			key := rbacID(&binding)
+			if op.Op == model.ChangeDelete {
+				delete(bindings, key)
+				continue
+			}
+
+			if _, ok := routes[binding.RouteID]; !ok {
+				conflict(i, "route %s does not exist", binding.RouteID)
+			} else if _, ok := roles[binding.RoleID]; !ok {
+				conflict(i, "role %s does not exist", binding.RoleID)
+			} else if _, ok := bindings[key]; !ok {
+				bindings[key] = binding
+			}
+		}
+	}
+
+	result := &model.PolicySnapshot{
+		Roles:  make([]model.Role, 0, len(roles)),
+		Routes: make([]model.Route, 0, len(routes)),
+		Rbac:   make([]model.Rbac, 0, len(bindings)),
+	}
+	for _, role := range roles {
+		result.Roles = append(result.Roles, role)
+	}
+	sort.Slice(result.Roles, func(i, j int) bool { return result.Roles[i].Name < result.Roles[j].Name })
+	for _, route := range routes {
+		result.Routes = append(result.Routes, route)
+	}
+	sort.Slice(result.Routes, func(i, j int) bool {
+		a, b := result.Routes[i], result.Routes[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method+" "+a.Host < b.Method+" "+b.Host
+	})
+	for _, binding := range bindings {
+		result.Rbac = append(result.Rbac, binding)
+	}
+	sort.Slice(result.Rbac, func(i, j int) bool { return rbacID(&result.Rbac[i]) < rbacID(&result.Rbac[j]) })
+
+	return result, conflicts
+}
+
+func roleNameTaken(roles map[uuid.UUID]model.Role, role model.Role) bool {
+	for _, other := range roles {
+		if other.Name == role.Name && other.ID != role.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func routeTaken(routes map[uuid.UUID]model.Route, route model.Route) bool {
+	for _, other := range routes {
+		if other.ID != route.ID && other.Method == route.Method && other.Host == route.Host &&
+			other.Path == route.Path && other.Service == route.Service {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"sort"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
+	"github.com/google/uuid"
+)
+
+const (
+	// ConflictDuplicate routes differ only in parameter names.
+	ConflictDuplicate = "duplicate"
+	// ConflictShadowed routes match a subset of the paths of the other route,
+	// e.g. "/users/me" of "/users/:id". Routers usually pick the narrower one.
+	ConflictShadowed = "shadowed"
+	// ConflictOverlap routes share some paths without one containing the
+	// other, e.g. "/a/:x/c" and "/a/b/:y".
+	ConflictOverlap = "overlap"
+)
+
+// FindRouteConflicts reports the active routes of the service that match the
+// same requests.
+func (s *rbac) FindRouteConflicts(service string) ([]model.RouteConflict, error) {
+	stored, err := s.routes.FindByService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []model.Route
+	for _, route := range stored {
+		if route.Active {
+			routes = append(routes, *route)
+		}
+	}
+
+	conflicts := findConflicts(routes, nil)
+	if err := s.conflictRoles(conflicts, nil); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// registrationConflicts reports conflicts the registration introduces, i.e.
+// those involving added or reactivated routes. Routes of other versions of the
+// service stay active and are taken into account.
+func (s *rbac) registrationConflicts(diff *model.RouteDiff, existing []*model.Route, routes []model.Route) ([]model.RouteConflict, error) {
+	active := append([]model.Route{}, routes...)
+
+	submitted := make(map[string]bool)
+	for _, route := range routes {
+		submitted[routeKey(route)] = true
+	}
+	removed := make(map[uuid.UUID]bool)
+	for _, route := range diff.Removed {
+		removed[route.ID] = true
+	}
+	for _, route := range existing {
+		if route.Active && !submitted[routeKey(*route)] && !removed[route.ID] {
+			active = append(active, *route)
+		}
+	}
+
+	involving := make(map[uuid.UUID]bool)
+	for _, route := range diff.Added {
+		involving[route.ID] = true
+	}
+	for _, route := range diff.Reactivated {
+		involving[route.ID] = true
+	}
+	if len(involving) == 0 {
+		return []model.RouteConflict{}, nil
+	}
+
+	conflicts := findConflicts(active, involving)
+	if err := s.conflictRoles(conflicts, diff.Bound); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// findConflicts compares the routes of the same method pairwise, on hosts and
+// paths, skipping pairs without a route from involving unless it is nil.
+func findConflicts(routes []model.Route, involving map[uuid.UUID]bool) []model.RouteConflict {
+	conflicts := []model.RouteConflict{}
+
+	for i := range routes {
+		for j := i + 1; j < len(routes); j++ {
+			a, b := routes[i], routes[j]
+			if a.Method != b.Method {
+				continue
+			}
+			if involving != nil && !involving[a.ID] && !involving[b.ID] {
+				continue
+			}
+
+			relation, example := routepath.Compare(a.Path, b.Path)
+			relation = routepath.Combine(routepath.CompareHosts(a.Host, b.Host), relation)
+			conflict := model.RouteConflict{Route: a, Other: b, Example: example}
+			switch relation {
+			case routepath.Disjoint:
+				continue
+			case routepath.Equal:
+				conflict.Kind = ConflictDuplicate
+			case routepath.Narrower:
+				conflict.Kind = ConflictShadowed
+			case routepath.Wider:
+				conflict.Kind = ConflictShadowed
+				conflict.Route, conflict.Other = b, a
+			case routepath.Overlapping:
+				conflict.Kind = ConflictOverlap
+			}
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts
+}
+
+// conflictRoles fills in the roles bound to only one route of each conflict.
+// Bindings a registration is about to create are passed as bound.
+func (s *rbac) conflictRoles(conflicts []model.RouteConflict, bound []model.Rbac) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	names := make(map[uuid.UUID]string)
+	if len(bound) > 0 {
+		roles, err := s.roles.Find()
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			names[role.ID] = role.Name
+		}
+	}
+
+	byRoute := make(map[uuid.UUID]map[string]bool)
+	rolesOf := func(routeID uuid.UUID) (map[string]bool, error) {
+		if roles, ok := byRoute[routeID]; ok {
+			return roles, nil
+		}
+
+		stored, err := s.roles.FindByRoute(routeID)
+		if err != nil {
+			return nil, err
+		}
+		roles := make(map[string]bool)
+		for _, role := range stored {
+			roles[role.Name] = true
+		}
+		for _, binding := range bound {
+			if binding.RouteID == routeID {
+				roles[names[binding.RoleID]] = true
+			}
+		}
+
+		byRoute[routeID] = roles
+		return roles, nil
+	}
+
+	for i := range conflicts {
+		route, err := rolesOf(conflicts[i].Route.ID)
+		if err != nil {
+			return err
+		}
+		other, err := rolesOf(conflicts[i].Other.ID)
+		if err != nil {
+			return err
+		}
+		conflicts[i].RolesOnlyRoute = missingRoles(route, other)
+		conflicts[i].RolesOnlyOther = missingRoles(other, route)
+	}
+
+	return nil
+}
+
+// missingRoles returns the roles of a that b lacks, sorted.
+func missingRoles(a, b map[string]bool) []string {
+	res := []string{}
+	for role := range a {
+		if !b[role] {
+			res = append(res, role)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/demkowo/rbac/decisionlog"
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	SourceAuthorize = "authorize"
+	sourceEnforcer  = "enforcer:"
+
+	defaultDecisionLimit = 100
+)
+
+func (s *rbac) FindDecisions(filter model.DecisionFilter) ([]*model.DecisionLog, error) {
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = defaultDecisionLimit
+	}
+	return s.decisions.Find(filter)
+}
+
+// RecordDecisions logs decisions an enforcer embedded in the service made on
+// its own. Their sample rate tells whether the enforcer sampled them already.
+func (s *rbac) RecordDecisions(service string, decisions []model.DecisionLog) error {
+	for i := range decisions {
+		d := decisions[i]
+		if d.Effect != decisionlog.Allow && d.Effect != decisionlog.Deny {
+			return errors.New("effect must be allow or deny")
+		}
+		if d.Method == "" || d.Path == "" {
+			return errors.New("method and path are required")
+		}
+		if d.SampleRate < 0 || d.SampleRate > 1 {
+			return errors.New("sample rate must be between 0 and 1")
+		}
+	}
+
+	for i := range decisions {
+		d := decisions[i]
+		d.Source = sourceEnforcer + service
+		d.Service = service
+		d.Method = strings.ToUpper(d.Method)
+		d.Keep = s.keepDecision(d.Roles)
+		roleIDs, err := s.boundRoleIDs(d)
+		if err != nil {
+			return err
+		}
+		d.RoleIDs = roleIDs
+		s.log(&d)
+	}
+	return nil
+}
+
+func (s *rbac) logDecision(req model.AuthorizeRequest, decision *model.Decision, latency time.Duration) {
+	subject := req.Subject
+	if subject == "" {
+		subject = s.actor.Name
+	}
+
+	entry := &model.DecisionLog{
+		Source:    SourceAuthorize,
+		RequestID: s.actor.RequestID,
+		Subject:   subject,
+		Roles:     req.Roles,
+		RoleIDs:   decision.RoleIDs,
+		Service:   req.Service,
+		Method:    strings.ToUpper(req.Method),
+		Host:      req.Host,
+		Path:      req.Path,
+		Effect:    decisionlog.Deny,
+		Reason:    decision.Reason,
+		LatencyUS: latency.Microseconds(),
+		Keep:      s.keepDecision(req.Roles),
+	}
+	if decision.Allowed {
+		entry.Effect = decisionlog.Allow
+	}
+	if route := decision.Route; route != nil {
+		entry.RouteID = &route.ID
+		entry.Route = route.Method + " " + route.Host + route.Path
+		entry.Service = route.Service
+	}
+
+	s.log(entry)
+}
+
+// boundRoleIDs returns the IDs of the roles of an allow reported by an
+// enforcer that are bound to its route, the roles the enforcer is trusted
+// with by name only.
+func (s *rbac) boundRoleIDs(d model.DecisionLog) ([]uuid.UUID, error) {
+	ids := []uuid.UUID{}
+	if d.Effect != decisionlog.Allow || d.RouteID == nil {
+		return ids, nil
+	}
+
+	bound, err := s.roles.FindByRoute(*d.RouteID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range bound {
+		if slices.Contains(d.Roles, role.Name) {
+			ids = append(ids, role.ID)
+		}
+	}
+	return ids, nil
+}
+
+// keepDecision tells whether decisions for the roles must all be logged: those
+// of callers holding the break-glass role, so the report of the access lists
+// every decision.
+func (s *rbac) keepDecision(roles []string) bool {
+	return s.breakGlassCfg.Role != "" && slices.Contains(roles, s.breakGlassCfg.Role)
+}
+
+func (s *rbac) log(entry *model.DecisionLog) {
+	if s.decisionLog != nil {
+		s.decisionLog.Log(entry)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+const defaultInstance = "default"
+
+// SelfService is the name the server registers its own routes under. It sends
+// no heartbeats, so it never becomes stale.
+const SelfService = "rbac"
+
+// ErrVersionNotRegistered is returned for a version of a service that did not
+// register its routes.
+var ErrVersionNotRegistered = errors.New("service version not registered")
+
+func (s *rbac) FindService(name string) (*model.Service, error) {
+	svc, err := s.services.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	if svc == nil {
+		return nil, errors.New("service not registered")
+	}
+	return svc, nil
+}
+
+func (s *rbac) FindServiceRoutes(service string) ([]*model.Route, error) {
+	return s.routes.FindByService(service)
+}
+
+func (s *rbac) FindServices() ([]*model.Service, error) {
+	return s.services.FindAll()
+}
+
+func (s *rbac) FindServiceVersion(service, version string) (*model.Version, error) {
+	v, err := s.services.FindVersion(service, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrVersionNotRegistered
+	}
+	return v, nil
+}
+
+// Heartbeat records that the instance running the version of the service is
+// alive. A stale service is alive again, its routes become active with the
+// next registration.
+func (s *rbac) Heartbeat(service, instance, version string) error {
+	if instance == "" {
+		instance = defaultInstance
+	}
+
+	return s.services.Heartbeat(service, instance, version)
+}
+
+// RetireServiceVersion drops the route set of the version, e.g. once a canary
+// is rolled back or blue/green traffic switched over.
+func (s *rbac) RetireServiceVersion(service, version string) error {
+	return s.atomic(func(s *rbac) error {
+		retired, err := s.services.RetireVersion(service, version, 0)
+		if err != nil {
+			return err
+		}
+		if !retired {
+			return ErrVersionNotRegistered
+		}
+
+		return s.record(AuditRetire, EntityService, service, map[string]string{"version": version}, nil)
+	})
+}
+
+// ExpireServiceVersions retires versions no instance reported within ttl.
+func (s *rbac) ExpireServiceVersions(ttl time.Duration) ([]*model.Version, error) {
+	versions, err := s.services.FindExpiredVersions(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*model.Version
+	for _, v := range versions {
+		if v.Service == SelfService {
+			continue
+		}
+		var retired bool
+		err := s.atomic(func(s *rbac) error {
+			var err error
+			if retired, err = s.services.RetireVersion(v.Service, v.Version, ttl); err != nil || !retired {
+				return err
+			}
+
+			return s.record(AuditRetire, EntityService, v.Service, v, nil)
+		})
+		if err != nil {
+			return expired, err
+		}
+		if retired {
+			expired = append(expired, v)
+		}
+	}
+
+	return expired, nil
+}
+
+// MarkStaleServices flags services that no instance reported within ttl and,
+// with deactivate, sets their routes inactive. It returns the affected
+// services. The server's own service is never stale.
+func (s *rbac) MarkStaleServices(ttl time.Duration, deactivate bool) ([]string, error) {
+	names, err := s.services.FindStale(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for _, name := range names {
+		if name == SelfService {
+			continue
+		}
+		var marked bool
+		err := s.atomic(func(s *rbac) error {
+			var err error
+			if marked, err = s.services.MarkStale(name, ttl, deactivate); err != nil || !marked {
+				return err
+			}
+
+			return s.record(AuditUpdate, EntityService, name, nil, map[string]bool{"stale": true, "deactivated": deactivate})
+		})
+		if err != nil {
+			return stale, err
+		}
+		if marked {
+			stale = append(stale, name)
+		}
+	}
+
+	return stale, nil
+}
+
+// recordHeartbeat counts a registration as a heartbeat, failing to record it
+// does not fail the registration.
+func (s *rbac) recordHeartbeat(service string, opts model.RegisterOptions) {
+	if err := s.Heartbeat(service, opts.Instance, opts.Version); err != nil {
+		log.Printf("failed to record heartbeat of service %s: %v", service, err)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"slices"
+
+	model "github.com/demkowo/rbac/models"
+)
+
+// FindManifest collects the routes and resources the roles, and the roles
+// assigned to the subject, are granted. The entries are sorted so the same
+// grants always give the same manifest.
+func (s *rbac) FindManifest(subject string, roles []string) (*model.Manifest, error) {
+	roles, err := s.subjectRoles(subject, roles)
+	if err != nil {
+		return nil, err
+	}
+	roles = slices.Clone(roles)
+	slices.Sort(roles)
+	roles = slices.Compact(roles)
+
+	manifest := &model.Manifest{
+		Roles:     roles,
+		Routes:    make(map[string][]string),
+		Resources: make(map[string]map[string][]string),
+	}
+	if len(roles) == 0 {
+		return manifest, nil
+	}
+
+	routes, err := s.routes.FindByRoleNames(roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range routes {
+		manifest.Routes[route.Service] = append(manifest.Routes[route.Service], route.Method+" "+route.Host+route.Path)
+	}
+	for service, pairs := range manifest.Routes {
+		slices.Sort(pairs)
+		manifest.Routes[service] = slices.Compact(pairs)
+	}
+
+	resources, err := s.resources.FindByRoleNames(roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, ra := range resources {
+		names, ok := manifest.Resources[ra.Resource.Type]
+		if !ok {
+			names = make(map[string][]string)
+			manifest.Resources[ra.Resource.Type] = names
+		}
+		actions := append(names[ra.Resource.Name], ra.Actions...)
+		slices.Sort(actions)
+		names[ra.Resource.Name] = slices.Compact(actions)
+	}
+
+	return manifest, nil
+}
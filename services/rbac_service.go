@@ -1,24 +1,121 @@
 package service
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"log"
+	"time"
 
 	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
 	"github.com/google/uuid"
 )
 
+type AccessRequestsRepo interface {
+	Add(*model.AccessRequest) error
+	Decide(*model.AccessRequest, string) (bool, error)
+	DisownRemovedGrants() error
+	Find(model.AccessRequestFilter) ([]*model.AccessRequest, error)
+	FindApprovers(uuid.UUID) ([]string, error)
+	FindByID(uuid.UUID) (*model.AccessRequest, error)
+	FindExpired(string) ([]*model.AccessRequest, error)
+	SetApprovers(uuid.UUID, []string) error
+}
+
+type AssignmentsRepo interface {
+	Add(*model.RoleAssignment) error
+	Delete(string, uuid.UUID) error
+	Expire(string, uuid.UUID) (bool, error)
+	Find(string) ([]*model.RoleAssignment, error)
+	FindExpired() ([]*model.RoleAssignment, error)
+	FindRoles(string) ([]string, error)
+}
+
+type AuditRepo interface {
+	Add(*model.AuditEntry, func(*model.AuditEntry) error) error
+	Find(model.AuditFilter) ([]*model.AuditEntry, error)
+	FindChain(int64, int) ([]*model.AuditEntry, error)
+}
+
+type BreakGlassRepo interface {
+	Add(*model.BreakGlass) (bool, error)
+	End(uuid.UUID, time.Time, string) (bool, error)
+	Find(bool) ([]*model.BreakGlass, error)
+	FindActive(string) (*model.BreakGlass, error)
+	FindByID(uuid.UUID) (*model.BreakGlass, error)
+	FindExpired() ([]*model.BreakGlass, error)
+}
+
+type ChangeSetsRepo interface {
+	Add(*model.ChangeSet) error
+	Find(string) ([]*model.ChangeSet, error)
+	FindByID(uuid.UUID) (*model.ChangeSet, error)
+	Publish(*model.ChangeSet, func(*model.PolicySnapshot) error) (bool, error)
+	Update(*model.ChangeSet) (bool, error)
+}
+
+type DecisionLogger interface {
+	Log(*model.DecisionLog)
+}
+
+type DecisionsRepo interface {
+	AllowedRole(time.Time, string) (bool, error)
+	Find(model.DecisionFilter) ([]*model.DecisionLog, error)
+	FindFirst() (*time.Time, error)
+	FindUnused(time.Time, uuid.UUID) ([]model.UnusedBinding, error)
+}
+
+type Notifier interface {
+	Notify(*model.Event)
+}
+
 type RbacRepo interface {
 	Add(*model.Rbac) error
+	Copy(uuid.UUID, uuid.UUID) error
 	Delete(*model.Rbac) error
 	Find() ([]*model.Rbac, error)
 }
 
+type ResourcesRepo interface {
+	Add(*model.Resource) error
+	Delete(uuid.UUID) error
+	Find(string, string) ([]*model.Resource, error)
+	FindByID(uuid.UUID) (*model.Resource, error)
+	FindByRole(uuid.UUID) ([]*model.ResourceActions, error)
+	FindByRoleNames([]string) ([]*model.ResourceActions, error)
+	FindRoles(uuid.UUID) ([]*model.RoleActions, error)
+	Grant(*model.Permission) error
+	Revoke(*model.Permission) error
+	Update(*model.Resource) ([]model.Permission, error)
+}
+
+type RevisionsRepo interface {
+	Add(string, string) (*model.Revision, error)
+	Find(int) ([]*model.Revision, error)
+	FindByID(int64) (*model.Revision, error)
+	FindLast() (*model.Revision, error)
+	Rollback(int64, string, string) (*model.Revision, error)
+	Snapshot() (*model.PolicySnapshot, error)
+}
+
+type ReviewsRepo interface {
+	Add(*model.ReviewCampaign, []*model.ReviewItem) error
+	Close(*model.ReviewCampaign, string) (bool, error)
+	Decide(uuid.UUID, string, []*model.ReviewItem) (bool, error)
+	Find(string) ([]*model.ReviewCampaign, error)
+	FindByID(uuid.UUID) (*model.ReviewCampaign, error)
+	FindItems(uuid.UUID, model.ReviewItemFilter) ([]*model.ReviewItem, error)
+	FindProgress(uuid.UUID) ([]model.ReviewProgress, error)
+	Reassign(uuid.UUID, string, string, string) (int64, error)
+	SetResult(uuid.UUID, string) error
+}
+
 type RolesRepo interface {
 	Add(*model.Role) error
 	Delete(string) error
 	ExistsByID(uuid.UUID) (bool, error)
 	Find() ([]*model.Role, error)
+	FindByID(uuid.UUID) (*model.Role, error)
 	FindByRoute(uuid.UUID) ([]*model.Role, error)
 	Update(*model.Role) error
 }
@@ -29,15 +126,105 @@ type RoutesRepo interface {
 	Delete(uuid.UUID) error
 	ExistsByID(uuid.UUID) (bool, error)
 	Find() ([]*model.Route, error)
+	FindByID(uuid.UUID) (*model.Route, error)
 	FindByRole(uuid.UUID) ([]*model.Route, error)
+	FindByRoleNames([]string) ([]*model.Route, error)
+	FindByService(string) ([]*model.Route, error)
+	Register(string, func([]*model.Route) (*model.Registration, error)) error
 	SetInactive(string) error
 	Update(*model.Route) error
 }
 
+type RulesRepo interface {
+	Add(*model.BindingRule) error
+	Delete(uuid.UUID) error
+	Find() ([]*model.BindingRule, error)
+	FindByID(uuid.UUID) (*model.BindingRule, error)
+}
+
+type ServicesRepo interface {
+	Find(string) (*model.Service, error)
+	FindAll() ([]*model.Service, error)
+	FindExpiredVersions(time.Duration) ([]*model.Version, error)
+	FindStale(time.Duration) ([]string, error)
+	FindVersion(string, string) (*model.Version, error)
+	Heartbeat(string, string, string) error
+	MarkStale(string, time.Duration, bool) (bool, error)
+	ResetFingerprints(string) error
+	RetireVersion(string, string, time.Duration) (bool, error)
+}
+
 type Rbac interface {
+	As(model.Actor) Rbac
+	FindAudit(model.AuditFilter) ([]*model.AuditEntry, error)
+	VerifyAudit() (*model.AuditVerification, error)
+
+	Authorize(model.AuthorizeRequest) (*model.Decision, error)
+	FindDecisions(model.DecisionFilter) ([]*model.DecisionLog, error)
+	RecordDecisions(string, []model.DecisionLog) error
+	FindManifest(string, []string) (*model.Manifest, error)
+
+	AddAccessRequest(*model.AccessRequest) error
+	ApproveAccessRequest(uuid.UUID, string, string) (*model.AccessRequest, error)
+	ExpireAccessGrants() ([]*model.AccessRequest, error)
+	FindAccessRequest(uuid.UUID) (*model.AccessRequest, error)
+	FindAccessRequests(model.AccessRequestFilter) ([]*model.AccessRequest, error)
+	FindApprovers(uuid.UUID) ([]string, error)
+	RejectAccessRequest(uuid.UUID, string) (*model.AccessRequest, error)
+	SetApprovers(uuid.UUID, []string) error
+
+	CloseReview(uuid.UUID) (*model.ReviewEvidence, error)
+	DecideReview(uuid.UUID, []model.ReviewDecision) ([]*model.ReviewItem, error)
+	FindReview(uuid.UUID) (*model.ReviewCampaign, error)
+	FindReviewEvidence(uuid.UUID) (*model.ReviewEvidence, error)
+	FindReviewItems(uuid.UUID, model.ReviewItemFilter) ([]*model.ReviewItem, error)
+	FindReviewProgress(uuid.UUID) ([]model.ReviewProgress, error)
+	FindReviews(string) ([]*model.ReviewCampaign, error)
+	ReassignReview(uuid.UUID, string, string) (int64, error)
+	StartReview(*model.ReviewCampaign, []string) error
+
+	EndBreakGlass(uuid.UUID) (*model.BreakGlass, error)
+	ExpireBreakGlass() ([]*model.BreakGlass, error)
+	FindBreakGlass(uuid.UUID) (*model.BreakGlass, error)
+	FindBreakGlasses(bool) ([]*model.BreakGlass, error)
+	FindBreakGlassReport(uuid.UUID) (*model.BreakGlassReport, error)
+	StartBreakGlass(string) (*model.BreakGlass, error)
+
+	AddAssignment(*model.RoleAssignment) error
+	DeleteAssignment(string, uuid.UUID) error
+	ExpireAssignments() ([]*model.RoleAssignment, error)
+	FindAssignments(string) ([]*model.RoleAssignment, error)
+
+	AddChangeOperations(uuid.UUID, []model.ChangeOperation) (*model.ChangeSet, error)
+	AddChangeSet(*model.ChangeSet) error
+	ApproveChangeSet(uuid.UUID) (*model.ChangeSet, error)
+	DeleteChangeOperation(uuid.UUID, int) (*model.ChangeSet, error)
+	DiscardChangeSet(uuid.UUID) (*model.ChangeSet, error)
+	FindChangeSet(uuid.UUID) (*model.ChangeSet, error)
+	FindChangeSets(string) ([]*model.ChangeSet, error)
+	PreviewChangeSet(uuid.UUID) (*model.ChangeSetPreview, error)
+	PublishChangeSet(uuid.UUID) (*model.ChangeSet, []model.ChangeConflict, error)
+
 	AddRbac(*model.Rbac) error
 	DeleteRbac(*model.Rbac) error
 	FindRbac() ([]*model.Rbac, error)
+	FindUnusedRbac(int, uuid.UUID) (*model.UnusedReport, error)
+	PruneUnusedRbac(int, uuid.UUID, bool) (*model.UnusedReport, error)
+
+	AddResource(*model.Resource) error
+	DeleteResource(uuid.UUID) error
+	FindResource(uuid.UUID) (*model.Resource, error)
+	FindResources(string, string) ([]*model.Resource, error)
+	FindResourcesByRole(uuid.UUID) ([]*model.ResourceActions, error)
+	FindRolesByResource(uuid.UUID) ([]*model.RoleActions, error)
+	GrantPermission(*model.Permission) error
+	RevokePermission(*model.Permission) error
+	UpdateResource(*model.Resource) error
+
+	DiffRevisions(int64, int64) (*model.PolicyDiff, error)
+	FindRevision(int64) (*model.Revision, error)
+	FindRevisions(int) ([]*model.Revision, error)
+	RollbackRevision(int64) (*model.Revision, error)
 
 	AddRole(*model.Role) error
 	DeleteRole(string) error
@@ -51,51 +238,170 @@ type Rbac interface {
 	DeleteRoute(uuid.UUID) error
 	FindRoutes() ([]*model.Route, error)
 	FindRoutesByRole(uuid.UUID) ([]*model.Route, error)
+	RegisterRoutes(string, []model.Route, model.RegisterOptions) (*model.RouteDiff, error)
+	RenameRoute(uuid.UUID, uuid.UUID) error
 	UpdateRoute(*model.Route) error
 	SetRoutesInactive(string) error
+
+	ExpireServiceVersions(time.Duration) ([]*model.Version, error)
+	FindService(string) (*model.Service, error)
+	FindRouteConflicts(string) ([]model.RouteConflict, error)
+	FindServiceRoutes(string) ([]*model.Route, error)
+	FindServices() ([]*model.Service, error)
+	FindServiceVersion(string, string) (*model.Version, error)
+	Heartbeat(string, string, string) error
+	MarkStaleServices(time.Duration, bool) ([]string, error)
+	RetireServiceVersion(string, string) error
+
+	AddRule(*model.BindingRule) error
+	DeleteRule(uuid.UUID) error
+	FindRule(uuid.UUID) (*model.BindingRule, error)
+	FindRules() ([]*model.BindingRule, error)
+	PreviewRule(*model.BindingRule) ([]model.RulePreview, error)
 }
 
+// Repos are the repositories of the service.
+type Repos struct {
+	AccessRequests AccessRequestsRepo
+	Assignments    AssignmentsRepo
+	Audit          AuditRepo
+	BreakGlass     BreakGlassRepo
+	ChangeSets     ChangeSetsRepo
+	Decisions      DecisionsRepo
+	Rbac           RbacRepo
+	Resources      ResourcesRepo
+	Revisions      RevisionsRepo
+	Reviews        ReviewsRepo
+	Roles          RolesRepo
+	Routes         RoutesRepo
+	Rules          RulesRepo
+	Services       ServicesRepo
+}
+
+// Transact runs fn with repositories bound to one transaction, committed if
+// fn returns nil.
+type Transact func(fn func(Repos) error) error
+
 type rbac struct {
-	rbac   RbacRepo
-	roles  RolesRepo
-	routes RoutesRepo
+	accessRequests AccessRequestsRepo
+	actor          model.Actor
+	admins         []string
+	assignments    AssignmentsRepo
+	audit          AuditRepo
+	auditKey       ed25519.PrivateKey
+	breakGlass     BreakGlassRepo
+	breakGlassCfg  BreakGlassConfig
+	changeSets     ChangeSetsRepo
+	decisions      DecisionsRepo
+	decisionLog    DecisionLogger
+	inTx           bool
+	notifier       Notifier
+	policyChanges  *[]string
+	rbac           RbacRepo
+	resources      ResourcesRepo
+	revisions      RevisionsRepo
+	reviews        ReviewsRepo
+	roles          RolesRepo
+	routes         RoutesRepo
+	rules          RulesRepo
+	services       ServicesRepo
+	transact       Transact
 }
 
-func NewRbac(rbacRepo RbacRepo, rolesRepo RolesRepo, routesRepo RoutesRepo) Rbac {
-	return &rbac{
-		rbac:   rbacRepo,
-		roles:  rolesRepo,
-		routes: routesRepo,
+// NewRbac creates the service. Its changes run through transact, so each is
+// committed together with its audit entry. Admins, subjects or "role:"
+// prefixed roles, manage assignments and approvers. With auditKey audit
+// entries are signed, it may be nil. The notifier, which may be nil too,
+// receives break-glass events.
+func NewRbac(repos Repos, transact Transact, admins []string, auditKey ed25519.PrivateKey, breakGlass BreakGlassConfig, decisionLog DecisionLogger, notifier Notifier) Rbac {
+	s := &rbac{
+		actor:         model.Actor{Name: SystemActor},
+		admins:        admins,
+		auditKey:      auditKey,
+		breakGlassCfg: breakGlass,
+		decisionLog:   decisionLog,
+		notifier:      notifier,
+		transact:      transact,
 	}
+	s.setRepos(repos)
+	return s
 }
 
-func (s *rbac) AddRbac(rbac *model.Rbac) error {
-	routeExists, err := s.routes.ExistsByID(rbac.RouteID)
-	if err != nil {
-		return err
-	}
-	if !routeExists {
-		return errors.New("route does not exist")
-	}
+func (s *rbac) setRepos(repos Repos) {
+	s.accessRequests = repos.AccessRequests
+	s.assignments = repos.Assignments
+	s.audit = repos.Audit
+	s.breakGlass = repos.BreakGlass
+	s.changeSets = repos.ChangeSets
+	s.decisions = repos.Decisions
+	s.rbac = repos.Rbac
+	s.resources = repos.Resources
+	s.revisions = repos.Revisions
+	s.reviews = repos.Reviews
+	s.roles = repos.Roles
+	s.routes = repos.Routes
+	s.rules = repos.Rules
+	s.services = repos.Services
+}
 
-	roleExists, err := s.roles.ExistsByID(rbac.RoleID)
-	if err != nil {
-		return err
-	}
-	if !roleExists {
-		return errors.New("role does not exist")
+// atomic runs fn on the service bound to one transaction, so the changes fn
+// makes, their audit entries and the policy revision they lead to are
+// committed together or not at all. Called from fn it joins the transaction.
+func (s *rbac) atomic(fn func(s *rbac) error) error {
+	if s.inTx {
+		return fn(s)
 	}
 
-	return s.rbac.Add(rbac)
+	return s.transact(func(repos Repos) error {
+		scoped := *s
+		scoped.inTx = true
+		scoped.policyChanges = new([]string)
+		scoped.setRepos(repos)
+
+		if err := fn(&scoped); err != nil {
+			return err
+		}
+		if err := scoped.disownRemovedGrants(); err != nil {
+			return err
+		}
+		return scoped.snapshotPolicy()
+	})
+}
+
+func (s *rbac) AddRbac(auth *model.Rbac) error {
+	return s.atomic(func(s *rbac) error {
+		routeExists, err := s.routes.ExistsByID(auth.RouteID)
+		if err != nil {
+			return err
+		}
+		if !routeExists {
+			return errors.New("route does not exist")
+		}
+
+		roleExists, err := s.roles.ExistsByID(auth.RoleID)
+		if err != nil {
+			return err
+		}
+		if !roleExists {
+			return errors.New("role does not exist")
+		}
+
+		if err := s.rbac.Add(auth); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityRbac, rbacID(auth), nil, auth)
+	})
 }
 
 func (s *rbac) DeleteRbac(auth *model.Rbac) error {
-	err := s.rbac.Delete(auth)
-	if err != nil {
-		return err
-	}
+	return s.atomic(func(s *rbac) error {
+		if err := s.rbac.Delete(auth); err != nil {
+			return err
+		}
 
-	return nil
+		return s.record(AuditDelete, EntityRbac, rbacID(auth), auth, nil)
+	})
 }
 
 func (s *rbac) FindRbac() ([]*model.Rbac, error) {
@@ -107,11 +413,28 @@ func (s *rbac) AddRole(role *model.Role) error {
 		role.ID = uuid.New()
 	}
 
-	return s.roles.Add(role)
+	return s.atomic(func(s *rbac) error {
+		if err := s.roles.Add(role); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityRole, role.ID.String(), nil, role)
+	})
 }
 
 func (s *rbac) DeleteRole(roleId string) error {
-	return s.roles.Delete(roleId)
+	return s.atomic(func(s *rbac) error {
+		var before *model.Role
+		if id, err := uuid.Parse(roleId); err == nil {
+			before, _ = s.roles.FindByID(id)
+		}
+
+		if err := s.roles.Delete(roleId); err != nil {
+			return err
+		}
+
+		return s.record(AuditDelete, EntityRole, roleId, before, nil)
+	})
 }
 
 func (s *rbac) FindRoles() ([]*model.Role, error) {
@@ -139,11 +462,36 @@ func (s *rbac) FindRolesByRoutes(routes []model.Route) (map[uuid.UUID][]*model.R
 }
 
 func (s *rbac) UpdateRole(role *model.Role) error {
-	return s.roles.Update(role)
+	return s.atomic(func(s *rbac) error {
+		before, _ := s.roles.FindByID(role.ID)
+
+		if err := s.roles.Update(role); err != nil {
+			return err
+		}
+
+		return s.record(AuditUpdate, EntityRole, role.ID.String(), before, role)
+	})
 }
 
 func (s *rbac) AddActiveRoutes(routes []model.Route) error {
-	return s.routes.AddActive(routes)
+	for i := range routes {
+		if err := normalizeRoute(&routes[i], routepath.Auto); err != nil {
+			return err
+		}
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.routes.AddActive(routes); err != nil {
+			return err
+		}
+		for _, route := range routes {
+			if err := s.resetFingerprints(route.Service); err != nil {
+				return err
+			}
+		}
+
+		return s.record(AuditCreate, EntityRoute, "", nil, routes)
+	})
 }
 
 func (s *rbac) AddRoute(route *model.Route) error {
@@ -151,11 +499,37 @@ func (s *rbac) AddRoute(route *model.Route) error {
 		route.ID = uuid.New()
 	}
 
-	return s.routes.Add(route)
+	if err := normalizeRoute(route, routepath.Auto); err != nil {
+		return err
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.routes.Add(route); err != nil {
+			return err
+		}
+		if err := s.resetFingerprints(route.Service); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityRoute, route.ID.String(), nil, route)
+	})
 }
 
 func (s *rbac) DeleteRoute(routeID uuid.UUID) error {
-	return s.routes.Delete(routeID)
+	return s.atomic(func(s *rbac) error {
+		before, _ := s.routes.FindByID(routeID)
+
+		if err := s.routes.Delete(routeID); err != nil {
+			return err
+		}
+		if before != nil {
+			if err := s.resetFingerprints(before.Service); err != nil {
+				return err
+			}
+		}
+
+		return s.record(AuditDelete, EntityRoute, routeID.String(), before, nil)
+	})
 }
 
 func (s *rbac) FindRoutes() ([]*model.Route, error) {
@@ -167,9 +541,40 @@ func (s *rbac) FindRoutesByRole(roleID uuid.UUID) ([]*model.Route, error) {
 }
 
 func (s *rbac) SetRoutesInactive(service string) error {
-	return s.routes.SetInactive(service)
+	return s.atomic(func(s *rbac) error {
+		if err := s.routes.SetInactive(service); err != nil {
+			return err
+		}
+
+		return s.record(AuditDeactivate, EntityService, service, nil, nil)
+	})
 }
 
 func (s *rbac) UpdateRoute(route *model.Route) error {
-	return s.routes.Update(route)
+	if err := normalizeRoute(route, routepath.Auto); err != nil {
+		return err
+	}
+
+	return s.atomic(func(s *rbac) error {
+		before, _ := s.routes.FindByID(route.ID)
+
+		if err := s.routes.Update(route); err != nil {
+			return err
+		}
+		if before != nil && before.Service != route.Service {
+			if err := s.resetFingerprints(before.Service); err != nil {
+				return err
+			}
+		}
+		if err := s.resetFingerprints(route.Service); err != nil {
+			return err
+		}
+
+		return s.record(AuditUpdate, EntityRoute, route.ID.String(), before, route)
+	})
+}
+
+// rbacID identifies a role binding in the audit log.
+func rbacID(rbac *model.Rbac) string {
+	return rbac.RouteID.String() + ":" + rbac.RoleID.String()
 }
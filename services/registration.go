@@ -0,0 +1,316 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
+	"github.com/google/uuid"
+)
+
+// ErrRoutesUnchanged is returned when the submitted routes match the last
+// registration of the service.
+var ErrRoutesUnchanged = errors.New("routes unchanged")
+
+// ErrInvalidRoute is returned for routes whose path can not be parsed or that
+// have no method, and for authorize requests that do not name the route.
+var ErrInvalidRoute = errors.New("invalid route")
+
+// RegisterRoutes atomically replaces the set of active routes of the service
+// with the given routes and returns how the stored routes changed. Unless
+// forced, a registration with the same fingerprint as the last one is skipped
+// with ErrRoutesUnchanged. With DryRun the diff is computed without touching
+// the DB.
+func (s *rbac) RegisterRoutes(service string, routes []model.Route, opts model.RegisterOptions) (*model.RouteDiff, error) {
+	routes, err := normalizeRoutes(service, routes, opts.Syntax)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := routesFingerprint(routes)
+
+	if opts.DryRun {
+		existing, err := s.routes.FindByService(service)
+		if err != nil {
+			return nil, err
+		}
+		reg, err := s.planRegistration(service, fingerprint, existing, routes, opts)
+		if err != nil {
+			return nil, err
+		}
+		return reg.Diff, nil
+	}
+
+	if !opts.Force {
+		last, err := s.services.FindVersion(service, opts.Version)
+		if err != nil {
+			return nil, err
+		}
+		if last != nil && last.Fingerprint == fingerprint {
+			s.recordHeartbeat(service, opts)
+			return &model.RouteDiff{Fingerprint: fingerprint}, ErrRoutesUnchanged
+		}
+	}
+
+	var reg *model.Registration
+	err = s.atomic(func(s *rbac) error {
+		err := s.routes.Register(service, func(existing []*model.Route) (*model.Registration, error) {
+			var err error
+			reg, err = s.planRegistration(service, fingerprint, existing, routes, opts)
+			return reg, err
+		})
+		if err != nil || !changed(reg.Diff) {
+			return err
+		}
+
+		return s.record(AuditRegister, EntityService, service, nil, registrationAudit(reg.Diff, opts.Version))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordHeartbeat(service, opts)
+	return reg.Diff, nil
+}
+
+// planRegistration works out what registering the routes changes compared to
+// the existing ones.
+func (s *rbac) planRegistration(service, fingerprint string, existing []*model.Route, routes []model.Route, opts model.RegisterOptions) (*model.Registration, error) {
+	diff, err := s.diffRoutes(existing, routes, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	diff.Fingerprint = fingerprint
+
+	detectRenames(diff, existing, routes, opts.AcceptRenames)
+
+	rules, err := s.rules.Find()
+	if err != nil {
+		return nil, err
+	}
+	if diff.Bound, err = ruleBindings(rules, diff.Added); err != nil {
+		return nil, err
+	}
+
+	if diff.Conflicts, err = s.registrationConflicts(diff, existing, routes); err != nil {
+		return nil, err
+	}
+
+	return &model.Registration{
+		Service:     service,
+		Version:     opts.Version,
+		Fingerprint: fingerprint,
+		Routes:      routes,
+		Renames:     diff.Renamed,
+		Bindings:    diff.Bound,
+		Diff:        diff,
+	}, nil
+}
+
+// RenameRoute carries the role bindings of a route over to the route that
+// replaced it, e.g. after accepting a rename proposed on registration.
+func (s *rbac) RenameRoute(from, to uuid.UUID) error {
+	for _, id := range []uuid.UUID{from, to} {
+		exists, err := s.routes.ExistsByID(id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("route does not exist")
+		}
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.rbac.Copy(from, to); err != nil {
+			return err
+		}
+
+		return s.record(AuditRename, EntityRoute, to.String(), map[string]uuid.UUID{"route_id": from}, map[string]uuid.UUID{"route_id": to})
+	})
+}
+
+// resetFingerprints makes the next registration of the service apply in
+// full after its routes were changed by hand, and the fingerprint served to
+// it no longer match the routes it registered.
+func (s *rbac) resetFingerprints(service string) error {
+	if service == "" {
+		return nil
+	}
+	return s.services.ResetFingerprints(service)
+}
+
+// changed reports whether a registration changed any routes or bindings.
+func changed(diff *model.RouteDiff) bool {
+	return len(diff.Added)+len(diff.Reactivated)+len(diff.Removed)+len(diff.Renamed)+len(diff.Bound) > 0
+}
+
+// registrationAudit is the part of a registration diff worth keeping in the
+// audit log, unchanged routes are left out.
+func registrationAudit(diff *model.RouteDiff, version string) any {
+	return map[string]any{
+		"version":     version,
+		"added":       diff.Added,
+		"reactivated": diff.Reactivated,
+		"removed":     diff.Removed,
+		"renamed":     diff.Renamed,
+		"bound":       diff.Bound,
+		"fingerprint": diff.Fingerprint,
+	}
+}
+
+// normalizeRoutes assigns the routes to the service, marks them active,
+// converts their paths to the canonical form and drops duplicates.
+func normalizeRoutes(service string, routes []model.Route, syntax routepath.Syntax) ([]model.Route, error) {
+	seen := make(map[string]bool)
+	res := make([]model.Route, 0, len(routes))
+
+	for _, route := range routes {
+		if err := normalizeRoute(&route, syntax); err != nil {
+			return nil, err
+		}
+		route.Service = service
+		route.Active = true
+		route.Versions = nil
+		if route.ID == uuid.Nil {
+			route.ID = uuid.New()
+		}
+
+		if seen[routeKey(route)] {
+			continue
+		}
+		seen[routeKey(route)] = true
+
+		res = append(res, route)
+	}
+
+	return res, nil
+}
+
+// normalizeRoute converts the host, the path and the path the route replaces
+// to the canonical form. A method or host given with the path, as in
+// "GET example.com/items/{id}", is used when the route has none.
+func normalizeRoute(route *model.Route, syntax routepath.Syntax) error {
+	pattern, err := routepath.Parse(route.Path, syntax)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRoute, err)
+	}
+	route.Path = pattern.String()
+
+	if route.Method == "" {
+		route.Method = pattern.Method
+	}
+	if route.Host == "" {
+		route.Host = pattern.Host
+	}
+	if route.Host, err = routepath.NormalizeHost(route.Host); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRoute, err)
+	}
+	route.Method = strings.ToUpper(route.Method)
+	if route.Method == "" {
+		return fmt.Errorf("%w: missing method of %s", ErrInvalidRoute, route.Path)
+	}
+
+	if route.Replaces != "" {
+		if route.Replaces, err = routepath.Normalize(route.Replaces, syntax); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRoute, err)
+		}
+	}
+
+	return nil
+}
+
+// diffRoutes compares routes submitted by a version of the service with the
+// stored ones. Submitted routes that already exist take over the stored ID and
+// path, which may differ in parameter names.
+// Routes missing from the submission are only removed if no other version
+// exposes them.
+func (s *rbac) diffRoutes(existing []*model.Route, routes []model.Route, version string) (*model.RouteDiff, error) {
+	diff := &model.RouteDiff{
+		Added:       []model.Route{},
+		Reactivated: []model.Route{},
+		Unchanged:   []model.Route{},
+		Removed:     []model.RemovedRoute{},
+	}
+
+	stored := make(map[string]*model.Route)
+	for _, route := range existing {
+		stored[routeKey(*route)] = route
+	}
+
+	submitted := make(map[string]bool)
+	for i := range routes {
+		key := routeKey(routes[i])
+		submitted[key] = true
+
+		old, ok := stored[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, routes[i])
+		case !old.Active:
+			routes[i].ID, routes[i].Path = old.ID, old.Path
+			diff.Reactivated = append(diff.Reactivated, routes[i])
+		default:
+			routes[i].ID, routes[i].Path = old.ID, old.Path
+			diff.Unchanged = append(diff.Unchanged, routes[i])
+		}
+	}
+
+	for _, route := range existing {
+		if !route.Active || submitted[routeKey(*route)] || len(route.Versions) == 0 || exposedByOtherVersion(route, version) {
+			continue
+		}
+
+		roles, err := s.roles.FindByRoute(route.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		removed := model.RemovedRoute{Route: *route, Roles: []string{}}
+		removed.Active = false
+		for _, role := range roles {
+			removed.Roles = append(removed.Roles, role.Name)
+		}
+		diff.Removed = append(diff.Removed, removed)
+	}
+
+	return diff, nil
+}
+
+func exposedByOtherVersion(route *model.Route, version string) bool {
+	for _, v := range route.Versions {
+		if v != version {
+			return true
+		}
+	}
+	return false
+}
+
+// routesFingerprint hashes the route set independently of the order in which
+// routes were submitted. Metadata is part of the fingerprint only when given,
+// so that updated operation descriptions are registered.
+func routesFingerprint(routes []model.Route) string {
+	keys := make([]string, 0, len(routes))
+	for _, route := range routes {
+		key := routeKey(route)
+		if route.Metadata != nil {
+			metadata, _ := json.Marshal(route.Metadata)
+			key += " " + string(metadata)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// routeKey identifies routes by method, host and canonical path, regardless of
+// parameter names. Hosts never contain spaces, so the key is unambiguous.
+func routeKey(route model.Route) string {
+	return route.Method + " " + route.Host + " " + routepath.Key(route.Path)
+}
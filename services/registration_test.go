@@ -0,0 +1,121 @@
+package service
+
+import (
+	"testing"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+// The fakes embed the repository interfaces, calling a method they do not
+// implement panics.
+type fakeRoutes struct {
+	RoutesRepo
+	routes []*model.Route
+}
+
+func (r *fakeRoutes) FindByService(service string) ([]*model.Route, error) {
+	var res []*model.Route
+	for _, route := range r.routes {
+		if route.Service == service {
+			res = append(res, route)
+		}
+	}
+	return res, nil
+}
+
+type fakeRoles struct {
+	RolesRepo
+	byRoute map[uuid.UUID][]*model.Role
+}
+
+func (r *fakeRoles) FindByRoute(id uuid.UUID) ([]*model.Role, error) {
+	return r.byRoute[id], nil
+}
+
+type fakeRules struct {
+	RulesRepo
+}
+
+func (r *fakeRules) Find() ([]*model.BindingRule, error) {
+	return nil, nil
+}
+
+func routeKeys(routes []model.Route) []string {
+	res := []string{}
+	for _, route := range routes {
+		res = append(res, route.Method+" "+route.Path)
+	}
+	return res
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRegisterRoutesDryRun(t *testing.T) {
+	get := &model.Route{ID: uuid.New(), Method: "GET", Path: "/users/:id", Service: "users", Active: true}
+	inactive := &model.Route{ID: uuid.New(), Method: "GET", Path: "/users", Service: "users"}
+	removed := &model.Route{ID: uuid.New(), Method: "DELETE", Path: "/users/:id", Service: "users", Active: true, Versions: []string{""}}
+	// Routes added through the routes API are not version-tracked, a
+	// registration leaves them alone.
+	added := &model.Route{ID: uuid.New(), Method: "PUT", Path: "/users/:id", Service: "users", Active: true}
+	other := &model.Route{ID: uuid.New(), Method: "GET", Path: "/orders", Service: "orders", Active: true}
+
+	s := &rbac{
+		routes: &fakeRoutes{routes: []*model.Route{get, inactive, removed, added, other}},
+		roles:  &fakeRoles{byRoute: map[uuid.UUID][]*model.Role{removed.ID: {{Name: "admin"}}}},
+		rules:  &fakeRules{},
+	}
+
+	routes := []model.Route{
+		{Method: "get", Path: "/users/:userID"},
+		{Method: "GET", Path: "/users"},
+		{Method: "POST", Path: "/users"},
+		{Method: "POST", Path: "/users"},
+	}
+	diff, err := s.RegisterRoutes("users", routes, model.RegisterOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := routeKeys(diff.Added); !equalKeys(got, []string{"POST /users"}) {
+		t.Errorf("added %v", got)
+	}
+	if got := routeKeys(diff.Reactivated); !equalKeys(got, []string{"GET /users"}) || diff.Reactivated[0].ID != inactive.ID {
+		t.Errorf("reactivated %v", got)
+	}
+	// Unchanged routes keep the stored ID and parameter names.
+	if got := routeKeys(diff.Unchanged); !equalKeys(got, []string{"GET /users/:id"}) || diff.Unchanged[0].ID != get.ID {
+		t.Errorf("unchanged %v", got)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != removed.ID || diff.Removed[0].Active || !equalKeys(diff.Removed[0].Roles, []string{"admin"}) {
+		t.Errorf("removed %+v", diff.Removed)
+	}
+	if diff.Fingerprint == "" {
+		t.Errorf("diff has no fingerprint")
+	}
+
+	// A dry run leaves the stored routes alone.
+	if !get.Active || inactive.Active || !removed.Active || !added.Active || get.Path != "/users/:id" {
+		t.Errorf("dry run changed the stored routes")
+	}
+}
+
+func TestRegisterRoutesInvalid(t *testing.T) {
+	s := &rbac{routes: &fakeRoutes{}, roles: &fakeRoles{}, rules: &fakeRules{}}
+
+	for _, route := range []model.Route{{Path: "/users"}, {Method: "GET", Path: "/files/*path/more"}} {
+		if _, err := s.RegisterRoutes("users", []model.Route{route}, model.RegisterOptions{DryRun: true}); err == nil {
+			t.Errorf("registering %+v succeeded, want an error", route)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"strings"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/demkowo/rbac/routepath"
+)
+
+const (
+	RenameSourceHint      = "hint"
+	RenameSourceHeuristic = "heuristic"
+
+	// renameSimilarity is the minimal path similarity for a removed and an
+	// added route of the same method to be proposed as a rename.
+	renameSimilarity = 0.75
+)
+
+// detectRenames fills in the renames of the diff. Renames hinted with
+// Replaces are always accepted, one-to-one heuristic matches between removed
+// and added routes are only proposed unless accept is set.
+func detectRenames(diff *model.RouteDiff, existing []*model.Route, routes []model.Route, accept bool) {
+	diff.Renamed = []model.Rename{}
+	diff.Proposed = []model.Rename{}
+
+	stored := make(map[string]*model.Route)
+	for _, route := range existing {
+		stored[routeKey(*route)] = route
+	}
+
+	renamed := make(map[string]bool)
+	for _, route := range routes {
+		if route.Replaces == "" || routepath.Key(route.Replaces) == routepath.Key(route.Path) {
+			continue
+		}
+
+		old, ok := stored[routeKey(model.Route{Method: route.Method, Host: route.Host, Path: route.Replaces})]
+		if !ok {
+			continue
+		}
+
+		diff.Renamed = append(diff.Renamed, model.Rename{From: *old, To: route, Source: RenameSourceHint})
+		renamed[routeKey(*old)] = true
+		renamed[routeKey(route)] = true
+	}
+
+	candidates := make(map[string][]model.Rename)
+	targets := make(map[string]int)
+	for _, removed := range diff.Removed {
+		if renamed[routeKey(removed.Route)] {
+			continue
+		}
+		for _, added := range diff.Added {
+			if renamed[routeKey(added)] || added.Method != removed.Method || added.Host != removed.Host {
+				continue
+			}
+			similarity := pathSimilarity(removed.Path, added.Path)
+			if similarity < renameSimilarity {
+				continue
+			}
+			candidates[routeKey(removed.Route)] = append(candidates[routeKey(removed.Route)], model.Rename{
+				From:       removed.Route,
+				To:         added,
+				Source:     RenameSourceHeuristic,
+				Similarity: similarity,
+			})
+			targets[routeKey(added)]++
+		}
+	}
+
+	for _, removed := range diff.Removed {
+		matches := candidates[routeKey(removed.Route)]
+		if len(matches) != 1 || targets[routeKey(matches[0].To)] != 1 {
+			continue
+		}
+		if accept {
+			diff.Renamed = append(diff.Renamed, matches[0])
+		} else {
+			diff.Proposed = append(diff.Proposed, matches[0])
+		}
+	}
+}
+
+// pathSimilarity returns 1 minus the edit distance between the paths
+// normalized by the length of the longer one.
+func pathSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	longer := max(len(a), len(b))
+	return 1 - float64(editDistance(a, b))/float64(longer)
+}
+
+func editDistance(a, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"testing"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+func renameKeys(renames []model.Rename) []string {
+	res := []string{}
+	for _, rename := range renames {
+		res = append(res, rename.From.Method+" "+rename.From.Path+" > "+rename.To.Path+" "+rename.Source)
+	}
+	return res
+}
+
+func TestDetectRenames(t *testing.T) {
+	route := func(method, path string) *model.Route {
+		return &model.Route{ID: uuid.New(), Method: method, Path: path, Active: true}
+	}
+	removed := func(routes ...*model.Route) []model.RemovedRoute {
+		var res []model.RemovedRoute
+		for _, route := range routes {
+			res = append(res, model.RemovedRoute{Route: *route})
+		}
+		return res
+	}
+
+	profile := route("GET", "/users/:id/profile")
+	settings := route("GET", "/users/:id/settings")
+	hinted := route("GET", "/accounts/:id")
+	deleted := route("DELETE", "/users/:id/profile")
+	existing := []*model.Route{profile, settings, hinted, deleted}
+
+	added := []model.Route{
+		{Method: "GET", Path: "/users/:id/profiles"},
+		{Method: "GET", Path: "/members/:id", Replaces: "/accounts/:id"},
+		{Method: "PUT", Path: "/users/:id/profiles"},
+		{Method: "GET", Path: "/orders"},
+	}
+
+	tests := []struct {
+		name     string
+		removed  []model.RemovedRoute
+		added    []model.Route
+		accept   bool
+		renamed  []string
+		proposed []string
+	}{
+		{
+			name:     "proposed",
+			removed:  removed(profile, hinted, deleted),
+			added:    added,
+			renamed:  []string{"GET /accounts/:id > /members/:id hint"},
+			proposed: []string{"GET /users/:id/profile > /users/:id/profiles heuristic"},
+		},
+		{
+			name:    "accepted",
+			removed: removed(profile, hinted, deleted),
+			added:   added,
+			accept:  true,
+			renamed: []string{
+				"GET /accounts/:id > /members/:id hint",
+				"GET /users/:id/profile > /users/:id/profiles heuristic",
+			},
+			proposed: []string{},
+		},
+		{
+			name:     "ambiguous",
+			removed:  removed(profile, settings),
+			added:    []model.Route{{Method: "GET", Path: "/users/:id/profiles"}, {Method: "GET", Path: "/users/:id/setting"}, {Method: "GET", Path: "/users/:id/profil"}},
+			renamed:  []string{},
+			proposed: []string{"GET /users/:id/settings > /users/:id/setting heuristic"},
+		},
+		{
+			name:     "hint to unknown route",
+			removed:  removed(profile),
+			added:    []model.Route{{Method: "GET", Path: "/me", Replaces: "/users/me"}},
+			renamed:  []string{},
+			proposed: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		diff := &model.RouteDiff{Added: tt.added, Removed: tt.removed}
+
+		detectRenames(diff, existing, tt.added, tt.accept)
+
+		if got := renameKeys(diff.Renamed); !equalKeys(got, tt.renamed) {
+			t.Errorf("%s: renamed %v, want %v", tt.name, got, tt.renamed)
+		}
+		if got := renameKeys(diff.Proposed); !equalKeys(got, tt.proposed) {
+			t.Errorf("%s: proposed %v, want %v", tt.name, got, tt.proposed)
+		}
+	}
+}
+
+func TestPathSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"/users", "/users", 1},
+		{"/users", "/Users", 1},
+		{"/abc", "/abd", 0.75},
+		{"/ab", "/abcd", 0.6},
+		{"", "/a", 0},
+	}
+
+	for _, tt := range tests {
+		if got := pathSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("pathSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const (
+	ResourceHTTPRoute = "http_route"
+	ResourceUIElement = "ui_element"
+	ResourceTopic     = "topic"
+
+	// ActionAccess is the only action of HTTP routes, the method is part of
+	// the route.
+	ActionAccess = "access"
+)
+
+// defaultActions are the actions of resources created without any.
+var defaultActions = map[string][]string{
+	ResourceUIElement: {"view"},
+	ResourceTopic:     {"publish", "subscribe"},
+}
+
+// identifier validates resource types and actions, custom types included.
+var identifier = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+var errRouteResource = errors.New("http_route resources are managed through routes")
+
+func (s *rbac) AddResource(resource *model.Resource) error {
+	if resource.ID == uuid.Nil {
+		resource.ID = uuid.New()
+	}
+
+	if err := validateResource(resource); err != nil {
+		return err
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.resources.Add(resource); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityResource, resource.ID.String(), nil, resource)
+	})
+}
+
+func (s *rbac) DeleteResource(id uuid.UUID) error {
+	return s.atomic(func(s *rbac) error {
+		before, err := s.findOwnResource(id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.resources.Delete(id); err != nil {
+			return err
+		}
+
+		return s.record(AuditDelete, EntityResource, id.String(), before, nil)
+	})
+}
+
+func (s *rbac) FindResource(id uuid.UUID) (*model.Resource, error) {
+	return s.resources.FindByID(id)
+}
+
+// FindResources lists resources of any type, routes included, optionally
+// filtered by type and service.
+func (s *rbac) FindResources(resourceType, service string) ([]*model.Resource, error) {
+	return s.resources.Find(resourceType, service)
+}
+
+func (s *rbac) FindResourcesByRole(roleID uuid.UUID) ([]*model.ResourceActions, error) {
+	return s.resources.FindByRole(roleID)
+}
+
+func (s *rbac) FindRolesByResource(resourceID uuid.UUID) ([]*model.RoleActions, error) {
+	return s.resources.FindRoles(resourceID)
+}
+
+// UpdateResource updates the resource, revoking the permissions of actions
+// it no longer has.
+func (s *rbac) UpdateResource(resource *model.Resource) error {
+	if err := validateResource(resource); err != nil {
+		return err
+	}
+
+	return s.atomic(func(s *rbac) error {
+		before, err := s.findOwnResource(resource.ID)
+		if err != nil {
+			return err
+		}
+
+		pruned, err := s.resources.Update(resource)
+		if err != nil {
+			return err
+		}
+
+		if err := s.record(AuditUpdate, EntityResource, resource.ID.String(), before, resource); err != nil {
+			return err
+		}
+		for _, permission := range pruned {
+			if err := s.record(AuditDelete, EntityPermission, permissionID(&permission), permission, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GrantPermission grants the role an action of the resource. Access to routes
+// is stored as before, as rbac records.
+func (s *rbac) GrantPermission(permission *model.Permission) error {
+	resource, err := s.permissionResource(permission)
+	if err != nil {
+		return err
+	}
+
+	roleExists, err := s.roles.ExistsByID(permission.RoleID)
+	if err != nil {
+		return err
+	}
+	if !roleExists {
+		return errors.New("role does not exist")
+	}
+
+	if resource.Type == ResourceHTTPRoute {
+		return s.AddRbac(&model.Rbac{RouteID: resource.ID, RoleID: permission.RoleID})
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.resources.Grant(permission); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityPermission, permissionID(permission), nil, permission)
+	})
+}
+
+func (s *rbac) RevokePermission(permission *model.Permission) error {
+	resource, err := s.permissionResource(permission)
+	if err != nil {
+		return err
+	}
+
+	if resource.Type == ResourceHTTPRoute {
+		return s.DeleteRbac(&model.Rbac{RouteID: resource.ID, RoleID: permission.RoleID})
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.resources.Revoke(permission); err != nil {
+			return err
+		}
+
+		return s.record(AuditDelete, EntityPermission, permissionID(permission), permission, nil)
+	})
+}
+
+// permissionResource returns the resource of the permission, making sure the
+// action is one of its actions.
+func (s *rbac) permissionResource(permission *model.Permission) (*model.Resource, error) {
+	resource, err := s.resources.FindByID(permission.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permission.Action == "" && resource.Type == ResourceHTTPRoute {
+		permission.Action = ActionAccess
+	}
+	for _, action := range resource.Actions {
+		if action == permission.Action {
+			return resource, nil
+		}
+	}
+
+	return nil, fmt.Errorf("action %q is not one of %s", permission.Action, strings.Join(resource.Actions, ", "))
+}
+
+// findOwnResource returns the resource unless it is a route.
+func (s *rbac) findOwnResource(id uuid.UUID) (*model.Resource, error) {
+	resource, err := s.resources.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if resource.Type == ResourceHTTPRoute {
+		return nil, errRouteResource
+	}
+	return resource, nil
+}
+
+// permissionID identifies a permission in the audit log.
+func permissionID(permission *model.Permission) string {
+	return permission.ResourceID.String() + ":" + permission.RoleID.String() + ":" + permission.Action
+}
+
+func validateResource(resource *model.Resource) error {
+	resource.Type = strings.ToLower(strings.TrimSpace(resource.Type))
+	if resource.Type == ResourceHTTPRoute {
+		return errRouteResource
+	}
+	if !identifier.MatchString(resource.Type) {
+		return fmt.Errorf("invalid resource type %q", resource.Type)
+	}
+
+	if strings.TrimSpace(resource.Name) == "" {
+		return errors.New("resource name is required")
+	}
+
+	if len(resource.Actions) == 0 {
+		resource.Actions = defaultActions[resource.Type]
+	}
+	if len(resource.Actions) == 0 {
+		resource.Actions = []string{ActionAccess}
+	}
+
+	seen := make(map[string]bool)
+	actions := resource.Actions[:0:0]
+	for _, action := range resource.Actions {
+		action = strings.ToLower(strings.TrimSpace(action))
+		if !identifier.MatchString(action) {
+			return fmt.Errorf("invalid action %q", action)
+		}
+		if !seen[action] {
+			seen[action] = true
+			actions = append(actions, action)
+		}
+	}
+	resource.Actions = actions
+
+	return nil
+}
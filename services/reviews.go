@@ -0,0 +1,362 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+// Statuses of review campaigns.
+const (
+	ReviewOpen   = "open"
+	ReviewClosed = "closed"
+)
+
+// Results of revoked review items once the campaign is closed.
+const (
+	ReviewRevoked  = "revoked"
+	ReviewNotFound = "not_found"
+)
+
+const (
+	AuditClose = "close"
+
+	EntityReview     = "review"
+	EntityReviewItem = "review_item"
+)
+
+// Events sent to hooks.
+const (
+	EventReviewStarted = "review.started"
+	EventReviewClosed  = "review.closed"
+)
+
+var (
+	// ErrReviewStatus is returned when changing a campaign that is closed.
+	ErrReviewStatus = errors.New("review campaign is not open")
+
+	// ErrNotReviewer is returned when deciding an item assigned to another
+	// reviewer, or reassigning the items of another reviewer.
+	ErrNotReviewer = errors.New("not the reviewer of the item")
+)
+
+// StartReview copies the bindings in the scope of the campaign into review
+// items. Each role is reviewed by one of the reviewers, in turn by role name,
+// who are subjects or "role:" prefixed roles like approvers.
+func (s *rbac) StartReview(c *model.ReviewCampaign, reviewers []string) error {
+	if s.actor.Name == AnonymousActor || s.actor.Name == SystemActor {
+		return fmt.Errorf("%w: campaigns need the identity of the caller", ErrInvalidChange)
+	}
+	if c.Name = strings.TrimSpace(c.Name); c.Name == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidChange)
+	}
+	if c.DueAt != nil && !c.DueAt.After(time.Now()) {
+		return fmt.Errorf("%w: due_at is in the past", ErrInvalidChange)
+	}
+
+	var valid []string
+	for _, reviewer := range reviewers {
+		if reviewer = strings.TrimSpace(reviewer); reviewer != "" && reviewer != approverRolePrefix && !slices.Contains(valid, reviewer) {
+			valid = append(valid, reviewer)
+		}
+	}
+	if len(valid) == 0 {
+		return fmt.Errorf("%w: missing reviewers", ErrInvalidChange)
+	}
+
+	policy, err := s.revisions.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	roles := make(map[uuid.UUID]model.Role)
+	for _, role := range policy.Roles {
+		roles[role.ID] = role
+	}
+	routes := make(map[uuid.UUID]model.Route)
+	for _, route := range policy.Routes {
+		routes[route.ID] = route
+	}
+
+	c.Role = ""
+	if c.RoleID != nil {
+		role, ok := roles[*c.RoleID]
+		if !ok {
+			return fmt.Errorf("%w: role %s does not exist", ErrInvalidChange, *c.RoleID)
+		}
+		c.Role = role.Name
+	}
+
+	c.ID = uuid.New()
+	c.Status = ReviewOpen
+	c.CreatedBy = s.actor.Name
+	c.ClosedBy, c.ClosedAt = "", nil
+
+	var items []*model.ReviewItem
+	for _, binding := range policy.Rbac {
+		route, role := routes[binding.RouteID], roles[binding.RoleID]
+		if c.Service != "" && route.Service != c.Service || c.RoleID != nil && role.ID != *c.RoleID {
+			continue
+		}
+		items = append(items, &model.ReviewItem{
+			ID:         uuid.New(),
+			CampaignID: c.ID,
+			RouteID:    route.ID,
+			Method:     route.Method,
+			Host:       route.Host,
+			Path:       route.Path,
+			Service:    route.Service,
+			RoleID:     role.ID,
+			Role:       role.Name,
+			Decision:   model.ReviewPending,
+		})
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("%w: no bindings in scope", ErrInvalidChange)
+	}
+
+	slices.SortFunc(items, func(a, b *model.ReviewItem) int {
+		return strings.Compare(a.Role, b.Role)
+	})
+	reviewer := make(map[uuid.UUID]string)
+	for _, item := range items {
+		if _, ok := reviewer[item.RoleID]; !ok {
+			reviewer[item.RoleID] = valid[len(reviewer)%len(valid)]
+		}
+		item.Reviewer = reviewer[item.RoleID]
+	}
+
+	c.Progress = model.ReviewProgress{Total: len(items), Pending: len(items)}
+	err = s.atomic(func(s *rbac) error {
+		if err := s.reviews.Add(c, items); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityReview, c.ID.String(), nil, c)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify(EventReviewStarted, c, fmt.Sprintf("Access review %q started with %d bindings to review by %s.",
+		c.Name, len(items), strings.Join(valid, ", ")))
+	return nil
+}
+
+// DecideReview keeps or revokes items of an open campaign, all or none. Only
+// the reviewer of an item decides it; decisions may change until the
+// campaign is closed.
+func (s *rbac) DecideReview(id uuid.UUID, decisions []model.ReviewDecision) ([]*model.ReviewItem, error) {
+	if len(decisions) == 0 {
+		return nil, fmt.Errorf("%w: missing decisions", ErrInvalidChange)
+	}
+
+	if _, err := s.openReview(id); err != nil {
+		return nil, err
+	}
+
+	items, err := s.reviews.FindItems(id, model.ReviewItemFilter{})
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*model.ReviewItem)
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	now := time.Now().UTC()
+	var before, decided []*model.ReviewItem
+	for _, d := range decisions {
+		item, ok := byID[d.ItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: item %s is not part of the campaign", ErrInvalidChange, d.ItemID)
+		}
+		if d.Decision != model.ReviewKeep && d.Decision != model.ReviewRevoke {
+			return nil, fmt.Errorf("%w: decision must be %s or %s", ErrInvalidChange, model.ReviewKeep, model.ReviewRevoke)
+		}
+		if !s.actsAs(item.Reviewer) {
+			return nil, fmt.Errorf("%w: item %s is reviewed by %s", ErrNotReviewer, item.ID, item.Reviewer)
+		}
+
+		prev := *item
+		item.Decision = d.Decision
+		item.Comment = strings.TrimSpace(d.Comment)
+		item.DecidedBy = s.actor.Name
+		item.DecidedAt = &now
+		before = append(before, &prev)
+		decided = append(decided, item)
+	}
+
+	err = s.atomic(func(s *rbac) error {
+		ok, err := s.reviews.Decide(id, ReviewOpen, decided)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: it was closed concurrently", ErrReviewStatus)
+		}
+
+		for i, item := range decided {
+			if err := s.record(AuditUpdate, EntityReviewItem, item.ID.String(), before[i], item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decided, nil
+}
+
+// ReassignReview hands the pending items of a reviewer to another. Only the
+// creator of the campaign, an admin or the reviewer reassigns them.
+func (s *rbac) ReassignReview(id uuid.UUID, from, to string) (int64, error) {
+	if from, to = strings.TrimSpace(from), strings.TrimSpace(to); from == "" || to == "" || to == approverRolePrefix {
+		return 0, fmt.Errorf("%w: missing reviewer", ErrInvalidChange)
+	}
+
+	c, err := s.openReview(id)
+	if err != nil {
+		return 0, err
+	}
+	if c.CreatedBy != s.actor.Name && !s.actsAs(from) && s.checkAdmin() != nil {
+		return 0, fmt.Errorf("%w: only the creator of the campaign, an admin or %s reassign its items", ErrNotReviewer, from)
+	}
+
+	var n int64
+	err = s.atomic(func(s *rbac) error {
+		var err error
+		if n, err = s.reviews.Reassign(id, ReviewOpen, from, to); err != nil || n == 0 {
+			return err
+		}
+
+		return s.record(AuditUpdate, EntityReview, id.String(), map[string]string{"reviewer": from}, map[string]any{"reviewer": to, "items": n})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// CloseReview removes the bindings of revoked items and closes the campaign
+// in one transaction, so when a removal fails the campaign stays open and
+// the close can be retried. Pending items are kept. It returns the evidence
+// of the closed campaign.
+func (s *rbac) CloseReview(id uuid.UUID) (*model.ReviewEvidence, error) {
+	if s.actor.Name == AnonymousActor {
+		return nil, fmt.Errorf("%w: closing needs the identity of the caller", ErrInvalidChange)
+	}
+
+	c, err := s.openReview(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	c.Status, c.ClosedBy, c.ClosedAt = ReviewClosed, s.actor.Name, &now
+
+	err = s.atomic(func(s *rbac) error {
+		revoked, err := s.reviews.FindItems(id, model.ReviewItemFilter{Decision: model.ReviewRevoke})
+		if err != nil {
+			return err
+		}
+
+		live, err := s.rbac.Find()
+		if err != nil {
+			return err
+		}
+		bindings := make(map[string]bool)
+		for _, binding := range live {
+			bindings[rbacID(binding)] = true
+		}
+
+		for _, item := range revoked {
+			binding := &model.Rbac{RouteID: item.RouteID, RoleID: item.RoleID}
+			item.Result = ReviewRevoked
+			if !bindings[rbacID(binding)] {
+				item.Result = ReviewNotFound
+			} else if err := s.DeleteRbac(binding); err != nil {
+				return fmt.Errorf("failed to revoke binding %s: %w", rbacID(binding), err)
+			}
+
+			if err := s.reviews.SetResult(item.ID, item.Result); err != nil {
+				return err
+			}
+		}
+
+		ok, err := s.reviews.Close(c, ReviewOpen)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: it was closed concurrently", ErrReviewStatus)
+		}
+
+		return s.record(AuditClose, EntityReview, id.String(), nil, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(EventReviewClosed, c, fmt.Sprintf("Access review %q closed by %s: %d bindings kept, %d revoked, %d not reviewed.",
+		c.Name, c.ClosedBy, c.Progress.Kept, c.Progress.Revoked, c.Progress.Pending))
+
+	return s.FindReviewEvidence(id)
+}
+
+func (s *rbac) FindReview(id uuid.UUID) (*model.ReviewCampaign, error) {
+	return s.reviews.FindByID(id)
+}
+
+func (s *rbac) FindReviews(status string) ([]*model.ReviewCampaign, error) {
+	return s.reviews.Find(status)
+}
+
+func (s *rbac) FindReviewItems(id uuid.UUID, filter model.ReviewItemFilter) ([]*model.ReviewItem, error) {
+	return s.reviews.FindItems(id, filter)
+}
+
+// FindReviewProgress returns the progress of each reviewer of the campaign.
+func (s *rbac) FindReviewProgress(id uuid.UUID) ([]model.ReviewProgress, error) {
+	return s.reviews.FindProgress(id)
+}
+
+// FindReviewEvidence documents the campaign with all its items, decisions
+// and, once closed, the results of revocations.
+func (s *rbac) FindReviewEvidence(id uuid.UUID) (*model.ReviewEvidence, error) {
+	c, err := s.reviews.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence := &model.ReviewEvidence{Campaign: c, ExportedAt: time.Now().UTC()}
+
+	if evidence.Reviewers, err = s.reviews.FindProgress(id); err != nil {
+		return nil, err
+	}
+	if evidence.Items, err = s.reviews.FindItems(id, model.ReviewItemFilter{}); err != nil {
+		return nil, err
+	}
+	if evidence.Items == nil {
+		evidence.Items = []*model.ReviewItem{}
+	}
+
+	return evidence, nil
+}
+
+func (s *rbac) openReview(id uuid.UUID) (*model.ReviewCampaign, error) {
+	c, err := s.reviews.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != ReviewOpen {
+		return nil, fmt.Errorf("%w: it is %s", ErrReviewStatus, c.Status)
+	}
+	return c, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const defaultRevisionLimit = 100
+
+// policyEntities are the entities whose changes create a revision.
+var policyEntities = map[string]bool{
+	EntityRbac:    true,
+	EntityRole:    true,
+	EntityRoute:   true,
+	EntityService: true,
+}
+
+func (s *rbac) FindRevision(revision int64) (*model.Revision, error) {
+	return s.revisions.FindByID(revision)
+}
+
+func (s *rbac) FindRevisions(limit int) ([]*model.Revision, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = defaultRevisionLimit
+	}
+	return s.revisions.Find(limit)
+}
+
+// DiffRevisions compares the policy of two revisions, to 0 being the latest.
+func (s *rbac) DiffRevisions(from, to int64) (*model.PolicyDiff, error) {
+	a, err := s.revisions.FindByID(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var b *model.Revision
+	if to == 0 {
+		b, err = s.revisions.FindLast()
+	} else {
+		b, err = s.revisions.FindByID(to)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffSnapshots(a.Snapshot, b.Snapshot)
+	diff.From, diff.To = a.Revision, b.Revision
+	return diff, nil
+}
+
+// RollbackRevision restores the roles, routes and bindings of the revision
+// in one transaction. The restored policy becomes a new revision, history is
+// never rewritten.
+func (s *rbac) RollbackRevision(revision int64) (*model.Revision, error) {
+	var rev *model.Revision
+	err := s.atomic(func(s *rbac) error {
+		var err error
+		if rev, err = s.revisions.Rollback(revision, s.actor.Name, fmt.Sprintf("rollback to revision %d", revision)); err != nil {
+			return err
+		}
+		if err := s.accessRequests.DisownRemovedGrants(); err != nil {
+			return err
+		}
+
+		return s.record(AuditRollback, EntityPolicy, strconv.FormatInt(revision, 10), nil, map[string]int64{"revision": rev.Revision})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// snapshotPolicy stores the policy as a new revision once the changes noted
+// by record are made, if they changed it. It runs in their transaction, so
+// they fail if the revision cannot be stored.
+func (s *rbac) snapshotPolicy() error {
+	changes := *s.policyChanges
+	if len(changes) == 0 {
+		return nil
+	}
+
+	reason := changes[0]
+	if len(changes) > 1 {
+		reason += fmt.Sprintf(" and %d more changes", len(changes)-1)
+	}
+	_, err := s.revisions.Add(s.actor.Name, reason)
+	return err
+}
+
+func diffSnapshots(a, b *model.PolicySnapshot) *model.PolicyDiff {
+	diff := &model.PolicyDiff{
+		AddedRoles:      []model.Role{},
+		RemovedRoles:    []model.Role{},
+		ChangedRoles:    []model.RoleChange{},
+		AddedRoutes:     []model.Route{},
+		RemovedRoutes:   []model.Route{},
+		ChangedRoutes:   []model.RouteChange{},
+		AddedBindings:   []model.Rbac{},
+		RemovedBindings: []model.Rbac{},
+	}
+
+	roles := make(map[uuid.UUID]model.Role)
+	for _, role := range a.Roles {
+		roles[role.ID] = role
+	}
+	for _, role := range b.Roles {
+		before, ok := roles[role.ID]
+		switch {
+		case !ok:
+			diff.AddedRoles = append(diff.AddedRoles, role)
+		case before != role:
+			diff.ChangedRoles = append(diff.ChangedRoles, model.RoleChange{Before: before, After: role})
+		}
+		delete(roles, role.ID)
+	}
+	for _, role := range a.Roles {
+		if _, ok := roles[role.ID]; ok {
+			diff.RemovedRoles = append(diff.RemovedRoles, role)
+		}
+	}
+
+	routes := make(map[uuid.UUID]model.Route)
+	for _, route := range a.Routes {
+		routes[route.ID] = route
+	}
+	for _, route := range b.Routes {
+		before, ok := routes[route.ID]
+		switch {
+		case !ok:
+			diff.AddedRoutes = append(diff.AddedRoutes, route)
+		case routeChanged(before, route):
+			diff.ChangedRoutes = append(diff.ChangedRoutes, model.RouteChange{Before: before, After: route})
+		}
+		delete(routes, route.ID)
+	}
+	for _, route := range a.Routes {
+		if _, ok := routes[route.ID]; ok {
+			diff.RemovedRoutes = append(diff.RemovedRoutes, route)
+		}
+	}
+
+	bindings := make(map[string]bool)
+	for _, binding := range a.Rbac {
+		bindings[rbacID(&binding)] = true
+	}
+	for _, binding := range b.Rbac {
+		if !bindings[rbacID(&binding)] {
+			diff.AddedBindings = append(diff.AddedBindings, binding)
+		}
+		delete(bindings, rbacID(&binding))
+	}
+	for _, binding := range a.Rbac {
+		if bindings[rbacID(&binding)] {
+			diff.RemovedBindings = append(diff.RemovedBindings, binding)
+		}
+	}
+
+	return diff
+}
+
+func routeChanged(a, b model.Route) bool {
+	return a.Method != b.Method || a.Host != b.Host || a.Path != b.Path || a.Service != b.Service || a.Active != b.Active
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+func (s *rbac) AddRule(rule *model.BindingRule) error {
+	if rule.ID == uuid.Nil {
+		rule.ID = uuid.New()
+	}
+
+	if _, err := rulePathPattern(rule.PathPattern); err != nil {
+		return err
+	}
+
+	roleExists, err := s.roles.ExistsByID(rule.RoleID)
+	if err != nil {
+		return err
+	}
+	if !roleExists {
+		return errors.New("role does not exist")
+	}
+
+	return s.atomic(func(s *rbac) error {
+		if err := s.rules.Add(rule); err != nil {
+			return err
+		}
+
+		return s.record(AuditCreate, EntityRule, rule.ID.String(), nil, rule)
+	})
+}
+
+func (s *rbac) DeleteRule(ruleID uuid.UUID) error {
+	return s.atomic(func(s *rbac) error {
+		before, _ := s.rules.FindByID(ruleID)
+
+		if err := s.rules.Delete(ruleID); err != nil {
+			return err
+		}
+
+		return s.record(AuditDelete, EntityRule, ruleID.String(), before, nil)
+	})
+}
+
+func (s *rbac) FindRule(ruleID uuid.UUID) (*model.BindingRule, error) {
+	return s.rules.FindByID(ruleID)
+}
+
+func (s *rbac) FindRules() ([]*model.BindingRule, error) {
+	return s.rules.Find()
+}
+
+// PreviewRule lists the stored routes the rule matches and whether they are
+// already bound to the rule's role.
+func (s *rbac) PreviewRule(rule *model.BindingRule) ([]model.RulePreview, error) {
+	routes, err := s.routes.Find()
+	if err != nil {
+		return nil, err
+	}
+
+	bound, err := s.routes.FindByRole(rule.RoleID)
+	if err != nil {
+		return nil, err
+	}
+
+	boundIDs := make(map[uuid.UUID]bool)
+	for _, route := range bound {
+		boundIDs[route.ID] = true
+	}
+
+	res := []model.RulePreview{}
+	for _, route := range routes {
+		matches, err := ruleMatches(rule, route)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			res = append(res, model.RulePreview{Route: *route, Bound: boundIDs[route.ID]})
+		}
+	}
+
+	return res, nil
+}
+
+// ruleBindings returns the bindings the rules create for the routes.
+func ruleBindings(rules []*model.BindingRule, routes []model.Route) ([]model.Rbac, error) {
+	bindings := []model.Rbac{}
+
+	for _, rule := range rules {
+		for _, route := range routes {
+			matches, err := ruleMatches(rule, &route)
+			if err != nil {
+				return nil, err
+			}
+			if matches {
+				bindings = append(bindings, model.Rbac{RouteID: route.ID, RoleID: rule.RoleID, RuleID: &rule.ID})
+			}
+		}
+	}
+
+	return bindings, nil
+}
+
+func ruleMatches(rule *model.BindingRule, route *model.Route) (bool, error) {
+	if rule.Service != "" && rule.Service != "*" && rule.Service != route.Service {
+		return false, nil
+	}
+
+	if rule.Method != "" && rule.Method != "*" && !strings.EqualFold(rule.Method, route.Method) {
+		return false, nil
+	}
+
+	pattern, err := rulePathPattern(rule.PathPattern)
+	if err != nil {
+		return false, err
+	}
+
+	return pattern.MatchString(route.Path), nil
+}
+
+func rulePathPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.New("invalid path pattern")
+	}
+	return re, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/demkowo/rbac/decisionlog"
+	model "github.com/demkowo/rbac/models"
+	"github.com/google/uuid"
+)
+
+const defaultUnusedDays = 90
+
+var (
+	ErrIncompleteDecisionLog = errors.New("decisions were not logged for the whole window, pass force to prune anyway")
+	ErrRedactedDecisionLog   = errors.New("decisions were logged with redacted roles, their bindings cannot be told apart")
+)
+
+// FindUnusedRbac suggests removing the bindings, of the role if one is
+// given, no logged decision used within the last days. Only allows logged to
+// the database count, so with sampled allows rarely used bindings may be
+// suggested too. The server's own routes are never suggested, they are
+// registered again on every start.
+func (s *rbac) FindUnusedRbac(days int, roleID uuid.UUID) (*model.UnusedReport, error) {
+	if days <= 0 {
+		days = defaultUnusedDays
+	}
+
+	report := &model.UnusedReport{
+		Days:  days,
+		Since: time.Now().UTC().AddDate(0, 0, -days),
+	}
+
+	first, err := s.decisions.FindFirst()
+	if err != nil {
+		return nil, err
+	}
+	report.LoggingSince = first
+	report.Complete = first != nil && !first.After(report.Since)
+
+	if report.Redacted, err = s.decisions.AllowedRole(report.Since, decisionlog.Redacted); err != nil {
+		return nil, err
+	}
+
+	unused, err := s.decisions.FindUnused(report.Since, roleID)
+	if err != nil {
+		return nil, err
+	}
+	report.Unused = []model.UnusedBinding{}
+	for _, b := range unused {
+		if b.Route.Service != SelfService {
+			report.Unused = append(report.Unused, b)
+		}
+	}
+
+	return report, nil
+}
+
+// PruneUnusedRbac removes the bindings FindUnusedRbac suggests through
+// DeleteRbac, so every removal is audited. Unless forced it refuses when the
+// decision log does not cover the whole window, and even forced when roles
+// were redacted in it.
+func (s *rbac) PruneUnusedRbac(days int, roleID uuid.UUID, force bool) (*model.UnusedReport, error) {
+	report, err := s.FindUnusedRbac(days, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Redacted {
+		return report, ErrRedactedDecisionLog
+	}
+	if !report.Complete && !force {
+		return report, ErrIncompleteDecisionLog
+	}
+
+	for i, b := range report.Unused {
+		if err := s.DeleteRbac(&model.Rbac{RouteID: b.Route.ID, RoleID: b.Role.ID}); err != nil {
+			report.Unused = report.Unused[:i]
+			return report, err
+		}
+	}
+
+	return report, nil
+}
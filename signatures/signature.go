@@ -0,0 +1,34 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	SignatureHeader = "X-RBAC-Signature"
+	TimestampHeader = "X-RBAC-Timestamp"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp, service name and
+// body, separated by new lines, using the shared secret of the service.
+func Sign(secret, service, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(service))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature in constant time.
+func Verify(secret, service, timestamp string, body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	want, _ := hex.DecodeString(Sign(secret, service, timestamp, body))
+	return hmac.Equal(got, want)
+}
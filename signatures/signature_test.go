@@ -0,0 +1,53 @@
+package signature
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"routes":[]}`, "4bf6893930d999e3e58968107c765d7dcd3f471a8b5917e845c1076044e808b1"},
+		{"", "647791cc6d442ed04ed267a1359ad5cbc31039798bd0d32777286e924ffbd68b"},
+	}
+
+	for _, tt := range tests {
+		if got := Sign("s3cr3t", "orders", "1700000000", []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign of %q = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const secret, service, timestamp, body = "s3cr3t", "orders", "1700000000", `{"routes":[]}`
+	signature := Sign(secret, service, timestamp, []byte(body))
+
+	tests := []struct {
+		name      string
+		secret    string
+		service   string
+		timestamp string
+		body      string
+		signature string
+		want      bool
+	}{
+		{"valid", secret, service, timestamp, body, signature, true},
+		{"upper case hex", secret, service, timestamp, body, strings.ToUpper(signature), true},
+		{"other secret", "t0ps3cr3t", service, timestamp, body, signature, false},
+		{"other service", secret, "users", timestamp, body, signature, false},
+		{"other timestamp", secret, service, "1700000001", body, signature, false},
+		{"other body", secret, service, timestamp, `{"routes":null}`, signature, false},
+		{"truncated", secret, service, timestamp, body, signature[:len(signature)-2], false},
+		{"not hex", secret, service, timestamp, body, "zz" + signature[2:], false},
+		{"empty", secret, service, timestamp, body, "", false},
+	}
+
+	for _, tt := range tests {
+		if got := Verify(tt.secret, tt.service, tt.timestamp, []byte(tt.body), tt.signature); got != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}